@@ -121,10 +121,10 @@ END;;
 DROP PROCEDURE IF EXISTS `createDeveloper`;;
 CREATE PROCEDURE `createDeveloper`(IN `nameParam` tinytext, OUT `ulidParam` char(26))
 BEGIN
-    -- Create developer entry
+    -- Create developer entry, active and verified since it doesn't go through the review process
     SET ulidParam = ULID_FROM_DATETIME(NOW());
-    INSERT INTO developers (id, name)
-    VALUES (ulidParam, nameParam);
+    INSERT INTO developers (id, name, state)
+    VALUES (ulidParam, nameParam, b'11');
 
     SELECT 'OK' AS result;
 END;;
@@ -140,10 +140,10 @@ BEGIN
         SET MESSAGE_TEXT = 'DEVELOPER_ULID_NOTFOUND';
     END IF;
 
-    -- Create the game entry ---
+    -- Create the game entry, active so that players can join it ---
     SET gameUlid = ULID_FROM_DATETIME(NOW());
-    INSERT INTO games(id, developerid, name, created)
-        VALUES (gameUlid, developerUlidParam, gameName, NOW());
+    INSERT INTO games(id, developerid, name, state, created)
+        VALUES (gameUlid, developerUlidParam, gameName, b'1', NOW());
         SELECT 'OK' AS result;
 END;;
 
@@ -44,11 +44,50 @@ func main() {
 		panic(err)
 	}
 
+	// Permit any origin in authless mode, unless specified otherwise
+	authlessOrigins := "*"
+	if os.Getenv("AUTHLESS_ORIGINS") != "" {
+		authlessOrigins = os.Getenv("AUTHLESS_ORIGINS")
+	}
+
 	useInMemoryClientMgr, err := strconv.ParseBool(os.Getenv("USE_IN_MEMORY_CLIENT_MGR"))
 	if err != nil {
 		panic(err)
 	}
 
+	// KeyDB settings are only required if the in-memory client manager is disabled
+	var keydbPort, keydbDB int
+	if !useInMemoryClientMgr {
+		if keydbPort, err = strconv.Atoi(os.Getenv("KEYDB_PORT")); err != nil {
+			panic(err)
+		}
+		if keydbDB, err = strconv.Atoi(os.Getenv("KEYDB_DB")); err != nil {
+			panic(err)
+		}
+	}
+
+	// Signaling connections are closed after 60 seconds of silence, unless specified otherwise
+	signalingIdleTimeout := 60
+	if os.Getenv("SIGNALING_IDLE_TIMEOUT") != "" {
+		if signalingIdleTimeout, err = strconv.Atoi(os.Getenv("SIGNALING_IDLE_TIMEOUT")); err != nil {
+			panic(err)
+		}
+	}
+
+	// Signaling clients can send 30 messages per second, and each IP address can open 30 connections per minute,
+	// unless specified otherwise
+	signalingRateLimit, signalingUpgradeRateLimit := 30, 30
+	if os.Getenv("SIGNALING_RATE_LIMIT") != "" {
+		if signalingRateLimit, err = strconv.Atoi(os.Getenv("SIGNALING_RATE_LIMIT")); err != nil {
+			panic(err)
+		}
+	}
+	if os.Getenv("SIGNALING_UPGRADE_RATE_LIMIT") != "" {
+		if signalingUpgradeRateLimit, err = strconv.Atoi(os.Getenv("SIGNALING_UPGRADE_RATE_LIMIT")); err != nil {
+			panic(err)
+		}
+	}
+
 	enableEmail, err := strconv.ParseBool(os.Getenv("ENABLE_EMAIL"))
 	if err != nil {
 		panic(err)
@@ -70,6 +109,9 @@ func main() {
 			[ISO 3166-1 alpha-3 country code]-[A one-word name]-[numerical instance number]
 
 			e.g. "USA-Omega-1".
+
+			If multiple servers share a KeyDB server, each server must have a unique nickname, as it is used
+			to relay signaling messages between servers.
 		*/
 		os.Getenv("SERVER_NICKNAME"),
 
@@ -101,15 +143,84 @@ func main() {
 		authlessMode,
 
 		/*
-			USE_IN_MEMORY_CLIENT_MGR: Specifies if the server should use a KeyDB server for client management.
+			AUTHLESS_ORIGINS: Specifies a comma-separated list of origins that are permitted to connect to the signaling
+			server in authless mode (e.g. "example.com,*.example.com,localhost:8080"). Ignored when not in authless mode,
+			as each game has its own list of authorized origins.
 
-			By default, this should be set to true. However, if you are using Authless Mode, you should set this to false.
-			Note that using the built-in client manager will severely harm performance.
+			By default, this is set to "*", which permits any origin.
+		*/
+		authlessOrigins,
+
+		/*
+			USE_IN_MEMORY_CLIENT_MGR: Specifies if the server should use the built-in client manager instead of a KeyDB server.
 
-			This is intended for standalone or development environments.
+			By default, this should be set to true, which keeps all signaling clients and lobbies in memory.
+			Set this to false to share clients and lobbies with other servers using a KeyDB (or Redis) server,
+			so that multiple signaling servers can run behind a load balancer.
 		*/
 		useInMemoryClientMgr,
 
+		// Change this to your KeyDB server address (e.g. 127.0.0.1). Ignored when using the built-in client manager.
+		os.Getenv("KEYDB_HOST"),
+
+		// Change this to your KeyDB server port (e.g. 6379). Ignored when using the built-in client manager.
+		keydbPort,
+
+		// Change this to your KeyDB database number (e.g. 0). Ignored when using the built-in client manager.
+		keydbDB,
+
+		/*
+			SIGNALING_IDLE_TIMEOUT: Specifies how many seconds a signaling connection may go without responding
+			before the server treats it as disconnected. The server pings every connection at half this interval.
+
+			Set this to 0 to disable server pings and idle timeouts.
+		*/
+		signalingIdleTimeout,
+
+		/*
+			SIGNALING_RATE_LIMIT: Specifies how many messages per second each signaling client may send.
+			Clients that exceed this limit receive RATE_LIMITED, and are disconnected if they keep exceeding it.
+			Specific opcodes (such as ICE or LOBBY_LIST) have stricter limits of their own.
+
+			Set this to 0 to disable the limit.
+		*/
+		signalingRateLimit,
+
+		/*
+			SIGNALING_UPGRADE_RATE_LIMIT: Specifies how many signaling connections per minute each IP address may open.
+
+			Set this to 0 to disable the limit.
+		*/
+		signalingUpgradeRateLimit,
+
+		/*
+			SIGNALING_OPCODE_RATE_LIMITS: Specifies a comma-separated list of rate limits for specific opcodes, written as
+			OPCODE=PerSecond/Burst (e.g. "ICE=20/100,LOBBY_LIST=1/5"). Each client may send Burst messages with the opcode
+			at once, and earns PerSecond more every second.
+
+			Opcodes that are not listed keep their default limits. Set an opcode to 0/0 to remove its limit.
+		*/
+		os.Getenv("SIGNALING_OPCODE_RATE_LIMITS"),
+
+		/*
+			SIGNALING_RATE_LIMIT_STRIKES: Specifies how many RATE_LIMITED replies a signaling client may receive before it
+			is disconnected with VIOLATION, written as PerSecond/Burst (e.g. "0.1/5" allows 5 at once, and one more every
+			10 seconds).
+
+			By default, this is set to "0.1/5".
+		*/
+		os.Getenv("SIGNALING_RATE_LIMIT_STRIKES"),
+
+		/*
+			TRUSTED_PROXIES: Specifies a comma-separated list of IP addresses or CIDR ranges of reverse proxies
+			(e.g. "127.0.0.1,10.0.0.0/8"). The X-Forwarded-For, X-Real-IP and True-Client-IP headers are only used
+			to find the address of a client when the request comes from one of these proxies.
+
+			By default, no proxies are trusted and the address of the connection is always used. If the server runs
+			behind a reverse proxy, set this, or every client will appear to have the address of the proxy.
+		*/
+		os.Getenv("TRUSTED_PROXIES"),
+
 		// Specify a boolean value if you want to enable email sending on the server.
 		enableEmail,
 
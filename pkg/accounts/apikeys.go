@@ -0,0 +1,44 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// APIKeyPrefix starts every game API key, so that leaked keys are easy to recognize.
+const APIKeyPrefix = "clo_"
+
+// GenerateAPIKey generates a game API key. The key is made of a public ID, used to find the key, and a random 256-bit
+// secret. Only the ID and the hash of the secret are stored, so the key can't be shown again after it is created.
+func GenerateAPIKey() (id string, secret string, key string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	id = ulid.Make().String()
+	secret = hex.EncodeToString(buf)
+	return id, secret, APIKeyPrefix + id + "." + secret, nil
+}
+
+// ParseAPIKey splits a game API key into its ID and secret.
+func ParseAPIKey(key string) (id string, secret string, ok bool) {
+	key, ok = strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(key, ".")
+	if !ok || len(id) != ulid.EncodedSize || secret == "" {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// HashAPIKeySecret hashes the secret of a game API key for storage. Secrets are random, so a fast hash is enough.
+func HashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,6 +2,7 @@ package accounts
 
 import (
 	"log"
+	"sync"
 
 	scrypt "github.com/elithrar/simple-scrypt"
 )
@@ -27,3 +28,11 @@ func VerifyPassword(password string, hash string) error {
 	err := scrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err
 }
+
+var dummyHash = sync.OnceValue(func() string { return HashPassword("correct horse battery staple") })
+
+// VerifyDummyPassword compares a password against a throwaway hash, and discards the result.
+// Use this when an account doesn't exist, so that the request takes as long as it would if the account existed.
+func VerifyDummyPassword(password string) {
+	VerifyPassword(password, dummyHash())
+}
@@ -0,0 +1,12 @@
+package accounts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SessionID returns the public ID of a session token. Session tokens are secret, so sessions are listed and revoked using this ID instead.
+func SessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
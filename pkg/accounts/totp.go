@@ -0,0 +1,146 @@
+package accounts
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults used by every common authenticator app.
+const (
+	TOTPPeriod = 30 // Seconds per time step
+	TOTPDigits = 6  // Digits per code
+	TOTPSkew   = 1  // Time steps before and after the current one that are still accepted (clock drift)
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpModulus keeps the last TOTPDigits digits of a number.
+var totpModulus = func() uint32 {
+	modulus := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		modulus *= 10
+	}
+	return modulus
+}()
+
+// GenerateTOTPSecret generates a random 160-bit TOTP secret, encoded as unpadded base32.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth:// URI used to provision a TOTP secret in an authenticator app (usually as a QR code).
+//
+// issuer - The name of the service shown in the authenticator app.
+// account - The name of the account shown in the authenticator app.
+// secret - The base32 encoded TOTP secret.
+func TOTPURI(issuer string, account string, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(TOTPPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+// TOTPCode returns the TOTP code of a secret for the given time step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226, section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%totpModulus), nil
+}
+
+// ValidateTOTP checks a TOTP code against a secret at the current time, allowing for TOTPSkew steps of clock drift.
+//
+// Codes from time steps at or before lastStep are rejected, so that a code cannot be used twice.
+// Returns the time step the code belongs to and true if the code is valid.
+func ValidateTOTP(secret string, code string, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := time.Now().Unix() / TOTPPeriod
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Characters used for recovery codes. Ambiguous characters (0, 1, i, l, o) are left out.
+const recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// GenerateRecoveryCodes generates the given number of one-time recovery codes, formatted as "xxxxx-xxxxx".
+//
+// Recovery codes should be stored using HashPassword, after passing them through NormalizeRecoveryCode.
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, count)
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := range codes {
+		var code strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, err
+			}
+			code.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+		codes[i] = code.String()
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode removes formatting from a recovery code, so that "ABCDE-FGHJK" and "abcdefghjk" are the same code.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
+
+// GenerateSecurityCode generates a random numeric one-time code (i.e. for security code emails).
+func GenerateSecurityCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(totpModulus)))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, n.Int64()), nil
+}
@@ -0,0 +1,96 @@
+package accounts
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// The SHA1 secret of the RFC 6238 test vectors, "12345678901234567890", encoded as base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238, appendix B. The RFC uses 8 digit codes, so only the last TOTPDigits digits are compared.
+	for _, tc := range []struct {
+		time int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		want := tc.want[len(tc.want)-TOTPDigits:]
+		got, err := TOTPCode(rfc6238Secret, tc.time/TOTPPeriod)
+		if err != nil || got != want {
+			t.Errorf("TOTPCode at %d = %q, %v; want %q", tc.time, got, err, want)
+		}
+	}
+
+	// Secrets are case insensitive, but must be base32
+	if got, err := TOTPCode("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1); err != nil || got != "287082" {
+		t.Errorf("TOTPCode with a lowercase secret = %q, %v; want 287082", got, err)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode accepted a secret that isn't base32")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// Don't let the time step change halfway through the test
+	if TOTPPeriod-time.Now().Unix()%TOTPPeriod < 2 {
+		time.Sleep(2 * time.Second)
+	}
+	current := time.Now().Unix() / TOTPPeriod
+	code := func(step int64) string {
+		code, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	// A code that doesn't belong to any accepted step
+	var wrong string
+	for i := 0; wrong == ""; i++ {
+		wrong = fmt.Sprintf("%0*d", TOTPDigits, i)
+		for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+			if wrong == code(step) {
+				wrong = ""
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		code     string
+		lastStep int64
+		want     int64
+		ok       bool
+	}{
+		{"current step", code(current), 0, current, true},
+		{"surrounding spaces", " " + code(current) + " ", 0, current, true},
+		{"previous step", code(current - TOTPSkew), 0, current - TOTPSkew, true},
+		{"next step", code(current + TOTPSkew), 0, current + TOTPSkew, true},
+		{"too old", code(current - TOTPSkew - 1), 0, 0, false},
+		{"too new", code(current + TOTPSkew + 1), 0, 0, false},
+		{"already used", code(current), current, 0, false},
+		{"used before", code(current), current - 1, current, true},
+		{"too short", code(current)[1:], 0, 0, false},
+		{"too long", code(current) + "0", 0, 0, false},
+		{"wrong code", wrong, 0, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, tc.code, tc.lastStep)
+			if ok != tc.ok || step != tc.want {
+				t.Errorf("ValidateTOTP(%q, %d) = %d, %v; want %d, %v", tc.code, tc.lastStep, step, ok, tc.want, tc.ok)
+			}
+		})
+	}
+
+	if _, ok := ValidateTOTP("not base32!", code(current), 0); ok {
+		t.Error("ValidateTOTP accepted a code for a secret that isn't base32")
+	}
+}
@@ -15,6 +15,12 @@ import (
 	v0 "github.com/cloudlink-omega/backend/pkg/api/v0"
 	constants "github.com/cloudlink-omega/backend/pkg/constants"
 	dm "github.com/cloudlink-omega/backend/pkg/data"
+	ratelimit "github.com/cloudlink-omega/backend/pkg/ratelimit"
+	signaling "github.com/cloudlink-omega/backend/pkg/signaling"
+	clientmgr "github.com/cloudlink-omega/backend/pkg/signaling/clientmgr"
+	relay "github.com/cloudlink-omega/backend/pkg/signaling/relay"
+	utils "github.com/cloudlink-omega/backend/pkg/utils"
+	"github.com/redis/go-redis/v9"
 )
 
 // FileServer conveniently sets up a http.FileServer handler to serve
@@ -49,6 +55,48 @@ func RunServer(host string, port int, mgr *dm.Manager) {
 	// Init DB
 	mgr.InitDB()
 
+	// Delete expired magic links, sessions and login challenges in the background
+	mgr.StartSweeper()
+
+	// Use a KeyDB server for signaling client management if the in-memory client manager is disabled.
+	// Messages for clients connected to other servers are relayed through KeyDB as well.
+	var bus relay.Bus = relay.NewMemoryBus()
+	if !mgr.UseInMemoryClientMgr {
+		rdb := redis.NewClient(&redis.Options{
+			Addr: fmt.Sprintf("%s:%d", mgr.KeyDBConfig.Host, mgr.KeyDBConfig.Port),
+			DB:   mgr.KeyDBConfig.DB,
+		})
+		if err := rdb.Ping(mgr.Ctx).Err(); err != nil {
+			log.Fatal("[Server] Failed to connect to a KeyDB server: ", err)
+		}
+		log.Printf("[Server] Connected to KeyDB server at %s:%d", mgr.KeyDBConfig.Host, mgr.KeyDBConfig.Port)
+		signaling.Manager = clientmgr.NewKeyDB(rdb)
+		bus = relay.NewKeyDBBus(rdb)
+	}
+
+	// Close signaling connections that stop responding to pings
+	signaling.IdleTimeout = mgr.SignalingIdleTimeout
+
+	// Limit how many messages each signaling client can send, and how often each IP address can connect
+	signaling.ClientRateLimit = ratelimit.Rate{PerSecond: float64(mgr.SignalingRateLimit), Burst: 3 * mgr.SignalingRateLimit}
+	if mgr.SignalingUpgradeRate > 0 {
+		signaling.UpgradeLimiter = ratelimit.NewLimiter(ratelimit.Rate{PerSecond: float64(mgr.SignalingUpgradeRate) / 60, Burst: mgr.SignalingUpgradeRate})
+	}
+	for opcode, rate := range mgr.SignalingOpcodeRates {
+		if rate.PerSecond > 0 {
+			signaling.OpcodeRateLimits[opcode] = rate
+		} else {
+			delete(signaling.OpcodeRateLimits, opcode)
+		}
+	}
+	if mgr.SignalingStrikeRate != nil {
+		signaling.RateLimitStrikes = *mgr.SignalingStrikeRate
+	}
+
+	if err := signaling.UseRelay(mgr.ServerNickname, bus); err != nil {
+		log.Fatal("[Server] Failed to start the signaling relay: ", err)
+	}
+
 	// Display public server nickname
 	log.Printf("[Server] CLΩ Backend v%s", constants.Version)
 	log.Printf("[Server] This server is called %s and is publicly available at %s", mgr.ServerNickname, mgr.PublicHostname)
@@ -73,8 +121,11 @@ func RunServer(host string, port int, mgr *dm.Manager) {
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
-	// Add Real IP middleware
-	r.Use(middleware.RealIP)
+	// Use the client address provided by trusted proxies
+	r.Use(RealIP(mgr))
+
+	// Refuse blocked IP addresses before any route (or websocket upgrade) is reached
+	r.Use(IPFilter(mgr))
 
 	// Mount custom middleware to pass data manager into requests
 	r.Use(func(next http.Handler) http.Handler {
@@ -113,6 +164,34 @@ func RunServer(host string, port int, mgr *dm.Manager) {
 	wg.Wait()
 }
 
+// RealIP creates middleware that replaces the remote address of requests from trusted proxies with the address of the
+// client, as provided by the proxy. Requests from anywhere else keep the address of the connection, since their headers
+// can say anything.
+func RealIP(mgr *dm.Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if address := utils.ForwardedIP(r, mgr.TrustedProxies); address != "" {
+				r.RemoteAddr = address
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IPFilter creates middleware that refuses requests from IP addresses on the blocklist.
+// It must be used after RealIP, so that the address of the client is checked rather than the address of a proxy.
+func IPFilter(mgr *dm.Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mgr.IsIPBlocked(utils.RemoteIP(r)) {
+				http.Error(w, "Your IP address has been blocked", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func StartAPI(host string, port int, r http.Handler) error {
 	err := func() error {
 		// Serve root router
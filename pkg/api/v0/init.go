@@ -17,4 +17,8 @@ func init() {
 	Router.Route("/", routes.RootRouter)
 	Router.Route("/signaling", routes.SignalingRouter)
 	Router.Route("/admin", routes.AdminRouter)
+	Router.Route("/mfa", routes.MFARouter)
+	Router.Route("/sessions", routes.SessionsRouter)
+	Router.Route("/developers", routes.DevelopersRouter)
+	Router.Route("/games", routes.GameAPIRouter)
 }
@@ -11,6 +11,7 @@ import (
 	constants "github.com/cloudlink-omega/backend/pkg/constants"
 	dm "github.com/cloudlink-omega/backend/pkg/data"
 	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	signaling "github.com/cloudlink-omega/backend/pkg/signaling"
 	structs "github.com/cloudlink-omega/backend/pkg/structs"
 
 	"github.com/go-chi/chi/v5"
@@ -32,14 +33,21 @@ func VerifyAdminSession(validate *validator.Validate, dm *dm.Manager, w http.Res
 		return false, nil
 	}
 
+	return verifyAdminToken(dm, w, s.Token)
+}
+
+// verifyAdminToken checks that a session token belongs to an admin, writing an error to the client if it doesn't.
+// Used by admin requests that need more than a session token in their request body.
+func verifyAdminToken(dm *dm.Manager, w http.ResponseWriter, token string) (bool, *structs.Client) {
+
 	// Find and read user account given session token
 	var session *structs.Client
-	session, err := dm.VerifySessionToken(s.Token)
+	session, err := dm.VerifySessionToken(token)
 
 	// Handle errors
 	if err != nil {
 		switch err {
-		case errors.ErrSessionNotFound:
+		case errors.ErrSessionNotFound, errors.ErrSessionRevoked:
 			w.WriteHeader(http.StatusUnauthorized)
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
@@ -82,13 +90,18 @@ func AdminRouter(r chi.Router) {
 			return
 		}
 
-		var verifLink string
+		var verifLink, unsubLink string
 		var err error
 		if verifLink, err = dm.GenerateMagicLink(admin.ULID, constants.LINKMODE_EMAIL); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
 			return
 		}
+		if unsubLink, err = dm.GenerateMagicLink(admin.ULID, constants.LINKMODE_UNSUBSCRIBE); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
 
 		if err := dm.SendHTMLEmail(&structs.EmailArgs{
 			Subject:  "Hello, " + admin.Username + "!",
@@ -97,7 +110,7 @@ func AdminRouter(r chi.Router) {
 		}, &structs.TemplateData{
 			Name:             admin.Username,
 			VerificationLink: fmt.Sprintf("%s/api/v0/verify?token=%s", dm.PublicHostname, verifLink),
-			UnsubscribeLink:  fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, verifLink),
+			UnsubscribeLink:  fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubLink),
 		}); err != nil {
 			log.Printf("[Admin] Error sending email: %s", err)
 		} else {
@@ -155,7 +168,7 @@ func AdminRouter(r chi.Router) {
 
 		var ok bool
 		var err error
-		var verifLink string
+		var verifLink, unsubLink string
 
 		if ok, _ = VerifyAdminSession(validate, dm, w, r); !ok {
 			return
@@ -179,6 +192,11 @@ func AdminRouter(r chi.Router) {
 				w.Write([]byte(err.Error()))
 				return
 			}
+			if unsubLink, err = dm.GenerateMagicLink(user.ULID, constants.LINKMODE_UNSUBSCRIBE); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
 
 			// Send email
 			if err := dm.SendHTMLEmail(&structs.EmailArgs{
@@ -188,7 +206,7 @@ func AdminRouter(r chi.Router) {
 			}, &structs.TemplateData{
 				Name:             user.Username,
 				VerificationLink: fmt.Sprintf("%s/api/v0/verify?token=%s", dm.PublicHostname, verifLink),
-				UnsubscribeLink:  fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, verifLink),
+				UnsubscribeLink:  fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubLink),
 			}); err != nil {
 				log.Printf("[Admin] Error sending hello email to %s: %s", user.Username, err)
 			} else {
@@ -205,6 +223,99 @@ func AdminRouter(r chi.Router) {
 		w.Write([]byte("OK"))
 	})
 
+	// Ban a user, and disconnect them
+	r.Post("/ban", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.BanUser
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		var admin *structs.Client
+		var ok bool
+		if ok, admin = verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		if u.User == admin.ULID {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("You can't ban yourself."))
+			return
+		}
+		if u.Expires != 0 && u.Expires <= time.Now().Unix() {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("The ban expiry must be in the future."))
+			return
+		}
+
+		if err := dm.BanUser(u.User, admin.ULID, u.Reason, u.Expires, u.Appeal); err != nil {
+			if err == errors.ErrUserNotFound {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("[Admin] %s banned user %s: %s", admin.Username, u.User, u.Reason)
+
+		// Drop the user's live connections
+		signaling.DisconnectBannedUser(u.User, &structs.BanNotice{
+			Reason:  u.Reason,
+			Expires: u.Expires,
+			Appeal:  u.Appeal,
+		})
+
+		w.Write([]byte("OK"))
+	})
+
+	// Lift a ban
+	r.Post("/unban", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.UnbanUser
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		var admin *structs.Client
+		var ok bool
+		if ok, admin = verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		if err := dm.UnbanUser(u.User); err != nil {
+			if err == errors.ErrUserNotFound {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("[Admin] %s lifted the ban of user %s", admin.Username, u.User)
+
+		w.Write([]byte("OK"))
+	})
+
+	// Manage user accounts
+	r.Route("/users", func(r chi.Router) { adminUserRoutes(r, validate) })
+
+	// Manage the IP blocklist and allowlist
+	r.Route("/blocklist", func(r chi.Router) { ipListRoutes(r, validate, dm.IPBlocklist) })
+	r.Route("/allowlist", func(r chi.Router) { ipListRoutes(r, validate, dm.IPAllowlist) })
+
 	r.Post("/test_html_email", func(w http.ResponseWriter, r *http.Request) {
 		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
 
@@ -227,3 +338,101 @@ func AdminRouter(r chi.Router) {
 		w.Write([]byte("OK"))
 	})
 }
+
+// ipListRoutes adds the admin endpoints that list, add and remove the entries of an IP list.
+func ipListRoutes(r chi.Router, validate *validator.Validate, list dm.IPList) {
+
+	// List every entry, including expired entries that haven't been deleted yet
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		if ok, _ := VerifyAdminSession(validate, dm, w, r); !ok {
+			return
+		}
+
+		entries, err := dm.GetIPListEntries(list)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	})
+
+	r.Post("/add", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.IPListAdd
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		var admin *structs.Client
+		var ok bool
+		if ok, admin = verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		if u.Expires != 0 && u.Expires <= time.Now().Unix() {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("The expiry must be in the future."))
+			return
+		}
+
+		if err := dm.AddIPListEntry(list, u.Address, u.Reason, u.Expires); err != nil {
+			if err == errors.ErrInvalidIPAddress {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("[Admin] %s added %s to %s", admin.Username, u.Address, list)
+
+		w.Write([]byte("OK"))
+	})
+
+	r.Post("/remove", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.IPListRemove
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		var admin *structs.Client
+		var ok bool
+		if ok, admin = verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		if err := dm.RemoveIPListEntry(list, u.Address); err != nil {
+			switch err {
+			case errors.ErrIPListEntryNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case errors.ErrInvalidIPAddress:
+				w.WriteHeader(http.StatusBadRequest)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("[Admin] %s removed %s from %s", admin.Username, u.Address, list)
+
+		w.Write([]byte("OK"))
+	})
+}
@@ -0,0 +1,313 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	dm "github.com/cloudlink-omega/backend/pkg/data"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	signaling "github.com/cloudlink-omega/backend/pkg/signaling"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+)
+
+// Users per page of search results, unless the admin asks for a different amount.
+const defaultUsersPerPage = 25
+
+// adminUserRoutes adds the admin endpoints that search, view, change and delete user accounts.
+func adminUserRoutes(r chi.Router, validate *validator.Validate) {
+
+	// Search users by username, email address or ID
+	r.Post("/search", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.AdminUserSearch
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		if ok, _ := verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		if u.PerPage == 0 {
+			u.PerPage = defaultUsersPerPage
+		}
+		users, total, err := dm.SearchUsers(u.Query, u.Page*u.PerPage, u.PerPage)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		results := &structs.AdminUserSearchResults{
+			Users:   make([]*structs.AdminUser, len(users)),
+			Total:   total,
+			Page:    u.Page,
+			PerPage: u.PerPage,
+		}
+		for i, user := range users {
+			results.Users[i] = adminUserInfo(user)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	})
+
+	// View a user
+	r.Post("/get", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.AdminUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		if ok, _ := verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		user, ok := getAdminTargetUser(dm, w, u.User)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(adminUserInfo(user))
+	})
+
+	// Set or clear user flags
+	r.Post("/flags", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.AdminUserFlags
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		var admin *structs.Client
+		var ok bool
+		if ok, admin = verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		user, ok := getAdminTargetUser(dm, w, u.User)
+		if !ok {
+			return
+		}
+
+		// Admins can't lock themselves out
+		if isAdmin, ok := u.Flags["admin"]; u.User == admin.ULID && (ok && !isAdmin || u.Flags["blocked"] || u.Flags["banned"]) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("You can't remove your own admin access, or block or ban yourself."))
+			return
+		}
+
+		// Apply every flag except "banned", which has ban details of its own
+		state := user.State
+		for name, value := range u.Flags {
+			bit, ok := constants.UserFlagNames[name]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(fmt.Sprintf("Unknown flag \"%s\".", name)))
+				return
+			}
+			if bit == constants.USER_IS_BANNED {
+				continue
+			}
+			if value {
+				state.Set(bit)
+			} else {
+				state.Clear(bit)
+			}
+		}
+		if state != user.State {
+			if err := dm.UpdateUserState(uint(state), user.ID); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+		}
+
+		// Blocking a user logs them out everywhere
+		if state.Read(constants.USER_IS_BLOCKED) && !user.State.Read(constants.USER_IS_BLOCKED) {
+			if err := dm.RevokeAllSessions(user.ID); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			signaling.DisconnectRevokedSession(user.ID)
+		}
+
+		// Bans set here are permanent and have no details. Use /admin/ban for anything else.
+		if banned, ok := u.Flags["banned"]; ok && banned != user.State.Read(constants.USER_IS_BANNED) {
+			var err error
+			if banned {
+				if err = dm.BanUser(user.ID, admin.ULID, "", 0, ""); err == nil {
+					signaling.DisconnectBannedUser(user.ID, &structs.BanNotice{})
+				}
+			} else {
+				err = dm.UnbanUser(user.ID)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+		}
+		log.Printf("[Admin] %s changed the flags of user %s: %v", admin.Username, user.Username, u.Flags)
+
+		// Reply with the updated user
+		if user, ok = getAdminTargetUser(dm, w, u.User); !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(adminUserInfo(user))
+	})
+
+	// Mark a user's email address as verified, without a verification link
+	r.Post("/verify", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.AdminUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		var admin *structs.Client
+		var ok bool
+		if ok, admin = verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		user, ok := getAdminTargetUser(dm, w, u.User)
+		if !ok {
+			return
+		}
+
+		user.State.Set(constants.USER_IS_ACTIVE)
+		if err := dm.UpdateUserState(uint(user.State), user.ID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Verification links that were already sent are no longer needed
+		if err := dm.DestroyAllMagicLinks(user.ID, constants.LINKMODE_EMAIL); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("[Admin] %s verified the email address of user %s", admin.Username, user.Username)
+
+		w.Write([]byte("OK"))
+	})
+
+	// Delete a user account
+	r.Post("/delete", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.AdminUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		var admin *structs.Client
+		var ok bool
+		if ok, admin = verifyAdminToken(dm, w, u.Token); !ok {
+			return
+		}
+
+		if u.User == admin.ULID {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("You can't delete your own account."))
+			return
+		}
+
+		// Developer accounts must never be left without an owner
+		if owned, err := dm.CountOwnedDevelopers(u.User); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		} else if owned > 0 {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("This user owns developer accounts. Ownership must be transferred before the user can be deleted."))
+			return
+		}
+
+		if err := dm.DeleteUser(u.User); err != nil {
+			if err == errors.ErrUserNotFound {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		signaling.DisconnectRevokedSession(u.User)
+		log.Printf("[Admin] %s deleted user %s", admin.Username, u.User)
+
+		w.Write([]byte("OK"))
+	})
+}
+
+// getAdminTargetUser finds the user an admin request is about, writing an error to the client if the user doesn't exist.
+func getAdminTargetUser(dm *dm.Manager, w http.ResponseWriter, userid string) (*structs.UserQuery, bool) {
+	user, err := dm.GetUserByID(userid)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(err.Error()))
+		return nil, false
+	}
+	return user, true
+}
+
+// adminUserInfo describes a user to an admin, with the state decoded into named flags.
+func adminUserInfo(user *structs.UserQuery) *structs.AdminUser {
+	info := &structs.AdminUser{
+		ID:       user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Created:  user.Created,
+		State:    uint8(user.State),
+		Flags:    make(map[string]bool, len(constants.UserFlagNames)),
+	}
+	for name, bit := range constants.UserFlagNames {
+		info.Flags[name] = user.State.Read(bit)
+	}
+	return info
+}
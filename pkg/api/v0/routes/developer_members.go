@@ -0,0 +1,306 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/cloudlink-omega/backend/pkg/bitfield"
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	dm "github.com/cloudlink-omega/backend/pkg/data"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+)
+
+// developerMemberRoutes adds the endpoints that manage the members of a developer account.
+// Admins can manage viewers and editors, and only the owner can manage admins or transfer ownership.
+// Every endpoint needs a session token in the Authorization header.
+func developerMemberRoutes(r chi.Router, validate *validator.Validate) {
+
+	// List members and pending invitations
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		_, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_VIEWER)
+		if !ok {
+			return
+		}
+
+		members, err := dm.GetDeveloperMembers(developer.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		infos := make([]*structs.DeveloperMember, len(members))
+		for i, member := range members {
+			infos[i] = developerMemberInfo(member)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+	})
+
+	// Invite a user by email address
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		// Invitations can only be accepted using the link in the email
+		if !dm.EnableEmail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Email is disabled on this server. Invitations can't be sent."))
+			return
+		}
+
+		user, developer, member, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_ADMIN)
+		if !ok {
+			return
+		}
+
+		var u structs.DeveloperInvite
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		role, _ := constants.ParseDeveloperRole(u.Role)
+		if !canManageDeveloperRole(w, member, role) {
+			return
+		}
+
+		invitee, err := dm.GetUserByEmail(u.Email)
+		if err != nil {
+			if err == errors.ErrUserNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("There is no user with this email address. Ask them to sign up first."))
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+			}
+			return
+		}
+		if invitee.State.Read(constants.USER_IS_EMAIL_DISABLED) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("This user can't receive emails, so they can't be invited."))
+			return
+		}
+
+		if _, err := dm.GetDeveloperMember(developer.ID, invitee.ID); err == nil {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("This user is already a member of this developer account, or has already been invited."))
+			return
+		} else if err != errors.ErrDeveloperMemberNotFound {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		var state bitfield.Bitfield8
+		state.Set(constants.DEVMEMBER_IS_INVITED)
+		constants.SetDeveloperRole(&state, role)
+		if err := dm.AddDeveloperMember(developer.ID, invitee.ID, state); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s invited %s to the developer account \"%s\" (%s) as %s", user.Username, invitee.Username, developer.Name, developer.ID, developerRoleArticle(role))
+
+		go sendDeveloperInviteEmail(dm, user, invitee, developer, role)
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("OK"))
+	})
+
+	// Change the role of a member or invitation
+	r.Put("/{user}", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, member, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_ADMIN)
+		if !ok {
+			return
+		}
+
+		var u structs.DeveloperMemberRole
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		target, ok := getDeveloperMember(dm, w, developer.ID, chi.URLParam(r, "user"))
+		if !ok {
+			return
+		}
+		role, _ := constants.ParseDeveloperRole(u.Role)
+		if !canManageDeveloperRole(w, member, constants.DeveloperRole(target.State)) || !canManageDeveloperRole(w, member, role) {
+			return
+		}
+
+		state := target.State
+		constants.SetDeveloperRole(&state, role)
+		if err := dm.UpdateDeveloperMemberState(developer.ID, target.UserID, state); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s made %s %s of the developer account \"%s\" (%s)", user.Username, target.Username, developerRoleArticle(role), developer.Name, developer.ID)
+
+		target.State = state
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(developerMemberInfo(target))
+	})
+
+	// Remove a member or withdraw an invitation. Members can also remove themselves, except for the owner.
+	r.Delete("/{user}", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, member, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_VIEWER)
+		if !ok {
+			return
+		}
+
+		target, ok := getDeveloperMember(dm, w, developer.ID, chi.URLParam(r, "user"))
+		if !ok {
+			return
+		}
+		if target.State.Read(constants.DEVMEMBER_IS_OWNER) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("The owner can't be removed. Transfer ownership to another member first."))
+			return
+		}
+		if target.UserID != user.ULID && !canManageDeveloperRole(w, member, constants.DeveloperRole(target.State)) {
+			return
+		}
+
+		if err := dm.RemoveDeveloperMember(developer.ID, target.UserID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s removed %s from the developer account \"%s\" (%s)", user.Username, target.Username, developer.Name, developer.ID)
+
+		w.Write([]byte("OK"))
+	})
+
+	// Transfer ownership to another active member. The previous owner becomes an admin.
+	r.Post("/{user}/owner", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, member, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_OWNER)
+		if !ok {
+			return
+		}
+
+		target, ok := getDeveloperMember(dm, w, developer.ID, chi.URLParam(r, "user"))
+		if !ok {
+			return
+		}
+		if target.UserID == user.ULID {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("You already own this developer account."))
+			return
+		}
+		if !target.State.Read(constants.DEVMEMBER_IS_ACTIVE) || target.State.Read(constants.DEVMEMBER_IS_INVITED) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("Ownership can only be transferred to a member who has accepted their invitation."))
+			return
+		}
+
+		// The new owner must be able to use their account
+		if _, err := dm.CheckUserStanding(target.UserID); err == errors.ErrUserBlocked || err == errors.ErrUserBanned {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("Ownership can't be transferred to a blocked or banned user."))
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		if err := dm.TransferDeveloperOwnership(developer.ID, member, target); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s transferred ownership of the developer account \"%s\" (%s) to %s", user.Username, developer.Name, developer.ID, target.Username)
+
+		w.Write([]byte("OK"))
+	})
+}
+
+// canManageDeveloperRole checks that a member may give, change or remove the given role. Members can only manage
+// roles below their own, so admins manage viewers and editors, and the owner also manages admins.
+// Errors are written to the client.
+func canManageDeveloperRole(w http.ResponseWriter, member *structs.DeveloperMemberQuery, role uint8) bool {
+	if role >= constants.DeveloperRole(member.State) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(fmt.Sprintf("You can't manage members who are %s.", constants.DeveloperRoleNames[role]+"s")))
+		return false
+	}
+	return true
+}
+
+// getDeveloperMember finds a member of a developer account, writing an error to the client if they aren't a member.
+func getDeveloperMember(dm *dm.Manager, w http.ResponseWriter, developerid string, userid string) (*structs.DeveloperMemberQuery, bool) {
+	member, err := dm.GetDeveloperMember(developerid, userid)
+	if err != nil {
+		if err == errors.ErrDeveloperMemberNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(err.Error()))
+		return nil, false
+	}
+	return member, true
+}
+
+// developerMemberInfo describes a member of a developer account, with the state decoded into a role.
+func developerMemberInfo(member *structs.DeveloperMemberQuery) *structs.DeveloperMember {
+	return &structs.DeveloperMember{
+		ID:       member.UserID,
+		Username: member.Username,
+		Role:     constants.DeveloperRoleNames[constants.DeveloperRole(member.State)],
+		Invited:  member.State.Read(constants.DEVMEMBER_IS_INVITED),
+	}
+}
+
+// sendDeveloperInviteEmail sends an invitation to join a developer account, with a link to accept it.
+func sendDeveloperInviteEmail(dm *dm.Manager, inviter *structs.Client, invitee *structs.UserQuery, developer *structs.DeveloperQuery, role uint8) {
+	link, err := dm.GenerateMagicLinkFor(invitee.ID, constants.LINKMODE_INVITE, developer.ID)
+	if err != nil {
+		log.Printf("Error generating developer invite link: %s", err)
+		return
+	}
+	unsubscribeLink, err := dm.GenerateMagicLink(invitee.ID, constants.LINKMODE_UNSUBSCRIBE)
+	if err != nil {
+		log.Printf("Error generating unsubscribe link: %s", err)
+		return
+	}
+
+	if err := dm.SendHTMLEmail(&structs.EmailArgs{
+		Subject:  fmt.Sprintf("You've been invited to join %s", developer.Name),
+		To:       invitee.Email,
+		Template: "developer_invite",
+	}, &structs.TemplateData{
+		Name:            invitee.Username,
+		Inviter:         inviter.Username,
+		DeveloperName:   developer.Name,
+		Role:            developerRoleArticle(role),
+		InviteLink:      fmt.Sprintf("%s/accept_invite.html?token=%s&developer=%s", dm.PublicHostname, link, developer.ID),
+		UnsubscribeLink: fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubscribeLink),
+	}); err != nil {
+		log.Printf("Error sending developer invite email: %s", err)
+	}
+}
@@ -0,0 +1,471 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	dm "github.com/cloudlink-omega/backend/pkg/data"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+// Developer accounts. Users apply for a developer account, and an admin approves or denies it using a link sent by email.
+// Members of an approved developer account can then invite others and manage its games.
+func DevelopersRouter(r chi.Router) {
+	var validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// Register custom label function for validator
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("label")
+	})
+
+	// Developer accounts need user accounts
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+			if dm.AuthlessMode {
+				w.WriteHeader(http.StatusGone)
+				w.Write([]byte("Authless mode is enabled on this server. Developer accounts are not available."))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// Apply for a developer account
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.DeveloperApplication
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, ok := verifySessionToken(dm, w, u.Token)
+		if !ok {
+			return
+		}
+		if !checkUserStanding(dm, w, user.ULID) {
+			return
+		}
+
+		// Admins need a way to contact the applicant
+		if !user.UserState.Read(constants.USER_IS_ACTIVE) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Please verify your email address before applying for a developer account."))
+			return
+		}
+
+		// One application at a time
+		if pending, err := dm.CountPendingDevelopers(user.ULID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		} else if pending > 0 {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("You already have a developer account awaiting review."))
+			return
+		}
+
+		id, err := dm.CreateDeveloper(user.ULID, u.Name, u.Description)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s applied for a developer account called \"%s\" (%s)", user.Username, u.Name, id)
+
+		go sendDeveloperApplicationEmails(dm, user, id, &u)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&structs.DeveloperCreated{ID: id})
+	})
+
+	// Review links show a confirmation page first, so that opening the link doesn't approve or deny anything
+	r.Get("/review", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/review_developer.html?"+r.URL.RawQuery, http.StatusSeeOther)
+	})
+
+	// Approve or deny a developer account using a magic link sent to an admin
+	r.Post("/review", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.DeveloperReview
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		admin, mode, err := dm.VerifyMagicToken(u.Token)
+		if err != nil {
+			switch err {
+			case errors.ErrLinkNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case errors.ErrLinkExpired:
+				w.WriteHeader(http.StatusGone)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Verify mode
+		if mode != constants.LINKMODE_DEVELOPER {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("This token is not a valid developer review token."))
+			return
+		}
+
+		// Each link can only review the developer account it was sent for
+		if subject, err := dm.GetMagicLinkSubject(u.Token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		} else if subject != u.Developer {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("This token was not sent to review this developer account."))
+			return
+		}
+
+		// The link may have been sent before the user stopped being an admin
+		if !admin.UserState.Read(constants.USER_IS_ADMIN) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("You don't have permission to perform this action."))
+			return
+		}
+
+		developer, err := dm.GetDeveloper(u.Developer)
+		if err == errors.ErrDeveloperNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("This developer account doesn't exist. Another admin may have denied it already."))
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if developer.State.Read(constants.DEVELOPER_IS_VERIFIED) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("This developer account has already been approved."))
+			return
+		}
+
+		owner, err := dm.GetDeveloperOwner(developer.ID)
+		if err != nil && err != errors.ErrUserNotFound {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		outcome := "approved"
+		if u.Action == "approve" {
+			developer.State.Set(constants.DEVELOPER_IS_ACTIVE)
+			developer.State.Set(constants.DEVELOPER_IS_VERIFIED)
+			err = dm.UpdateDeveloperState(developer.ID, developer.State)
+		} else {
+			outcome = "denied"
+			err = dm.DeleteDeveloper(developer.ID)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("[Admin] %s %s the developer account \"%s\" (%s)", admin.Username, outcome, developer.Name, developer.ID)
+
+		// Delete magic link
+		if err := dm.DestroyMagicLink(u.Token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Let the applicant know
+		if owner != nil {
+			go sendDeveloperOutcomeEmail(dm, owner, developer, u.Action == "approve")
+		}
+
+		w.Write([]byte(fmt.Sprintf("Hello %s, the developer account \"%s\" has been %s.", admin.Username, developer.Name, outcome)))
+	})
+
+	// Invite links show a confirmation page first, so that opening the link doesn't join anything
+	r.Get("/invite", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/accept_invite.html?"+r.URL.RawQuery, http.StatusSeeOther)
+	})
+
+	// Accept an invitation to join a developer account using a magic link sent to the invitee
+	r.Post("/invite", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.DeveloperInviteAccept
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, mode, err := dm.VerifyMagicToken(u.Token)
+		if err != nil {
+			switch err {
+			case errors.ErrLinkNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case errors.ErrLinkExpired:
+				w.WriteHeader(http.StatusGone)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Verify mode
+		if mode != constants.LINKMODE_INVITE {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("This token is not a valid developer invite token."))
+			return
+		}
+
+		// Each link can only join the developer account it was sent for
+		if subject, err := dm.GetMagicLinkSubject(u.Token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		} else if subject != u.Developer {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("This token was not sent to join this developer account."))
+			return
+		}
+		if !checkUserStanding(dm, w, user.ULID) {
+			return
+		}
+
+		developer, err := dm.GetDeveloper(u.Developer)
+		if err != nil {
+			if err == errors.ErrDeveloperNotFound {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// The invitation may have been withdrawn since the email was sent
+		member, err := dm.GetDeveloperMember(developer.ID, user.ULID)
+		if err == errors.ErrDeveloperMemberNotFound || err == nil && !member.State.Read(constants.DEVMEMBER_IS_INVITED) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("This invitation has been withdrawn or already accepted."))
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		member.State.Clear(constants.DEVMEMBER_IS_INVITED)
+		member.State.Set(constants.DEVMEMBER_IS_ACTIVE)
+		if err := dm.UpdateDeveloperMemberState(developer.ID, user.ULID, member.State); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s joined the developer account \"%s\" (%s)", user.Username, developer.Name, developer.ID)
+
+		// Delete magic link
+		if err := dm.DestroyMagicLink(u.Token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Write([]byte(fmt.Sprintf("Welcome to \"%s\", %s! You have joined as %s.", developer.Name, user.Username, developerRoleArticle(constants.DeveloperRole(member.State)))))
+	})
+
+	// Members of a developer account
+	r.Route("/{developer}/members", func(r chi.Router) {
+		developerMemberRoutes(r, validate)
+	})
+
+	// Games of a developer account
+	r.Route("/{developer}/games", func(r chi.Router) {
+		developerGameRoutes(r, validate)
+	})
+}
+
+// developerAccess checks that the session in the Authorization header belongs to an active member of the developer
+// account in the URL with at least the given role, and that the developer account is active and verified.
+// Errors are written to the client.
+func developerAccess(dm *dm.Manager, validate *validator.Validate, w http.ResponseWriter, r *http.Request, role uint8) (*structs.Client, *structs.DeveloperQuery, *structs.DeveloperMemberQuery, bool) {
+	token, ok := bearerSessionToken(validate, w, r)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	user, ok := verifySessionToken(dm, w, token)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	if !checkUserStanding(dm, w, user.ULID) {
+		return nil, nil, nil, false
+	}
+
+	developer, err := dm.GetDeveloper(chi.URLParam(r, "developer"))
+	if err != nil {
+		if err == errors.ErrDeveloperNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(err.Error()))
+		return nil, nil, nil, false
+	}
+
+	member, err := dm.GetDeveloperMember(developer.ID, user.ULID)
+	if err != nil && err != errors.ErrDeveloperMemberNotFound {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return nil, nil, nil, false
+	}
+	if member == nil || !member.State.Read(constants.DEVMEMBER_IS_ACTIVE) || member.State.Read(constants.DEVMEMBER_IS_INVITED) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("You aren't a member of this developer account."))
+		return nil, nil, nil, false
+	}
+	if constants.DeveloperRole(member.State) < role {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(fmt.Sprintf("You need to be at least %s of this developer account to do this.", developerRoleArticle(role))))
+		return nil, nil, nil, false
+	}
+
+	if !developer.State.Read(constants.DEVELOPER_IS_ACTIVE) || !developer.State.Read(constants.DEVELOPER_IS_VERIFIED) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("This developer account hasn't been approved, or has been deactivated."))
+		return nil, nil, nil, false
+	}
+	return user, developer, member, true
+}
+
+// developerRoleArticle names a developer member role with its article, such as "an editor".
+func developerRoleArticle(role uint8) string {
+	name := constants.DeveloperRoleNames[role]
+	if strings.ContainsRune("aeiou", rune(name[0])) {
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// sendDeveloperApplicationEmails tells the applicant that their developer account is awaiting review,
+// and asks every admin to approve or deny it.
+func sendDeveloperApplicationEmails(dm *dm.Manager, user *structs.Client, developerid string, application *structs.DeveloperApplication) {
+	if !dm.EnableEmail {
+		log.Printf("Email is disabled, so nobody was asked to review the developer account \"%s\" (%s)", application.Name, developerid)
+		return
+	}
+
+	// Respect users who can't receive emails
+	if user.UserState.Read(constants.USER_IS_EMAIL_DISABLED) {
+		log.Printf("Not sending developer pending email to %s: Emails are disabled for this user", user.Username)
+	} else if unsubscribeLink, err := dm.GenerateMagicLink(user.ULID, constants.LINKMODE_UNSUBSCRIBE); err != nil {
+		log.Printf("Error generating unsubscribe link: %s", err)
+	} else if err := dm.SendHTMLEmail(&structs.EmailArgs{
+		Subject:  "Your developer account is awaiting review",
+		To:       user.Email,
+		Template: "developer_pending",
+	}, &structs.TemplateData{
+		Name:            user.Username,
+		DeveloperName:   application.Name,
+		UnsubscribeLink: fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubscribeLink),
+	}); err != nil {
+		log.Printf("Error sending developer pending email: %s", err)
+	}
+
+	admins, err := dm.GetAdmins()
+	if err != nil {
+		log.Printf("[Admin] Error finding admins to review developer account %s: %s", developerid, err)
+		return
+	}
+	for _, admin := range admins {
+		if admin.State.Read(constants.USER_IS_EMAIL_DISABLED) {
+			continue
+		}
+
+		link, err := dm.GenerateMagicLinkFor(admin.ID, constants.LINKMODE_DEVELOPER, developerid)
+		if err != nil {
+			log.Printf("[Admin] Error generating developer review link: %s", err)
+			continue
+		}
+		review := fmt.Sprintf("%s/review_developer.html?token=%s&developer=%s", dm.PublicHostname, link, developerid)
+
+		if err := dm.SendHTMLEmail(&structs.EmailArgs{
+			Subject:  "New developer registration request",
+			To:       admin.Email,
+			Template: "developer_admin_request",
+		}, &structs.TemplateData{
+			Name:                 admin.Username,
+			DeveloperOwner:       fmt.Sprintf("%s (%s)", user.Username, user.Email),
+			DeveloperName:        application.Name,
+			DeveloperDescription: application.Description,
+			ApproveLink:          review + "&action=approve",
+			DenyLink:             review + "&action=deny",
+		}); err != nil {
+			log.Printf("[Admin] Error sending developer review email to %s: %s", admin.Username, err)
+		}
+	}
+}
+
+// sendDeveloperOutcomeEmail tells the applicant whether their developer account was approved or denied.
+func sendDeveloperOutcomeEmail(dm *dm.Manager, owner *structs.UserQuery, developer *structs.DeveloperQuery, approved bool) {
+	if !dm.EnableEmail {
+		return
+	}
+
+	// Respect users who can't receive emails
+	if owner.State.Read(constants.USER_IS_EMAIL_DISABLED) {
+		log.Printf("Not sending developer review email to %s: Emails are disabled for this user", owner.Username)
+		return
+	}
+
+	unsubscribeLink, err := dm.GenerateMagicLink(owner.ID, constants.LINKMODE_UNSUBSCRIBE)
+	if err != nil {
+		log.Printf("Error generating unsubscribe link: %s", err)
+		return
+	}
+
+	args := &structs.EmailArgs{
+		Subject:  "Your developer account has been approved",
+		To:       owner.Email,
+		Template: "developer_approved",
+	}
+	if !approved {
+		args.Subject = "Your developer account has been denied"
+		args.Template = "developer_denied"
+	}
+	if err := dm.SendHTMLEmail(args, &structs.TemplateData{
+		Name:            owner.Username,
+		DeveloperName:   developer.Name,
+		UnsubscribeLink: fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubscribeLink),
+	}); err != nil {
+		log.Printf("Error sending developer review email: %s", err)
+	}
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	dm "github.com/cloudlink-omega/backend/pkg/data"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	signaling "github.com/cloudlink-omega/backend/pkg/signaling"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+)
+
+// Server-to-server endpoints for games. Every endpoint needs a game API key in the Authorization header,
+// and only works with the game the key belongs to.
+func GameAPIRouter(r chi.Router) {
+
+	// Game API keys need developer accounts
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+			if dm.AuthlessMode {
+				w.WriteHeader(http.StatusGone)
+				w.Write([]byte("Authless mode is enabled on this server. Game API keys are not available."))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Use(GameAPIKeyAuth)
+
+	// List the lobbies of the game
+	r.With(RequireAPIKeyScope(constants.APIKEY_CAN_READ_LOBBIES)).Get("/lobbies", func(w http.ResponseWriter, r *http.Request) {
+		apikey := r.Context().Value(constants.GameAPIKeyCtx).(*structs.GameAPIKeyQuery)
+
+		lobbies := []*structs.GameLobby{}
+		for _, name := range signaling.Manager.GetAllLobbiesByUGI(apikey.GameID) {
+			config := signaling.Manager.GetLobbyConfigStorage(apikey.GameID, name)
+			if config == nil {
+				continue
+			}
+			lobbies = append(lobbies, &structs.GameLobby{
+				ID:           config.ID,
+				HostID:       config.CurrentOwnerULID,
+				HostUsername: config.CurrentOwnerUsername,
+				CurrentPeers: len(signaling.Manager.GetPeerClientsByUGIAndLobby(apikey.GameID, name)),
+				MaximumPeers: config.MaximumPeers,
+				Public:       config.IsPublic,
+				Locked:       config.Locked,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(lobbies)
+	})
+}
+
+// GameAPIKeyAuth is a middleware that accepts a game API key as a Bearer credential. The key is stored in the request
+// context (see constants.GameAPIKeyCtx). Keys of inactive games, or of games of inactive developers, are refused.
+func GameAPIKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		key, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Missing API key."))
+			return
+		}
+
+		apikey, err := dm.VerifyGameAPIKey(key)
+		if err != nil {
+			if err == errors.ErrAPIKeyInvalid {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				w.WriteHeader(http.StatusUnauthorized)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		if _, ok := verifyGame(dm, w, apikey.GameID); !ok {
+			return
+		}
+		log.Printf("API key %s of UGI %s used for %s %s", apikey.ID, apikey.GameID, r.Method, r.URL.Path)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), constants.GameAPIKeyCtx, apikey)))
+	})
+}
+
+// RequireAPIKeyScope is a middleware that refuses game API keys without the given scope. Use it after GameAPIKeyAuth.
+func RequireAPIKeyScope(scope uint) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apikey := r.Context().Value(constants.GameAPIKeyCtx).(*structs.GameAPIKeyQuery)
+			if !apikey.Scopes.Read(scope) {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(fmt.Sprintf("This API key doesn't have the %s scope.", apiKeyScopeName(scope))))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKeyScopeName finds the name of a game API key scope.
+func apiKeyScopeName(scope uint) string {
+	for name, bit := range constants.APIKeyScopeNames {
+		if bit == scope {
+			return name
+		}
+	}
+	return fmt.Sprint(scope)
+}
@@ -0,0 +1,442 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/cloudlink-omega/backend/pkg/bitfield"
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	dm "github.com/cloudlink-omega/backend/pkg/data"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	utils "github.com/cloudlink-omega/backend/pkg/utils"
+)
+
+// developerGameRoutes adds the endpoints that let members of a developer account manage its games and their authorized origins.
+// Every endpoint needs a session token in the Authorization header.
+func developerGameRoutes(r chi.Router, validate *validator.Validate) {
+
+	// List games
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		_, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_VIEWER)
+		if !ok {
+			return
+		}
+
+		games, err := dm.GetGames(developer.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		infos := make([]*structs.GameInfo, len(games))
+		for i, game := range games {
+			infos[i] = gameInfo(game)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+	})
+
+	// Create a game
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_EDITOR)
+		if !ok {
+			return
+		}
+
+		var u structs.GameCreate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		id, err := dm.CreateGame(developer.ID, u.Name)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s created the game \"%s\" (%s) for developer %s", user.Username, u.Name, id, developer.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&structs.GameCreated{ID: id})
+	})
+
+	// View a game
+	r.Get("/{game}", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		_, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_VIEWER)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gameInfo(game))
+	})
+
+	// Rename a game, or set or clear its flags
+	r.Put("/{game}", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, member, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_EDITOR)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		var u structs.GameUpdate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		// Activating and deactivating games is left to developer admins
+		if _, ok := u.Flags["active"]; ok && constants.DeveloperRole(member.State) < constants.DEVROLE_ADMIN {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(fmt.Sprintf("You need to be at least %s of this developer account to activate or deactivate games.", developerRoleArticle(constants.DEVROLE_ADMIN))))
+			return
+		}
+
+		// Verification is left to admins, so it isn't in GameFlagNames
+		state := game.State
+		for name, value := range u.Flags {
+			bit, ok := constants.GameFlagNames[name]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(fmt.Sprintf("Unknown flag \"%s\".", name)))
+				return
+			}
+			if value {
+				state.Set(bit)
+			} else {
+				state.Clear(bit)
+			}
+		}
+		name := game.Name
+		if u.Name != "" {
+			name = u.Name
+		}
+
+		if err := dm.UpdateGame(game.ID, name, state); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s changed the game \"%s\" (%s): name \"%s\", flags %v", user.Username, game.Name, game.ID, name, u.Flags)
+
+		game.Name = name
+		game.State = state
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gameInfo(game))
+	})
+
+	// Deactivate a game. Games aren't deleted, so that their saves are kept and their UGI can't be reused.
+	r.Delete("/{game}", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_ADMIN)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		game.State.Clear(constants.GAME_IS_ACTIVE)
+		if err := dm.UpdateGame(game.ID, game.Name, game.State); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s deactivated the game \"%s\" (%s)", user.Username, game.Name, game.ID)
+
+		w.Write([]byte("OK"))
+	})
+
+	// List the authorized origins of a game
+	r.Get("/{game}/origins", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		_, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_VIEWER)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		origins, err := dm.GetAuthorizedOrigins(game.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(origins)
+	})
+
+	// Authorize an origin
+	r.Post("/{game}/origins", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_EDITOR)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		var u structs.GameOrigin
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		origin := normalizeOrigin(u.Origin)
+		if !utils.ValidOriginPattern(origin) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid origin. Use a hostname such as example.com or *.example.com, optionally with a scheme and port."))
+			return
+		}
+
+		if err := dm.AddAuthorizedOrigin(game.ID, origin); err != nil {
+			if err == errors.ErrOriginExists {
+				w.WriteHeader(http.StatusConflict)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s authorized the origin %s for the game \"%s\" (%s)", user.Username, origin, game.Name, game.ID)
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("OK"))
+	})
+
+	// Remove an authorized origin, given by the origin query parameter
+	r.Delete("/{game}/origins", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_EDITOR)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		origin := normalizeOrigin(r.URL.Query().Get("origin"))
+		if err := dm.RemoveAuthorizedOrigin(game.ID, origin); err != nil {
+			if err == errors.ErrOriginNotFound {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s removed the origin %s from the game \"%s\" (%s)", user.Username, origin, game.Name, game.ID)
+
+		w.Write([]byte("OK"))
+	})
+
+	// List the API keys of a game
+	r.Get("/{game}/keys", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		_, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_EDITOR)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		apikeys, err := dm.GetGameAPIKeys(game.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		infos := make([]*structs.GameAPIKey, len(apikeys))
+		for i, apikey := range apikeys {
+			infos[i] = gameAPIKeyInfo(apikey)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+	})
+
+	// Create an API key. The key is only shown in this response.
+	r.Post("/{game}/keys", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_ADMIN)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		var u structs.GameAPIKeyCreate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		var scopes bitfield.Bitfield8
+		for _, name := range u.Scopes {
+			bit, ok := constants.APIKeyScopeNames[name]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(fmt.Sprintf("Unknown scope \"%s\".", name)))
+				return
+			}
+			scopes.Set(bit)
+		}
+
+		key, apikey, err := dm.CreateGameAPIKey(game.ID, u.Name, scopes)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s created the API key \"%s\" (%s) for the game \"%s\" (%s) with scopes %v", user.Username, u.Name, apikey.ID, game.Name, game.ID, u.Scopes)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&structs.GameAPIKeyCreated{
+			GameAPIKey: *gameAPIKeyInfo(apikey),
+			Key:        key,
+		})
+	})
+
+	// Revoke an API key
+	r.Delete("/{game}/keys/{key}", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		user, developer, _, ok := developerAccess(dm, validate, w, r, constants.DEVROLE_ADMIN)
+		if !ok {
+			return
+		}
+		game, ok := getDeveloperGame(dm, w, developer.ID, chi.URLParam(r, "game"))
+		if !ok {
+			return
+		}
+
+		keyid := chi.URLParam(r, "key")
+		if err := dm.RevokeGameAPIKey(game.ID, keyid); err != nil {
+			if err == errors.ErrAPIKeyNotFound {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Printf("%s revoked the API key %s of the game \"%s\" (%s)", user.Username, keyid, game.Name, game.ID)
+
+		w.Write([]byte("OK"))
+	})
+}
+
+// getDeveloperGame finds a game of a developer account, writing an error to the client if it doesn't exist.
+func getDeveloperGame(dm *dm.Manager, w http.ResponseWriter, developerid string, gameid string) (*structs.GameQuery, bool) {
+	game, err := dm.GetGame(developerid, gameid)
+	if err != nil {
+		if err == errors.ErrGameNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(err.Error()))
+		return nil, false
+	}
+	return game, true
+}
+
+// gameInfo describes a game to its developer, with the state decoded into named flags.
+func gameInfo(game *structs.GameQuery) *structs.GameInfo {
+	info := &structs.GameInfo{
+		ID:       game.ID,
+		Name:     game.Name,
+		Created:  game.Created,
+		State:    uint8(game.State),
+		Verified: game.State.Read(constants.GAME_IS_VERIFIED),
+		Flags:    make(map[string]bool, len(constants.GameFlagNames)),
+	}
+	for name, bit := range constants.GameFlagNames {
+		info.Flags[name] = game.State.Read(bit)
+	}
+	return info
+}
+
+// normalizeOrigin stores origin patterns the same way OriginAllowed reads them, so that duplicates can be found.
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// gameAPIKeyInfo describes a game API key to its developer, with the scopes decoded into names.
+func gameAPIKeyInfo(apikey *structs.GameAPIKeyQuery) *structs.GameAPIKey {
+	info := &structs.GameAPIKey{
+		ID:       apikey.ID,
+		Name:     apikey.Name,
+		Scopes:   []string{},
+		Created:  apikey.Created,
+		LastUsed: apikey.LastUsed,
+	}
+	for name, bit := range constants.APIKeyScopeNames {
+		if apikey.Scopes.Read(bit) {
+			info.Scopes = append(info.Scopes, name)
+		}
+	}
+	sort.Strings(info.Scopes)
+	return info
+}
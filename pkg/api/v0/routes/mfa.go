@@ -0,0 +1,622 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	accounts "github.com/cloudlink-omega/backend/pkg/accounts"
+	"github.com/cloudlink-omega/backend/pkg/bitfield"
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	dm "github.com/cloudlink-omega/backend/pkg/data"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	utils "github.com/cloudlink-omega/backend/pkg/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+// How many recovery codes are generated each time two-factor authentication is enabled
+const recoveryCodeCount = 10
+
+// Two-factor authentication methods, as listed in login challenges
+const (
+	mfaMethodTOTP     = "totp"
+	mfaMethodEmail    = "email"
+	mfaMethodRecovery = "recovery"
+)
+
+func MFARouter(r chi.Router) {
+	var validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// Register custom label function for validator
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("label")
+	})
+
+	// Two-factor authentication needs accounts
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+			if dm.AuthlessMode {
+				w.WriteHeader(http.StatusGone)
+				w.Write([]byte("Authless mode is enabled on this server. Two-factor authentication is not available."))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// Start TOTP enrollment by generating a new secret. The secret is not used until it is confirmed. Requires the account password.
+	r.Post("/totp/enroll", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.MFAPassword
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, ok := verifySessionToken(dm, w, u.Token)
+		if !ok || !verifyAccountPassword(dm, w, user, u.Password) {
+			return
+		}
+
+		// Don't replace a secret that is already in use
+		if totp, err := dm.GetTOTP(user.ULID); err == nil && totp.State.Read(constants.TOTP_IS_ENABLED) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("An authenticator app is already set up for this account. Disable it first to set up a new one."))
+			return
+		} else if err != nil && err != errors.ErrTOTPNotFound {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		secret, err := accounts.GenerateTOTPSecret()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if err := dm.SetTOTPSecret(user.ULID, secret); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&structs.TOTPEnrollment{
+			Secret: secret,
+			URI:    accounts.TOTPURI(fmt.Sprintf("CloudLink Omega (%s)", dm.ServerNickname), user.Email, secret),
+		})
+	})
+
+	// Finish TOTP enrollment using the first code from the authenticator app. Requires the account password.
+	// Returns a new set of recovery codes.
+	r.Post("/totp/confirm", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.MFACode
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, ok := verifySessionToken(dm, w, u.Token)
+		if !ok || !verifyAccountPassword(dm, w, user, u.Password) {
+			return
+		}
+
+		totp, err := dm.GetTOTP(user.ULID)
+		if err != nil {
+			switch err {
+			case errors.ErrTOTPNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if totp.State.Read(constants.TOTP_IS_ENABLED) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("An authenticator app is already set up for this account."))
+			return
+		}
+
+		step, valid := accounts.ValidateTOTP(totp.Secret, u.Code, totp.LastStep)
+		if !valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Invalid code. Make sure the time on your device is correct and try again."))
+			return
+		}
+		if err := dm.EnableTOTP(user.ULID, step); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		issueRecoveryCodes(dm, w, user.ULID)
+	})
+
+	// Disable TOTP. Requires the account password.
+	r.Post("/totp/disable", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.MFAPassword
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, ok := verifySessionToken(dm, w, u.Token)
+		if !ok || !verifyAccountPassword(dm, w, user, u.Password) {
+			return
+		}
+
+		if err := dm.DeleteTOTP(user.ULID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Recovery codes are useless without another method
+		if !user.UserState.Read(constants.USER_USES_EMAIL_2FA) {
+			if err := dm.DeleteRecoveryCodes(user.ULID); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+		}
+
+		w.Write([]byte("OK"))
+	})
+
+	// Enable emailed security codes, for users without an authenticator app. Requires the account password.
+	// Returns a new set of recovery codes.
+	r.Post("/email/enable", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		if !dm.EnableEmail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Email is not enabled on this server. Emailed security codes are not available."))
+			return
+		}
+
+		var u structs.MFAPassword
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, ok := verifySessionToken(dm, w, u.Token)
+		if !ok || !verifyAccountPassword(dm, w, user, u.Password) {
+			return
+		}
+
+		// The user must be able to receive emails, or they would be locked out
+		if !user.UserState.Read(constants.USER_IS_ACTIVE) || user.UserState.Read(constants.USER_IS_EMAIL_DISABLED) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Please verify your email address before enabling emailed security codes."))
+			return
+		}
+		if user.UserState.Read(constants.USER_USES_EMAIL_2FA) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("Emailed security codes are already enabled for this account."))
+			return
+		}
+
+		user.UserState.Set(constants.USER_USES_EMAIL_2FA)
+		if err := dm.UpdateUserState(uint(user.UserState), user.ULID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		issueRecoveryCodes(dm, w, user.ULID)
+	})
+
+	// Disable emailed security codes. Requires the account password.
+	r.Post("/email/disable", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.MFAPassword
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, ok := verifySessionToken(dm, w, u.Token)
+		if !ok || !verifyAccountPassword(dm, w, user, u.Password) {
+			return
+		}
+
+		user.UserState.Clear(constants.USER_USES_EMAIL_2FA)
+		if err := dm.UpdateUserState(uint(user.UserState), user.ULID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Recovery codes are useless without another method
+		if _, err := dm.GetTOTP(user.ULID); err == errors.ErrTOTPNotFound {
+			if err := dm.DeleteRecoveryCodes(user.ULID); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Write([]byte("OK"))
+	})
+
+	// Replace all recovery codes with a new set. Requires the account password.
+	r.Post("/recovery_codes", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.MFAPassword
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, ok := verifySessionToken(dm, w, u.Token)
+		if !ok || !verifyAccountPassword(dm, w, user, u.Password) {
+			return
+		}
+
+		methods, _, err := mfaMethods(dm, user.ULID, user.UserState)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if len(methods) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Two-factor authentication is not enabled for this account."))
+			return
+		}
+
+		issueRecoveryCodes(dm, w, user.ULID)
+	})
+
+	// Complete a login challenge (see /login) using a TOTP code, an emailed security code, or a recovery code.
+	// Returns a session token.
+	r.Post("/challenge", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.MFAChallenge
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		challenge, ok := getLoginChallenge(dm, w, u.Challenge)
+		if !ok {
+			return
+		}
+
+		// Wrong codes count as failed logins to the account, since every login with the password gets a new challenge
+		user, err := dm.GetUserByID(challenge.UserID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		address := utils.RemoteIP(r)
+		if !checkLoginThrottle(dm, w, user.Email, address) {
+			return
+		}
+
+		// Count every guess, so that codes can't be brute forced
+		if ok, err := dm.CountLoginChallengeAttempt(challenge.ID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		} else if !ok {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("Too many attempts. Please log in again."))
+			return
+		}
+
+		valid, err := verifySecondFactor(dm, challenge, u.Code)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if !valid {
+			locked, err := dm.RecordLoginFailure(user.Email, address)
+			if err != nil {
+				log.Printf("Error recording failed login: %s", err)
+			} else if locked {
+				go sendLockoutAlert(dm, user, address)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Invalid code."))
+			return
+		}
+
+		// Refuse accounts that were blocked or banned since the challenge was created
+		if !checkUserStanding(dm, w, challenge.UserID) {
+			return
+		}
+
+		// Only one session can be issued per challenge
+		if ok, err := dm.CompleteLoginChallenge(challenge.ID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		} else if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(errors.ErrChallengeNotFound.Error()))
+			return
+		}
+		if err := dm.ClearLoginFailures(user.Email); err != nil {
+			log.Printf("Error clearing failed logins: %s", err)
+		}
+
+		// Generate session token
+		usertoken, err := dm.GenerateSessionToken(challenge.UserID, challenge.Origin, challenge.Persist)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Let the user know if the login came from somewhere new
+		go notifyNewLogin(dm, loginFromRequest(r, challenge.UserID, usertoken))
+
+		// Write response to client with the session token
+		w.Write([]byte(usertoken))
+	})
+
+	// Email a new security code for a login challenge, replacing any code that was emailed before.
+	r.Post("/challenge/email", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		var u structs.MFAChallengeEmail
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		challenge, ok := getLoginChallenge(dm, w, u.Challenge)
+		if !ok {
+			return
+		}
+
+		user, err := dm.GetUserByID(challenge.UserID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		methods, _, err := mfaMethods(dm, user.ID, user.State)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if !slices.Contains(methods, mfaMethodEmail) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Emailed security codes are not enabled for this account."))
+			return
+		}
+
+		// Sending a code counts as an attempt, so that the user's inbox can't be flooded
+		if ok, err := dm.CountLoginChallengeAttempt(challenge.ID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		} else if !ok {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("Too many attempts. Please log in again."))
+			return
+		}
+
+		if err := sendSecurityCode(dm, user, challenge.ID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Write([]byte("OK"))
+	})
+}
+
+// mfaMethods returns the two-factor authentication methods a user can use to complete a login challenge,
+// and their TOTP secret (if they use an authenticator app). Returns no methods if two-factor authentication is disabled.
+func mfaMethods(dm *dm.Manager, userid string, state bitfield.Bitfield8) ([]string, *structs.TOTPQuery, error) {
+	var methods []string
+
+	totp, err := dm.GetTOTP(userid)
+	if err != nil && err != errors.ErrTOTPNotFound {
+		return nil, nil, err
+	}
+	if err == nil && totp.State.Read(constants.TOTP_IS_ENABLED) {
+		methods = append(methods, mfaMethodTOTP)
+	} else {
+		totp = nil
+	}
+
+	if state.Read(constants.USER_USES_EMAIL_2FA) && dm.EnableEmail && !state.Read(constants.USER_IS_EMAIL_DISABLED) {
+		methods = append(methods, mfaMethodEmail)
+	}
+
+	if len(methods) > 0 {
+		methods = append(methods, mfaMethodRecovery)
+	}
+	return methods, totp, nil
+}
+
+// verifySecondFactor checks a TOTP code, an emailed security code or a recovery code for a login challenge.
+// Each code can only be used once.
+func verifySecondFactor(dm *dm.Manager, challenge *structs.LoginChallengeQuery, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	// Authenticator app
+	totp, err := dm.GetTOTP(challenge.UserID)
+	if err != nil && err != errors.ErrTOTPNotFound {
+		return false, err
+	}
+	if err == nil && totp.State.Read(constants.TOTP_IS_ENABLED) {
+		if step, valid := accounts.ValidateTOTP(totp.Secret, code, totp.LastStep); valid {
+			return dm.ConsumeTOTPStep(challenge.UserID, step)
+		}
+	}
+
+	// Emailed security code
+	if challenge.Code != "" && accounts.VerifyPassword(code, challenge.Code) == nil {
+		return true, nil
+	}
+
+	// Recovery code
+	codes, err := dm.GetRecoveryCodes(challenge.UserID)
+	if err != nil {
+		return false, err
+	}
+	normalized := accounts.NormalizeRecoveryCode(code)
+	for _, recovery := range codes {
+		if accounts.VerifyPassword(normalized, recovery.Hash) == nil {
+			return dm.ConsumeRecoveryCode(recovery.ID)
+		}
+	}
+
+	return false, nil
+}
+
+// issueRecoveryCodes replaces the recovery codes of a user, and writes the new codes to the client.
+func issueRecoveryCodes(dm *dm.Manager, w http.ResponseWriter, userid string) {
+	codes, err := accounts.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = accounts.HashPassword(accounts.NormalizeRecoveryCode(code))
+	}
+	if err := dm.ReplaceRecoveryCodes(userid, hashes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&structs.RecoveryCodes{Codes: codes})
+}
+
+// sendSecurityCode emails a new security code for a login challenge to the user.
+func sendSecurityCode(dm *dm.Manager, user *structs.UserQuery, challenge string) error {
+	code, err := accounts.GenerateSecurityCode()
+	if err != nil {
+		return err
+	}
+	if err := dm.SetLoginChallengeCode(challenge, accounts.HashPassword(code)); err != nil {
+		return err
+	}
+
+	unsubscribeLink, err := dm.GenerateMagicLink(user.ID, constants.LINKMODE_UNSUBSCRIBE)
+	if err != nil {
+		return err
+	}
+
+	if err := dm.SendHTMLEmail(&structs.EmailArgs{
+		Subject:  "Your security code",
+		To:       user.Email,
+		Template: "security_code",
+	}, &structs.TemplateData{
+		Name:            user.Username,
+		Code:            code,
+		UnsubscribeLink: fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubscribeLink),
+	}); err != nil {
+		log.Printf("Error sending security code email: %s", err)
+		return err
+	}
+	return nil
+}
+
+// getLoginChallenge finds a login challenge, writing an error to the client if it doesn't exist or has expired.
+func getLoginChallenge(dm *dm.Manager, w http.ResponseWriter, id string) (*structs.LoginChallengeQuery, bool) {
+	challenge, err := dm.GetLoginChallenge(id)
+	if err != nil {
+		switch err {
+		case errors.ErrChallengeNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case errors.ErrChallengeExpired:
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(err.Error()))
+		return nil, false
+	}
+	return challenge, true
+}
+
+// verifyAccountPassword checks the password of a signed in user before a sensitive change,
+// writing an error to the client if it is incorrect.
+func verifyAccountPassword(dm *dm.Manager, w http.ResponseWriter, user *structs.Client, password string) bool {
+	hash, err := dm.GetUserPasswordHash(user.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return false
+	}
+	if err := accounts.VerifyPassword(password, hash); err != nil {
+		if strings.Contains(err.Error(), "does not match") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Incorrect password"))
+			return false
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Something went wrong while verifying your login credentials. Please try again."))
+		return false
+	}
+	return true
+}
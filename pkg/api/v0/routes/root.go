@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 	constants "github.com/cloudlink-omega/backend/pkg/constants"
 	dm "github.com/cloudlink-omega/backend/pkg/data"
 	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	signaling "github.com/cloudlink-omega/backend/pkg/signaling"
 	structs "github.com/cloudlink-omega/backend/pkg/structs"
 	utils "github.com/cloudlink-omega/backend/pkg/utils"
 )
@@ -47,7 +50,14 @@ func RootRouter(r chi.Router) {
 		var mode uint8
 		var err error
 		if user, mode, err = dm.VerifyMagicToken(token); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			switch err {
+			case errors.ErrLinkNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case errors.ErrLinkExpired:
+				w.WriteHeader(http.StatusGone)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 			w.Write([]byte(err.Error()))
 			return
 		}
@@ -55,7 +65,7 @@ func RootRouter(r chi.Router) {
 		// Verify mode
 		if mode != constants.LINKMODE_EMAIL {
 			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("This token is not a valid email verification or unsubscribe token."))
+			w.Write([]byte("This token is not a valid email verification token."))
 			return
 		}
 
@@ -90,15 +100,22 @@ func RootRouter(r chi.Router) {
 		var mode uint8
 		var err error
 		if user, mode, err = dm.VerifyMagicToken(token); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			switch err {
+			case errors.ErrLinkNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case errors.ErrLinkExpired:
+				w.WriteHeader(http.StatusGone)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 			w.Write([]byte(err.Error()))
 			return
 		}
 
 		// Verify mode
-		if mode != constants.LINKMODE_EMAIL {
+		if mode != constants.LINKMODE_UNSUBSCRIBE {
 			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("This token is not a valid email verification or unsubscribe token."))
+			w.Write([]byte("This token is not a valid unsubscribe token."))
 			return
 		}
 
@@ -139,7 +156,7 @@ func RootRouter(r chi.Router) {
 
 			// Generate random session token
 			var usertoken string
-			if res, err := dm.GenerateSessionToken(u.Email, r.URL.Hostname()); err != nil {
+			if res, err := dm.GenerateSessionToken(u.Email, utils.RemoteIP(r), false); err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				w.Write([]byte(err.Error()))
 				return
@@ -167,44 +184,94 @@ func RootRouter(r chi.Router) {
 		}
 
 		// Define vars
-		var hash string
 		var userid string
 		var usertoken string
+		var address = utils.RemoteIP(r)
 
-		// Grab user's password hash
-		if res, err := dm.GetUserPasswordHash(u.Email); err != nil {
+		// Make clients that keep failing to log in wait before trying again
+		if !checkLoginThrottle(dm, w, u.Email, address) {
+			return
+		}
+
+		// Grab user from email. Accounts that don't exist get the same response as a wrong password, in the same amount of time.
+		user, err := dm.GetUserLoginByEmail(u.Email)
+		if err != nil && err != errors.ErrUserNotFound {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
 			return
-		} else {
-			hash = res
+		}
+		if user != nil {
+			userid = user.ID
 		}
 
 		// Verify the hash matches the provided password
-		if err := accounts.VerifyPassword(u.Password, hash); err != nil {
-			// Incorrect password
-			if strings.Contains(err.Error(), "does not match") {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte("Incorrect password"))
-				return
-			}
+		var valid bool
+		if user == nil {
+			accounts.VerifyDummyPassword(u.Password)
+		} else if err := accounts.VerifyPassword(u.Password, user.Password); err == nil {
+			valid = true
+		} else if !strings.Contains(err.Error(), "does not match") {
 			// Something else went wrong
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte("Something went wrong while verifying your login credentials. Please try again."))
 			return
 		}
 
-		// Grab user ID from email
-		if res, err := dm.GetUserID(u.Email); err != nil {
+		if !valid {
+			locked, err := dm.RecordLoginFailure(u.Email, address)
+			if err != nil {
+				log.Printf("Error recording failed login: %s", err)
+			} else if locked && user != nil {
+				go sendLockoutAlert(dm, user, address)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Invalid credentials."))
+			return
+		}
+		// Refuse blocked and banned accounts
+		if !checkUserStanding(dm, w, userid) {
+			return
+		}
+
+		// Users with two-factor authentication must complete a login challenge (see /mfa/challenge) to get a session token
+		if methods, _, err := mfaMethods(dm, userid, user.State); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
 			return
-		} else {
-			userid = res
+		} else if len(methods) > 0 {
+			challenge, expires, err := dm.CreateLoginChallenge(userid, address, u.Persist)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+
+			// Users without an authenticator app get their security code right away
+			if !slices.Contains(methods, mfaMethodTOTP) && slices.Contains(methods, mfaMethodEmail) {
+				if err := sendSecurityCode(dm, user, challenge); err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(err.Error()))
+					return
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(&structs.LoginChallenge{
+				Challenge: challenge,
+				Methods:   methods,
+				Expires:   expires,
+			})
+			return
+		}
+
+		// Failed logins are only forgotten once a session is issued, so that second factors are throttled too
+		if err := dm.ClearLoginFailures(u.Email); err != nil {
+			log.Printf("Error clearing failed logins: %s", err)
 		}
 
 		// Generate session token
-		if res, err := dm.GenerateSessionToken(userid, r.URL.Hostname()); err != nil {
+		if res, err := dm.GenerateSessionToken(userid, address, u.Persist); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
 			return
@@ -212,10 +279,118 @@ func RootRouter(r chi.Router) {
 			usertoken = res
 		}
 
+		// Let the user know if the login came from somewhere new
+		go notifyNewLogin(dm, loginFromRequest(r, userid, usertoken))
+
 		// Write response to client with the session token
 		w.Write([]byte(usertoken))
 	})
 
+	// Log out, revoking the session token (or every session token of the user)
+	r.Post("/logout", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		// If authless mode is enabled, disable this endpoint
+		if dm.AuthlessMode {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("Authless mode is enabled on this server. Sessions are not available."))
+			return
+		}
+
+		// Load request body as JSON into logout struct
+		var u structs.Logout
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Validate logout struct
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, ok := verifySessionToken(dm, w, u.Token)
+		if !ok {
+			return
+		}
+
+		// Log out everywhere
+		if u.Everywhere {
+			if err := dm.RevokeAllSessions(user.ULID); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			signaling.DisconnectRevokedSession(user.ULID)
+			w.Write([]byte("OK"))
+			return
+		}
+
+		if err := dm.RevokeSessionToken(u.Token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		disconnectRevokedSession(dm, user.ULID, u.Token)
+		w.Write([]byte("OK"))
+	})
+
+	// Exchange a session token for a new one. The old token is revoked, and can't be refreshed again.
+	r.Post("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		// If authless mode is enabled, disable this endpoint
+		if dm.AuthlessMode {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("Authless mode is enabled on this server. Sessions are not available."))
+			return
+		}
+
+		// Load request body as JSON into refresh struct
+		var u structs.RefreshToken
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Validate refresh struct
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		// Blocked and banned accounts can't keep their sessions alive
+		if session, err := dm.GetSessionInfoFromToken(u.Token); err == nil && !checkUserStanding(dm, w, session.UserID) {
+			return
+		}
+
+		usertoken, err := dm.RefreshSessionToken(u.Token)
+		if err != nil {
+			switch err {
+			case errors.ErrSessionReused:
+				// The token was probably stolen, so disconnect whoever is using the session
+				if userid, tokens, err := dm.GetSessionFamily(u.Token); err != nil {
+					log.Printf("Error finding tokens of reused session: %s", err)
+				} else if userid != "" {
+					signaling.DisconnectRevokedSession(userid, tokens...)
+				}
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte("This session token was already refreshed. For your safety, the session has been revoked. Please log in again."))
+				return
+			case errors.ErrSessionNotFound, errors.ErrSessionRevoked, errors.ErrSessionExpired:
+				w.WriteHeader(http.StatusUnauthorized)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Write response to client with the new session token
+		w.Write([]byte(usertoken))
+	})
+
 	// Save to slot
 	r.Post("/save", func(w http.ResponseWriter, r *http.Request) {
 		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
@@ -252,10 +427,14 @@ func RootRouter(r chi.Router) {
 			return
 		}
 
-		// Validate UGI exists
-		if _, _, err := dm.VerifyUGI(s.UGI); err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(err.Error()))
+		// Validate UGI exists, and that the game is active and uses save slots
+		game, ok := verifyGame(dm, w, s.UGI)
+		if !ok {
+			return
+		}
+		if !game.GameState.Read(constants.GAME_SUPPORTS_DISK) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("This game doesn't support save slots."))
 			return
 		}
 
@@ -266,7 +445,7 @@ func RootRouter(r chi.Router) {
 		// Handle errors
 		if err != nil {
 			switch err {
-			case errors.ErrSessionNotFound:
+			case errors.ErrSessionNotFound, errors.ErrSessionRevoked:
 				w.WriteHeader(http.StatusUnauthorized)
 			default:
 				w.WriteHeader(http.StatusInternalServerError)
@@ -282,6 +461,11 @@ func RootRouter(r chi.Router) {
 			return
 		}
 
+		// Refuse blocked and banned accounts
+		if !checkUserStanding(dm, w, session.UserID) {
+			return
+		}
+
 		// Write save slot
 		if err = dm.WriteSaveSlot(s.SaveSlot, fmt.Sprint(s.SaveData), session.UserID, s.UGI); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -328,10 +512,8 @@ func RootRouter(r chi.Router) {
 			return
 		}
 
-		// Validate UGI exists
-		if _, _, err := dm.VerifyUGI(s.UGI); err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(err.Error()))
+		// Validate UGI exists, and that the game is active
+		if _, ok := verifyGame(dm, w, s.UGI); !ok {
 			return
 		}
 
@@ -342,7 +524,7 @@ func RootRouter(r chi.Router) {
 		// Handle errors
 		if err != nil {
 			switch err {
-			case errors.ErrSessionNotFound:
+			case errors.ErrSessionNotFound, errors.ErrSessionRevoked:
 				w.WriteHeader(http.StatusUnauthorized)
 			default:
 				w.WriteHeader(http.StatusInternalServerError)
@@ -358,6 +540,11 @@ func RootRouter(r chi.Router) {
 			return
 		}
 
+		// Refuse blocked and banned accounts
+		if !checkUserStanding(dm, w, session.UserID) {
+			return
+		}
+
 		// Read save slot
 		data, err := dm.ReadSaveSlot(s.SaveSlot, session.UserID, s.UGI)
 		if err != nil {
@@ -421,12 +608,17 @@ func RootRouter(r chi.Router) {
 
 		fmt.Printf("Registered user %s\n", u.Username)
 
-		var verifLink string
+		var verifLink, unsubLink string
 		if verifLink, err = dm.GenerateMagicLink(id, constants.LINKMODE_EMAIL); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
 			return
 		}
+		if unsubLink, err = dm.GenerateMagicLink(id, constants.LINKMODE_UNSUBSCRIBE); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
 
 		// Send welcome email - TODO: Somehow make this a template.
 		if err := dm.SendPlainEmail(&structs.EmailArgs{
@@ -444,7 +636,7 @@ If you have questions, comments, or concerns, please reach out to MikeDEV via Di
 Please support the project by marking this email as "not spam". Beware phishing: We will never ask for your login credentials over email.`,
 			u.Username,
 			fmt.Sprintf("%s/api/v0/verify?token=%s", dm.PublicHostname, verifLink),
-			fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, verifLink),
+			fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubLink),
 		)); err != nil {
 			log.Printf("Error sending welcome email: %s", err)
 		} else {
@@ -462,6 +654,260 @@ Please support the project by marking this email as "not spam". Beware phishing:
 		w.WriteHeader(http.StatusCreated)
 		w.Write([]byte("OK"))
 	})
+
+	// Request a password reset
+	r.Post("/forgot_password", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		// If authless mode is enabled, disable this endpoint
+		if dm.AuthlessMode {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("Authless mode is enabled on this server. Password resets are not available."))
+			return
+		}
+
+		// Password reset links can only be delivered by email
+		if !dm.EnableEmail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Email is disabled on this server. Please contact an administrator to reset your password."))
+			return
+		}
+
+		// Load request body as JSON into forgot password struct
+		var u structs.ForgotPassword
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Validate forgot password struct
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		// Send the email in the background, so that the response (and the time it takes) is
+		// the same whether or not an account exists with this email address.
+		go sendPasswordResetEmail(dm, u.Email)
+
+		w.Write([]byte("If an account with this email address exists, a password reset link has been sent to it."))
+	})
+
+	// Reset password using a password reset magic link
+	r.Post("/reset_password", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		// If authless mode is enabled, disable this endpoint
+		if dm.AuthlessMode {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("Authless mode is enabled on this server. Password resets are not available."))
+			return
+		}
+
+		// Load request body as JSON into reset password struct
+		var u structs.ResetPassword
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Validate reset password struct
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		// Verify magic link
+		user, mode, err := dm.VerifyMagicToken(u.Token)
+		if err != nil {
+			switch err {
+			case errors.ErrLinkNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case errors.ErrLinkExpired:
+				w.WriteHeader(http.StatusGone)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Verify mode
+		if mode != constants.LINKMODE_PASSWORD {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("This token is not a valid password reset token."))
+			return
+		}
+
+		// Hash and store the new password
+		if err := dm.UpdateUserPassword(user.ULID, accounts.HashPassword(u.Password)); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Log out everywhere, since the old password may have been compromised
+		if err := dm.RevokeAllSessions(user.ULID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		signaling.DisconnectRevokedSession(user.ULID)
+
+		// Delete this magic link, and any other password reset links that were requested
+		if err := dm.DestroyAllMagicLinks(user.ULID, constants.LINKMODE_PASSWORD); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Write([]byte(fmt.Sprintf("Hello %s, your password has been reset successfully. Please log in again.", user.Username)))
+	})
+
+	// Revoke all sessions using a password reset magic link
+	// Links to revoke every session show a confirmation page first, so that opening the link doesn't revoke anything
+	r.Get("/revoke_sessions", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/revoke_sessions.html?"+r.URL.RawQuery, http.StatusSeeOther)
+	})
+
+	// Revoke every session using a link from a password reset email
+	r.Post("/revoke_sessions", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		// Load request body as JSON into revoke sessions struct
+		var u structs.RevokeSessions
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Validate revoke sessions struct
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, mode, err := dm.VerifyMagicToken(u.Token)
+		if err != nil {
+			switch err {
+			case errors.ErrLinkNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case errors.ErrLinkExpired:
+				w.WriteHeader(http.StatusGone)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Verify mode
+		if mode != constants.LINKMODE_REVOKE_ALL {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("This token is not a valid session revoke token."))
+			return
+		}
+
+		// Log out everywhere
+		if err := dm.RevokeAllSessions(user.ULID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		signaling.DisconnectRevokedSession(user.ULID)
+
+		// Cancel every pending password reset, since this user didn't request it
+		if err := dm.DestroyAllMagicLinks(user.ULID, constants.LINKMODE_PASSWORD); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Destroy the magic link
+		if err := dm.DestroyMagicLink(u.Token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Write response to client
+		w.Write([]byte(fmt.Sprintf("Hello %s, all of your sessions have been revoked and the password reset was cancelled. If you believe someone knows your password, please request a new password reset.", user.Username)))
+	})
+
+	// Links to revoke a session show a confirmation page first, so that opening the link doesn't revoke anything
+	r.Get("/revoke_session", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/revoke_session.html?"+r.URL.RawQuery, http.StatusSeeOther)
+	})
+
+	// Revoke a single session using a link from a new login email
+	r.Post("/revoke_session", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		// Load request body as JSON into revoke session struct
+		var u structs.RevokeSession
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Validate revoke session struct
+		if handleValidationError(w, validate.Struct(u)) {
+			return
+		}
+
+		user, mode, err := dm.VerifyMagicToken(u.Token)
+		if err != nil {
+			switch err {
+			case errors.ErrLinkNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case errors.ErrLinkExpired:
+				w.WriteHeader(http.StatusGone)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Verify mode
+		if mode != constants.LINKMODE_REVOKE {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("This token is not a valid session revoke token."))
+			return
+		}
+
+		// The link is bound to the token family of the new login, so refreshing the token doesn't keep the session alive
+		family, err := dm.GetMagicLinkSubject(u.Token)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if family == "" {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("This link is no longer valid. If you didn't log in, please reset your password."))
+			return
+		}
+
+		// Revoke the session, and every token refreshed from it
+		if err := dm.RevokeSessionFamily(family); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		disconnectRevokedSession(dm, user.ULID, family)
+
+		// Destroy the magic link
+		if err := dm.DestroyMagicLink(u.Token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Write response to client
+		w.Write([]byte(fmt.Sprintf("Hello %s, the session has been revoked. If you didn't log in, please reset your password.", user.Username)))
+	})
 }
 
 func handleValidationError(w http.ResponseWriter, err error) bool {
@@ -479,3 +925,162 @@ func handleValidationError(w http.ResponseWriter, err error) bool {
 	}
 	return false
 }
+
+// verifyGame finds the game of a UGI, writing an error to the client if it doesn't exist or is inactive.
+func verifyGame(dm *dm.Manager, w http.ResponseWriter, ugi string) (*structs.UGIQuery, bool) {
+	game, err := dm.VerifyUGI(ugi)
+	if err != nil {
+		switch err {
+		case errors.ErrGameNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case errors.ErrGameInactive, errors.ErrDeveloperInactive:
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(err.Error()))
+		return nil, false
+	}
+	return game, true
+}
+
+// verifySessionToken finds the user of a session token, writing an error to the client if the session is invalid or has expired.
+func verifySessionToken(dm *dm.Manager, w http.ResponseWriter, token string) (*structs.Client, bool) {
+	session, err := dm.VerifySessionToken(token)
+	if err != nil {
+		switch err {
+		case errors.ErrSessionNotFound, errors.ErrSessionRevoked:
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(err.Error()))
+		return nil, false
+	}
+
+	// Check if session is expired
+	if session.Expiry <= time.Now().Unix() {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Session token has expired."))
+		return nil, false
+	}
+
+	return session, true
+}
+
+// checkUserStanding writes an error to the client if the user's account is blocked (423) or banned (403, with the ban details).
+func checkUserStanding(dm *dm.Manager, w http.ResponseWriter, userid string) bool {
+	ban, err := dm.CheckUserStanding(userid)
+	switch err {
+	case nil:
+		return true
+	case errors.ErrUserBlocked:
+		w.WriteHeader(http.StatusLocked)
+		w.Write([]byte("Your account has been disabled."))
+	case errors.ErrUserBanned:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&structs.BanNotice{
+			Reason:  ban.Reason,
+			Expires: ban.Expires,
+			Appeal:  ban.Appeal,
+		})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+	}
+	return false
+}
+
+// checkLoginThrottle makes clients that keep failing to log in to an account wait before trying again,
+// writing an error to the client if it has to wait.
+func checkLoginThrottle(dm *dm.Manager, w http.ResponseWriter, email string, address string) bool {
+	wait, err := dm.LoginRetryAfter(email, address)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return false
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("Too many failed login attempts. Please try again later."))
+		return false
+	}
+	return true
+}
+
+// sendLockoutAlert tells a user that their account was locked after too many failed logins.
+func sendLockoutAlert(dm *dm.Manager, user *structs.UserQuery, address string) {
+	if !dm.EnableEmail {
+		return
+	}
+
+	// Respect users who can't receive emails
+	if user.State.Read(constants.USER_IS_EMAIL_DISABLED) {
+		log.Printf("Not sending security alert email to %s: Emails are disabled for this user", user.Username)
+		return
+	}
+
+	unsubscribeLink, err := dm.GenerateMagicLink(user.ID, constants.LINKMODE_UNSUBSCRIBE)
+	if err != nil {
+		log.Printf("Error generating unsubscribe link: %s", err)
+		return
+	}
+
+	if err := dm.SendHTMLEmail(&structs.EmailArgs{
+		Subject:  "Security alert",
+		To:       user.Email,
+		Template: "security_alert",
+	}, &structs.TemplateData{
+		Name:            user.Username,
+		Alert:           fmt.Sprintf("Someone failed to log in to your account too many times (most recently from %s), so I have locked it for a while. If this wasn't you, please reset your password.", address),
+		UnsubscribeLink: fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubscribeLink),
+	}); err != nil {
+		log.Printf("Error sending security alert email: %s", err)
+	}
+}
+
+// sendPasswordResetEmail sends a password reset link to the user with the given email address, if the user exists.
+func sendPasswordResetEmail(dm *dm.Manager, email string) {
+	user, err := dm.GetUserByEmail(email)
+	if err != nil {
+		if err != errors.ErrUserNotFound {
+			log.Printf("Error finding user for password reset: %s", err)
+		}
+		return
+	}
+
+	// Respect users who can't receive emails
+	if user.State.Read(constants.USER_IS_EMAIL_DISABLED) {
+		log.Printf("Not sending password reset email to %s: Emails are disabled for this user", user.Username)
+		return
+	}
+
+	var resetLink, revokeLink, unsubscribeLink string
+	if resetLink, err = dm.GenerateMagicLink(user.ID, constants.LINKMODE_PASSWORD); err != nil {
+		log.Printf("Error generating password reset link: %s", err)
+		return
+	}
+	if revokeLink, err = dm.GenerateMagicLink(user.ID, constants.LINKMODE_REVOKE_ALL); err != nil {
+		log.Printf("Error generating session revoke link: %s", err)
+		return
+	}
+	if unsubscribeLink, err = dm.GenerateMagicLink(user.ID, constants.LINKMODE_UNSUBSCRIBE); err != nil {
+		log.Printf("Error generating unsubscribe link: %s", err)
+		return
+	}
+
+	if err := dm.SendHTMLEmail(&structs.EmailArgs{
+		Subject:  "Reset your password",
+		To:       user.Email,
+		Template: "password_reset",
+	}, &structs.TemplateData{
+		Name:            user.Username,
+		ResetLink:       fmt.Sprintf("%s/reset_password.html?token=%s", dm.PublicHostname, resetLink),
+		RevokeLink:      fmt.Sprintf("%s/revoke_sessions.html?token=%s", dm.PublicHostname, revokeLink),
+		UnsubscribeLink: fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubscribeLink),
+	}); err != nil {
+		log.Printf("Error sending password reset email: %s", err)
+	}
+}
@@ -0,0 +1,196 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	dm "github.com/cloudlink-omega/backend/pkg/data"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	signaling "github.com/cloudlink-omega/backend/pkg/signaling"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	utils "github.com/cloudlink-omega/backend/pkg/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+// Session management. These routes read the session token from the "Authorization: Bearer <token>" header,
+// since browsers can't send a body with GET requests.
+func SessionsRouter(r chi.Router) {
+	var validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// Sessions need accounts
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+			if dm.AuthlessMode {
+				w.WriteHeader(http.StatusGone)
+				w.Write([]byte("Authless mode is enabled on this server. Sessions are not available."))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// List the active sessions of the user
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		token, ok := bearerSessionToken(validate, w, r)
+		if !ok {
+			return
+		}
+		user, ok := verifySessionToken(dm, w, token)
+		if !ok {
+			return
+		}
+
+		sessions, err := dm.GetSessions(user.ULID, token)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if sessions == nil {
+			sessions = []*structs.SessionListing{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	})
+
+	// Revoke a session of the user, using its ID from the session list
+	r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+
+		token, ok := bearerSessionToken(validate, w, r)
+		if !ok {
+			return
+		}
+		user, ok := verifySessionToken(dm, w, token)
+		if !ok {
+			return
+		}
+
+		revoked, err := dm.RevokeSession(user.ULID, chi.URLParam(r, "id"))
+		if err != nil {
+			switch err {
+			case errors.ErrSessionNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		disconnectRevokedSession(dm, user.ULID, revoked)
+
+		w.Write([]byte("OK"))
+	})
+}
+
+// disconnectRevokedSession disconnects the signaling client that uses a revoked session token,
+// or a token that was refreshed into it.
+func disconnectRevokedSession(dm *dm.Manager, userid string, token string) {
+	_, tokens, err := dm.GetSessionFamily(token)
+	if err != nil {
+		log.Printf("Error finding tokens of revoked session: %s", err)
+		tokens = []string{token}
+	}
+	signaling.DisconnectRevokedSession(userid, tokens...)
+}
+
+// newLogin describes a successful login, for new login notifications.
+type newLogin struct {
+	userid  string
+	token   string
+	address string
+	origin  string
+	browser string
+	time    time.Time
+}
+
+// loginFromRequest describes a successful login request. This must be called before the request finishes.
+func loginFromRequest(r *http.Request, userid string, token string) *newLogin {
+	return &newLogin{
+		userid:  userid,
+		token:   token,
+		address: utils.RemoteIP(r),
+		origin:  r.Header.Get("Origin"),
+		browser: utils.DescribeUserAgent(r.UserAgent()),
+		time:    time.Now(),
+	}
+}
+
+// notifyNewLogin emails the user if a login came from an IP address that none of their other sessions came from.
+// The email contains a link that revokes the new session.
+func notifyNewLogin(dm *dm.Manager, login *newLogin) {
+	isNew, err := dm.IsNewLogin(login.userid, login.token)
+	if err != nil {
+		log.Printf("Error checking for new login: %s", err)
+		return
+	}
+	if !isNew || !dm.EnableEmail {
+		return
+	}
+
+	user, err := dm.GetUserByID(login.userid)
+	if err != nil {
+		log.Printf("Error finding user for new login email: %s", err)
+		return
+	}
+
+	// Respect users who can't receive emails
+	if user.State.Read(constants.USER_IS_EMAIL_DISABLED) {
+		log.Printf("Not sending new login email to %s: Emails are disabled for this user", user.Username)
+		return
+	}
+
+	var revokeLink, unsubscribeLink string
+	// New logins start a token family of their own, named after the login token
+	if revokeLink, err = dm.GenerateMagicLinkFor(user.ID, constants.LINKMODE_REVOKE, login.token); err != nil {
+		log.Printf("Error generating session revoke link: %s", err)
+		return
+	}
+	if unsubscribeLink, err = dm.GenerateMagicLink(user.ID, constants.LINKMODE_UNSUBSCRIBE); err != nil {
+		log.Printf("Error generating unsubscribe link: %s", err)
+		return
+	}
+
+	address := login.origin
+	if address == "" {
+		address = "Unknown"
+	}
+
+	if err := dm.SendHTMLEmail(&structs.EmailArgs{
+		Subject:  "New login to your account",
+		To:       user.Email,
+		Template: "new_login",
+	}, &structs.TemplateData{
+		Name:            user.Username,
+		IPAddress:       login.address,
+		Browser:         login.browser,
+		Timestamp:       login.time.UTC().Format(time.RFC1123),
+		Address:         address,
+		RevokeLink:      fmt.Sprintf("%s/revoke_session.html?token=%s", dm.PublicHostname, revokeLink),
+		UnsubscribeLink: fmt.Sprintf("%s/api/v0/unsubscribe?token=%s", dm.PublicHostname, unsubscribeLink),
+	}); err != nil {
+		log.Printf("Error sending new login email: %s", err)
+	}
+}
+
+// bearerSessionToken reads the session token from the Authorization header, writing an error to the client if it is missing or malformed.
+func bearerSessionToken(validate *validator.Validate, w http.ResponseWriter, r *http.Request) (string, bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || validate.Var(token, "required,ulid") != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Malformed session token."))
+		return "", false
+	}
+	return token, true
+}
@@ -19,7 +19,7 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin:     AuthorizedOrigins,
+	CheckOrigin:     func(r *http.Request) bool { return true }, // Checked by AuthorizedOrigins before upgrading
 }
 
 func SignalingRouter(r chi.Router) {
@@ -33,6 +33,22 @@ func SignalingRouter(r chi.Router) {
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
 
+		// Limit how often each IP address can open a connection (allowlisted addresses are exempt)
+		if signaling.UpgradeLimiter != nil && !dm.IsIPAllowed(utils.RemoteIP(r)) && !signaling.UpgradeLimiter.Allow(utils.RemoteIP(r)) {
+			http.Error(w, "Too many connections, please try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		// Check that the UGI query is a valid ULID before looking up the game's authorized origins
+		ugi := r.URL.Query().Get("ugi")
+		invalidUGI := utils.VariableContainsValidationError("ugi", validate.Var(ugi, "ulid"))
+
+		// Refuse connections from websites that are not authorized to use the game
+		if invalidUGI == nil && !AuthorizedOrigins(r) {
+			http.Error(w, "Origin not authorized", http.StatusForbidden)
+			return
+		}
+
 		// Upgrade initial GET request to a websocket connection
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
@@ -40,19 +56,19 @@ func SignalingRouter(r chi.Router) {
 			return
 		}
 
-		// Assert that the UGI query is a valid ULID
-		ugi := r.URL.Query().Get("ugi")
-		if msg := utils.VariableContainsValidationError("ugi", validate.Var(ugi, "ulid")); msg != nil {
+		// Refuse invalid UGIs
+		if invalidUGI != nil {
 			signaling.SendCodeWithMessage(
 				conn,
-				msg,
+				invalidUGI,
 			)
 			return
 		}
 
-		// Verify validity of provided UGI and get the name of the game, as well as the name of the developer
-		var gameName, developerName string
-		if gameName, developerName, err = dm.VerifyUGI(ugi); err != nil {
+		// Verify validity of provided UGI and get the name of the game, as well as the name of the developer.
+		// Inactive games and games of inactive developers are refused.
+		game, err := dm.VerifyUGI(ugi)
+		if err != nil {
 			signaling.SendCodeWithMessage(
 				conn,
 				err.Error(),
@@ -60,14 +76,15 @@ func SignalingRouter(r chi.Router) {
 			return
 		}
 
-		log.Printf("[Signaling] %s connected to \"%s\" by \"%s\"", r.RemoteAddr, gameName, developerName)
+		log.Printf("[Signaling] %s connected to \"%s\" by \"%s\"", r.RemoteAddr, game.GameName, game.DeveloperName)
 
 		// Create client
 		client := signaling.Manager.Add(&structs.Client{
 			Conn:          conn,
 			UGI:           ugi,
-			GameName:      gameName,
-			DeveloperName: developerName,
+			GameName:      game.GameName,
+			DeveloperName: game.DeveloperName,
+			Node:          dm.ServerNickname,
 		})
 
 		// Handle connection with websocket
@@ -76,14 +93,28 @@ func SignalingRouter(r chi.Router) {
 	})
 }
 
-// AuthorizedOrigins is a Go function that implements CORS. It queries the database for authorized origins.
+// AuthorizedOrigins is a Go function that implements CORS. It queries the database for authorized origins of the
+// requested game. Requests without an Origin header (i.e. not from a browser) are permitted.
 //
 // r *http.Request
 // bool
 func AuthorizedOrigins(r *http.Request) bool {
 	origin := r.Header.Get("Origin")
-	host := r.URL.Hostname()
-	log.Printf("[Signaling] New incoming connection from origin: %s, Host: %s\n", origin, host)
-	// TODO: Implement CORS. Query the database for authorized origins, etc. For now, return true.
+	if origin == "" {
+		return true
+	}
+	dm := r.Context().Value(constants.DataMgrCtx).(*dm.Manager)
+	ugi := r.URL.Query().Get("ugi")
+
+	origins, err := dm.GetAuthorizedOrigins(ugi)
+	if err != nil {
+		log.Printf("[Signaling] Failed to get authorized origins for UGI %s: %s", ugi, err)
+		return false
+	}
+
+	if !utils.OriginAllowed(origin, origins) {
+		log.Printf("[Signaling] Refusing connection from unauthorized origin %s to UGI %s", origin, ugi)
+		return false
+	}
 	return true
 }
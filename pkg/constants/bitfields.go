@@ -12,21 +12,44 @@ const (
 	USER_IS_BLOCKED          uint = 2 // If the third bit is set, the account has been disabled.
 	USER_IS_BANNED           uint = 3 // If the fourth bit is set, the account has been banned.
 	USER_IS_EMAIL_DISABLED   uint = 4 // If the fifth bit is set, this will disable sending emails to the user (i.e. email needs to be changed manually, wrong email, etc).
-	_                        uint = 5 // _ bit values are reserved for future use.
-	_                        uint = 6
+	USER_USES_EMAIL_2FA      uint = 5 // If the sixth bit is set, the user must enter a one-time code sent to their email to log in.
+	_                        uint = 6 // _ bit values are reserved for future use.
 	USER_IS_ADMIN            uint = 7 // If the last bit is set, the user is a server admin.
 )
 
+// UserFlagNames maps the names of user flags used by the admin API to their bits.
+var UserFlagNames = map[string]uint{
+	"email_registered": USER_IS_EMAIL_REGISTERED,
+	"active":           USER_IS_ACTIVE,
+	"blocked":          USER_IS_BLOCKED,
+	"banned":           USER_IS_BANNED,
+	"email_disabled":   USER_IS_EMAIL_DISABLED,
+	"email_2fa":        USER_USES_EMAIL_2FA,
+	"admin":            USER_IS_ADMIN,
+}
+
 // Session flags
 const (
-	SESSION_IS_ACTIVE uint = 0 // If the first bit is set, the session is active (set false to revoke the session).
-	SESSION_PERSIST   uint = 1 // If the second bit is set, the session should have no TTL and should persist.
-	_                 uint = 2
-	_                 uint = 3
-	_                 uint = 4 // _ bit values are reserved for future use.
-	_                 uint = 5
-	_                 uint = 6
-	_                 uint = 7
+	SESSION_IS_ACTIVE  uint = 0 // If the first bit is set, the session was created by the server. Revoked sessions keep this bit, see SESSION_IS_REVOKED.
+	SESSION_PERSIST    uint = 1 // If the second bit is set, the user asked to be remembered, and the session lasts for 30 days instead of 24 hours.
+	SESSION_IS_REVOKED uint = 2 // If the third bit is set, the session has been revoked. Sessions without it are valid until they expire.
+	_                  uint = 3
+	_                  uint = 4 // _ bit values are reserved for future use.
+	_                  uint = 5
+	_                  uint = 6
+	_                  uint = 7
+)
+
+// TOTP (authenticator app) flags
+const (
+	TOTP_IS_ENABLED uint = 0 // If the first bit is set, the secret has been confirmed and the user must enter a TOTP code to log in.
+	_               uint = 1
+	_               uint = 2
+	_               uint = 3
+	_               uint = 4 // _ bit values are reserved for future use.
+	_               uint = 5
+	_               uint = 6
+	_               uint = 7
 )
 
 // Admin account flags
@@ -65,14 +88,40 @@ const (
 	_                    uint = 7
 )
 
+// GameFlagNames maps the names of the game flags that developers may change to their bits.
+var GameFlagNames = map[string]uint{
+	"active":          GAME_IS_ACTIVE,
+	"supports_disk":   GAME_SUPPORTS_DISK,
+	"supports_voice":  GAME_SUPPORTS_VOICE,
+	"mature":          GAME_IS_MATURE,
+	"uses_other_auth": GAME_USES_OTHER_AUTH,
+}
+
+// Game API key scopes
+const (
+	APIKEY_CAN_READ_LOBBIES uint = 0 // If the first bit is set, the key can read the state of the game's lobbies.
+	_                       uint = 1
+	_                       uint = 2
+	_                       uint = 3
+	_                       uint = 4 // _ bit values are reserved for future use.
+	_                       uint = 5
+	_                       uint = 6
+	_                       uint = 7
+)
+
+// APIKeyScopeNames maps the names of game API key scopes to their bits.
+var APIKeyScopeNames = map[string]uint{
+	"lobbies.read": APIKEY_CAN_READ_LOBBIES,
+}
+
 // Developer member flags
 const (
-	DEVMEMBER_IS_ACTIVE uint = 0 // If the first bit is set, the developer member is active (set false to revoke access).
-	_                   uint = 1
-	_                   uint = 2
-	_                   uint = 3
-	_                   uint = 4 // _ bit values are reserved for future use.
-	_                   uint = 5
-	_                   uint = 6
-	DEVMEMBER_IS_OWNER  uint = 7 // If the last bit is set, the developer member is the owner of the developer account.
+	DEVMEMBER_IS_ACTIVE  uint = 0 // If the first bit is set, the developer member is active (set false to revoke access).
+	DEVMEMBER_IS_ADMIN   uint = 1 // If the second bit is set, the developer member is an admin of the developer account.
+	DEVMEMBER_IS_EDITOR  uint = 2 // If the third bit is set, the developer member is an editor of the developer account.
+	DEVMEMBER_IS_INVITED uint = 3 // If the fourth bit is set, the developer member has been invited but hasn't accepted yet.
+	_                    uint = 4 // _ bit values are reserved for future use.
+	_                    uint = 5
+	_                    uint = 6
+	DEVMEMBER_IS_OWNER   uint = 7 // If the last bit is set, the developer member is the owner of the developer account.
 )
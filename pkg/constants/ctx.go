@@ -3,5 +3,6 @@ package constants
 // Define custom type for context key, used for avoiding collisions
 type CtxKey string
 
-// Declare global constant for context key
+// Declare global constants for context keys
 const DataMgrCtx CtxKey = "dm"
+const GameAPIKeyCtx CtxKey = "apikey" // The game API key of a request, set by the game API key middleware
@@ -0,0 +1,58 @@
+package constants
+
+import "github.com/cloudlink-omega/backend/pkg/bitfield"
+
+/*
+	Developer member roles
+	Roles are stored in the state of each developer member (see the developer member flags), and are ordered from
+	least to most access. Each role can do everything the roles before it can.
+*/
+
+const (
+	DEVROLE_VIEWER uint8 = 0 // Can view the games and members of the developer account.
+	DEVROLE_EDITOR uint8 = 1 // Can also create and change games, and manage their authorized origins.
+	DEVROLE_ADMIN  uint8 = 2 // Can also deactivate games, and invite, change and remove viewers and editors.
+	DEVROLE_OWNER  uint8 = 3 // Can also manage admins and transfer ownership. Every developer account has exactly one owner.
+)
+
+// DeveloperRoleNames are the names of the developer member roles used by the API, indexed by role.
+var DeveloperRoleNames = []string{"viewer", "editor", "admin", "owner"}
+
+// DeveloperRole reads the role of a developer member from its state.
+func DeveloperRole(state bitfield.Bitfield8) uint8 {
+	switch {
+	case state.Read(DEVMEMBER_IS_OWNER):
+		return DEVROLE_OWNER
+	case state.Read(DEVMEMBER_IS_ADMIN):
+		return DEVROLE_ADMIN
+	case state.Read(DEVMEMBER_IS_EDITOR):
+		return DEVROLE_EDITOR
+	default:
+		return DEVROLE_VIEWER
+	}
+}
+
+// SetDeveloperRole replaces the role stored in the state of a developer member. Other flags are kept.
+func SetDeveloperRole(state *bitfield.Bitfield8, role uint8) {
+	state.Clear(DEVMEMBER_IS_OWNER)
+	state.Clear(DEVMEMBER_IS_ADMIN)
+	state.Clear(DEVMEMBER_IS_EDITOR)
+	switch role {
+	case DEVROLE_OWNER:
+		state.Set(DEVMEMBER_IS_OWNER)
+	case DEVROLE_ADMIN:
+		state.Set(DEVMEMBER_IS_ADMIN)
+	case DEVROLE_EDITOR:
+		state.Set(DEVMEMBER_IS_EDITOR)
+	}
+}
+
+// ParseDeveloperRole finds a developer member role by name.
+func ParseDeveloperRole(name string) (uint8, bool) {
+	for role, roleName := range DeveloperRoleNames {
+		if roleName == name {
+			return uint8(role), true
+		}
+	}
+	return 0, false
+}
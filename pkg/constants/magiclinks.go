@@ -6,8 +6,50 @@ package constants
 */
 
 const (
-	LINKMODE_EMAIL     uint8 = 0   // Link mode for verifying or unsubscribing an email. Used for welcome emails.
-	LINKMODE_PASSWORD  uint8 = 1   // Link mode for resetting passwords.
-	LINKMODE_DEVELOPER uint8 = 2   // Link mode for admin approve/deny developer account requests.
-	LINKMODE_UNDEFINED uint8 = 255 // Default link mode.
+	LINKMODE_EMAIL       uint8 = 0   // Link mode for verifying an email. Used for welcome emails.
+	LINKMODE_PASSWORD    uint8 = 1   // Link mode for resetting passwords.
+	LINKMODE_DEVELOPER   uint8 = 2   // Link mode for admin approve/deny developer account requests.
+	LINKMODE_UNSUBSCRIBE uint8 = 3   // Link mode for unsubscribing an email. Used for the footer of every email.
+	LINKMODE_REVOKE      uint8 = 4   // Link mode for revoking a session and the sessions refreshed from it. Used for new login notifications.
+	LINKMODE_INVITE      uint8 = 5   // Link mode for accepting an invitation to join a developer account.
+	LINKMODE_REVOKE_ALL  uint8 = 6   // Link mode for revoking every session of a user. Used for password reset emails.
+	LINKMODE_UNDEFINED   uint8 = 255 // Default link mode.
 )
+
+/*
+	Magic link lifetimes
+	These constants define how many seconds a magic link of each mode is valid for.
+*/
+
+const (
+	LINKLIFETIME_EMAIL       int64 = 7 * 24 * 60 * 60  // 7 days
+	LINKLIFETIME_PASSWORD    int64 = 30 * 60           // 30 minutes
+	LINKLIFETIME_DEVELOPER   int64 = 14 * 24 * 60 * 60 // 14 days
+	LINKLIFETIME_UNSUBSCRIBE int64 = 90 * 24 * 60 * 60 // 90 days
+	LINKLIFETIME_REVOKE      int64 = 30 * 24 * 60 * 60 // 30 days (as long as a persistent session)
+	LINKLIFETIME_INVITE      int64 = 7 * 24 * 60 * 60  // 7 days
+	LINKLIFETIME_REVOKE_ALL  int64 = 7 * 24 * 60 * 60  // 7 days
+	LINKLIFETIME_UNDEFINED   int64 = 24 * 60 * 60      // 1 day
+)
+
+// MagicLinkLifetime returns how many seconds a magic link of the given mode is valid for.
+func MagicLinkLifetime(mode uint8) int64 {
+	switch mode {
+	case LINKMODE_EMAIL:
+		return LINKLIFETIME_EMAIL
+	case LINKMODE_PASSWORD:
+		return LINKLIFETIME_PASSWORD
+	case LINKMODE_DEVELOPER:
+		return LINKLIFETIME_DEVELOPER
+	case LINKMODE_UNSUBSCRIBE:
+		return LINKLIFETIME_UNSUBSCRIBE
+	case LINKMODE_REVOKE:
+		return LINKLIFETIME_REVOKE
+	case LINKMODE_INVITE:
+		return LINKLIFETIME_INVITE
+	case LINKMODE_REVOKE_ALL:
+		return LINKLIFETIME_REVOKE_ALL
+	default:
+		return LINKLIFETIME_UNDEFINED
+	}
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"crypto/subtle"
+	"time"
+
+	accounts "github.com/cloudlink-omega/backend/pkg/accounts"
+	"github.com/cloudlink-omega/backend/pkg/bitfield"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// APIKeyLastUsedInterval is how often the last-used time of a game API key is written. Keys used more often than
+// this don't cause a write on every request.
+var APIKeyLastUsedInterval = time.Minute
+
+// CreateGameAPIKey creates an API key for a game. Returns the key, which can't be recovered later, and its details.
+func (mgr *Manager) CreateGameAPIKey(gameid string, name string, scopes bitfield.Bitfield8) (string, *structs.GameAPIKeyQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return "", nil, errors.ErrAuthlessMode
+	}
+
+	id, secret, key, err := accounts.GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	apikey := &structs.GameAPIKeyQuery{
+		ID:      id,
+		GameID:  gameid,
+		Name:    name,
+		Hash:    accounts.HashAPIKeySecret(secret),
+		Scopes:  scopes,
+		Created: time.Now().Unix(),
+	}
+
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("game_api_keys").
+		Cols("id", "gameid", "name", "hash", "scopes", "created").
+		Values(apikey.ID, apikey.GameID, apikey.Name, apikey.Hash, uint8(apikey.Scopes), apikey.Created)
+	if _, err := mgr.RunInsertQuery(qy); err != nil {
+		return "", nil, err
+	}
+	return key, apikey, nil
+}
+
+// GetGameAPIKeys returns every API key of a game, oldest first.
+func (mgr *Manager) GetGameAPIKeys(gameid string) ([]*structs.GameAPIKeyQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "gameid", "name", "hash", "scopes", "created", "lastused").
+		From("game_api_keys").
+		Where(
+			qy.E("gameid", gameid),
+		).
+		OrderBy("created").Asc()
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	apikeys := []*structs.GameAPIKeyQuery{}
+	for res.Next() {
+		apikey := &structs.GameAPIKeyQuery{}
+		if err := res.Scan(&apikey.ID, &apikey.GameID, &apikey.Name, &apikey.Hash, &apikey.Scopes, &apikey.Created, &apikey.LastUsed); err != nil {
+			return nil, err
+		}
+		apikeys = append(apikeys, apikey)
+	}
+	return apikeys, nil
+}
+
+// RevokeGameAPIKey deletes an API key of a game. The key stops working immediately.
+func (mgr *Manager) RevokeGameAPIKey(gameid string, keyid string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("game_api_keys").
+		Where(
+			qy.E("id", keyid),
+			qy.E("gameid", gameid),
+		)
+	res, err := mgr.RunDeleteQuery(qy)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// VerifyGameAPIKey finds the game API key matching a key sent by a client, and records that it was used.
+// Returns ErrAPIKeyInvalid if the key is malformed, unknown or revoked.
+func (mgr *Manager) VerifyGameAPIKey(key string) (*structs.GameAPIKeyQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	id, secret, ok := accounts.ParseAPIKey(key)
+	if !ok {
+		return nil, errors.ErrAPIKeyInvalid
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "gameid", "name", "hash", "scopes", "created", "lastused").
+		From("game_api_keys").
+		Where(
+			qy.E("id", id),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	apikey := &structs.GameAPIKeyQuery{}
+	if res.Next() {
+		if err := res.Scan(&apikey.ID, &apikey.GameID, &apikey.Name, &apikey.Hash, &apikey.Scopes, &apikey.Created, &apikey.LastUsed); err != nil {
+			res.Close()
+			return nil, err
+		}
+	} else {
+		res.Close()
+		return nil, errors.ErrAPIKeyInvalid
+	}
+	res.Close()
+
+	if subtle.ConstantTimeCompare([]byte(accounts.HashAPIKeySecret(secret)), []byte(apikey.Hash)) != 1 {
+		return nil, errors.ErrAPIKeyInvalid
+	}
+
+	// Record when the key was used, at most once per interval
+	now := time.Now()
+	if now.Unix()-apikey.LastUsed >= int64(APIKeyLastUsedInterval.Seconds()) {
+		apikey.LastUsed = now.Unix()
+		up := sqlbuilder.NewUpdateBuilder()
+		up.Update("game_api_keys").
+			Set(
+				up.Assign("lastused", apikey.LastUsed),
+			).
+			Where(
+				up.E("id", apikey.ID),
+			).
+			Limit(1)
+		if _, err := mgr.RunUpdateQuery(up); err != nil {
+			return nil, err
+		}
+	}
+	return apikey, nil
+}
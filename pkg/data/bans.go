@@ -0,0 +1,161 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// BanUser bans a user, and revokes every session token of the user.
+//
+// userid - The ID of the user to ban.
+// admin - The ID of the admin issuing the ban.
+// reason - Why the user was banned, shown to the user.
+// expires - When the ban is lifted (UNIX time), 0 for a permanent ban.
+// appeal - How the user can appeal the ban, shown to the user.
+func (mgr *Manager) BanUser(userid string, admin string, reason string, expires int64, appeal string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	// Updates only count the rows they change, so a user who is already banned can't be told apart from one who doesn't exist
+	if _, err := mgr.GetUserByID(userid); err != nil {
+		return err
+	}
+
+	// UPDATE users SET state = state | USER_IS_BANNED WHERE id = (userid)
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("users").
+		Set(
+			fmt.Sprintf("state = state | %d", 1<<constants.USER_IS_BANNED),
+		).
+		Where(
+			qy.E("id", userid),
+		).
+		Limit(1)
+	if _, err := mgr.RunUpdateQuery(qy); err != nil {
+		return err
+	}
+
+	// Replace any previous ban
+	if err := mgr.deleteBan(userid); err != nil {
+		return err
+	}
+	ins := sqlbuilder.NewInsertBuilder().
+		InsertInto("user_bans").
+		Cols("userid", "reason", "admin", "expires", "appeal").
+		Values(userid, reason, admin, expires, appeal)
+	if _, err := mgr.RunInsertQuery(ins); err != nil {
+		return err
+	}
+
+	return mgr.RevokeAllSessions(userid)
+}
+
+// UnbanUser lifts the ban of a user.
+func (mgr *Manager) UnbanUser(userid string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	// Updates only count the rows they change, so a user who isn't banned can't be told apart from one who doesn't exist
+	if _, err := mgr.GetUserByID(userid); err != nil {
+		return err
+	}
+
+	// UPDATE users SET state = state & ~USER_IS_BANNED WHERE id = (userid)
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("users").
+		Set(
+			fmt.Sprintf("state = state & %d", 0xff&^(1<<constants.USER_IS_BANNED)),
+		).
+		Where(
+			qy.E("id", userid),
+		).
+		Limit(1)
+	if _, err := mgr.RunUpdateQuery(qy); err != nil {
+		return err
+	}
+
+	return mgr.deleteBan(userid)
+}
+
+// GetBan returns the ban of a user, or ErrBanNotFound if the user has no ban details.
+func (mgr *Manager) GetBan(userid string) (*structs.BanQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("reason", "admin", "expires", "appeal", "created").
+		From("user_bans").
+		Where(
+			qy.E("userid", userid),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	ban := &structs.BanQuery{UserID: userid}
+	if res.Next() {
+		if err := res.Scan(&ban.Reason, &ban.Admin, &ban.Expires, &ban.Appeal, &ban.Created); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrBanNotFound
+	}
+	return ban, nil
+}
+
+// CheckUserStanding checks if a user may use their account.
+//
+// Returns ErrUserBlocked if the account has been disabled, or ErrUserBanned and the ban details if the user is banned.
+// Users banned without ban details are banned permanently. Temporary bans are lifted once they expire.
+func (mgr *Manager) CheckUserStanding(userid string) (*structs.BanQuery, error) {
+	user, err := mgr.GetUserByID(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.State.Read(constants.USER_IS_BLOCKED) {
+		return nil, errors.ErrUserBlocked
+	}
+	if !user.State.Read(constants.USER_IS_BANNED) {
+		return nil, nil
+	}
+
+	ban, err := mgr.GetBan(userid)
+	if err == errors.ErrBanNotFound {
+		return &structs.BanQuery{UserID: userid}, errors.ErrUserBanned
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Lift expired temporary bans
+	if ban.Expires != 0 && ban.Expires <= time.Now().Unix() {
+		if err := mgr.UnbanUser(userid); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return ban, errors.ErrUserBanned
+}
+
+// deleteBan deletes the ban details of a user.
+func (mgr *Manager) deleteBan(userid string) error {
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("user_bans").Where(qy.E("userid", userid))
+	_, err := mgr.RunDeleteQuery(qy)
+	return err
+}
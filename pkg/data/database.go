@@ -2,8 +2,10 @@ package data
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/cloudlink-omega/backend/pkg/constants"
 	errors "github.com/cloudlink-omega/backend/pkg/errors"
@@ -161,37 +163,180 @@ func (mgr *Manager) GetUserID(email string) (string, error) {
 	return userid, nil
 }
 
+// GetUserByEmail retrieves the ID, username, email and state of the user with the given email.
+//
+// email string - the email of the user
+// *structs.UserQuery, error - the user and any error encountered
+func (mgr *Manager) GetUserByEmail(email string) (*structs.UserQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "username", "email", "state").
+		From("users").
+		Where(
+			qy.E("email", email),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	user := &structs.UserQuery{}
+	if res.Next() {
+		if err := res.Scan(&user.ID, &user.Username, &user.Email, &user.State); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// GetUserLoginByEmail retrieves the ID, username, email, state and password hash of the user with the given email,
+// in a single query so that logins take the same time whether or not the user exists.
+//
+// email string - the email of the user
+// *structs.UserQuery, error - the user and any error encountered
+func (mgr *Manager) GetUserLoginByEmail(email string) (*structs.UserQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "username", "email", "state", "password").
+		From("users").
+		Where(
+			qy.E("email", email),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	user := &structs.UserQuery{}
+	if res.Next() {
+		if err := res.Scan(&user.ID, &user.Username, &user.Email, &user.State, &user.Password); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// GetUserByID retrieves the ID, username, email and state of the user with the given ID.
+//
+// userid string - the ID of the user
+// *structs.UserQuery, error - the user and any error encountered
+func (mgr *Manager) GetUserByID(userid string) (*structs.UserQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "username", "email", "state", "created").
+		From("users").
+		Where(
+			qy.E("id", userid),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	user := &structs.UserQuery{}
+	if res.Next() {
+		if err := res.Scan(&user.ID, &user.Username, &user.Email, &user.State, &user.Created); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// UpdateUserPassword replaces the password hash of a user.
+func (mgr *Manager) UpdateUserPassword(userid string, hash string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("users").
+		Set(
+			qy.Assign("password", hash),
+		).
+		Where(
+			qy.E("id", userid),
+		).
+		Limit(1)
+
+	// Run the query
+	res, err := mgr.RunUpdateQuery(qy)
+	if err != nil {
+		return err
+	}
+
+	// Check if any rows were updated
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrUserNotFound
+	}
+	return nil
+}
+
+// RevokeAllSessions revokes every session token of a user, logging the user out everywhere.
+func (mgr *Manager) RevokeAllSessions(userid string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("sessions").
+		Set(
+			fmt.Sprintf("state = state | %d", 1<<constants.SESSION_IS_REVOKED),
+		).
+		Where(
+			qy.E("userid", userid),
+		)
+	_, err := mgr.RunUpdateQuery(qy)
+	return err
+}
+
 // GenerateSessionToken generates a session token for the given user ID and origin.
 //
 // userid: string representing the user ID
 // origin: string representing the origin of the session
+// persist: bool, true if the session should last for PersistentSessionLifetime instead of SessionLifetime
 // string: the generated session token
 // error: an error, if any
-func (mgr *Manager) GenerateSessionToken(userid string, origin string) (string, error) {
-	usertoken := ulid.Make().String()
+func (mgr *Manager) GenerateSessionToken(userid string, origin string, persist bool) (string, error) {
 
 	// Bypass insert if in authless mode
 	if mgr.AuthlessMode {
+		usertoken := ulid.Make().String()
 		mgr.AuthlessUserMap[usertoken] = userid
 		return usertoken, nil
 	}
 
-	qy := sqlbuilder.NewInsertBuilder().
-		InsertInto("sessions").
-		Cols("id", "userid", "origin").
-		Values(usertoken, userid, origin)
-	res, err := mgr.RunInsertQuery(qy)
-	if err != nil {
-		return "", err
-	}
-	rows, _ := res.RowsAffected()
-	if rows != 1 {
-		return "", errors.ErrDatabaseError
-	}
-	return usertoken, nil
+	return mgr.createSession(userid, origin, persist, "")
 }
 
 // GenerateMagicLink generates a magic link token for the given user ID and mode.
+// The token expires after the lifetime of the mode (see constants.MagicLinkLifetime).
 //
 // userid: uint64 representing the user ID
 // mode: uint8 representing the mode of the magic link
@@ -199,6 +344,12 @@ func (mgr *Manager) GenerateSessionToken(userid string, origin string) (string,
 // string: the generated magic link token
 // error: an error, if any
 func (mgr *Manager) GenerateMagicLink(userid string, mode uint8) (string, error) {
+	return mgr.GenerateMagicLinkFor(userid, mode, "")
+}
+
+// GenerateMagicLinkFor generates a magic link token that can only be used on one subject, i.e. the developer account
+// an admin is asked to review. Use GetMagicLinkSubject to check the subject when the link is used.
+func (mgr *Manager) GenerateMagicLinkFor(userid string, mode uint8, subject string) (string, error) {
 	token := ulid.Make().String()
 
 	// Cannot work in authless mode
@@ -208,8 +359,8 @@ func (mgr *Manager) GenerateMagicLink(userid string, mode uint8) (string, error)
 
 	qy := sqlbuilder.NewInsertBuilder().
 		InsertInto("magic_links").
-		Cols("id", "mode", "userid").
-		Values(token, mode, userid)
+		Cols("id", "mode", "userid", "subject", "expires").
+		Values(token, mode, userid, subject, time.Now().Unix()+constants.MagicLinkLifetime(mode))
 	res, err := mgr.RunInsertQuery(qy)
 	if err != nil {
 		return "", err
@@ -221,6 +372,32 @@ func (mgr *Manager) GenerateMagicLink(userid string, mode uint8) (string, error)
 	return token, nil
 }
 
+// GetMagicLinkSubject returns the ID of the subject a magic link token was generated for, or an empty string
+// if the token can be used on anything.
+func (mgr *Manager) GetMagicLinkSubject(token string) (string, error) {
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return "", errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("subject").From("magic_links").Where(qy.E("id", token))
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return "", err
+	}
+	defer res.Close()
+
+	var subject string
+	if !res.Next() {
+		return "", errors.ErrLinkNotFound
+	}
+	if err := res.Scan(&subject); err != nil {
+		return "", err
+	}
+	return subject, nil
+}
+
 // DestroyMagicLink removes a magic link token from the database.
 func (mgr *Manager) DestroyMagicLink(token string) error {
 	// Cannot work in authless mode
@@ -237,6 +414,22 @@ func (mgr *Manager) DestroyMagicLink(token string) error {
 	return nil
 }
 
+// DestroyAllMagicLinks removes every magic link token of a user that uses the given mode.
+func (mgr *Manager) DestroyAllMagicLinks(userid string, mode uint8) error {
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("magic_links").Where(
+		qy.E("userid", userid),
+		qy.E("mode", mode),
+	)
+	_, err := mgr.RunDeleteQuery(qy)
+	return err
+}
+
 // newSaveSlotEntry saves a new slot entry to the database.
 //
 // Parameters:
@@ -453,19 +646,22 @@ func (mgr *Manager) ReadSaveSlot(slotnumber uint8, userid string, ugi string) (s
 
 // VerifyUGI is a function that verifies the given UGI (Unique Game Identifier).
 //
-// It takes a parameter ugi string and returns an error.
-func (mgr *Manager) VerifyUGI(ugi string) (string, string, error) {
+// It returns the names of the game and its developer, along with both of their states. Games that are inactive, or
+// belong to an inactive developer account, are refused with ErrGameInactive or ErrDeveloperInactive.
+func (mgr *Manager) VerifyUGI(ugi string) (*structs.UGIQuery, error) {
 
 	// Bypass UGI check if in authless mode
 	if mgr.AuthlessMode {
 		// TODO: somehow allow sysadmin to customize these parameters in authless mode
-		return "", "", nil
+		return &structs.UGIQuery{}, nil
 	}
 
 	qy := sqlbuilder.NewSelectBuilder()
 	qy.Select(
 		qy.As("g.name", "gameName"),
 		qy.As("d.name", "developerName"),
+		qy.As("g.state", "gameState"),
+		qy.As("d.state", "developerState"),
 	).
 		From("games g", "developers d").
 		Where(
@@ -473,30 +669,36 @@ func (mgr *Manager) VerifyUGI(ugi string) (string, string, error) {
 			qy.And("g.developerid = d.id"),
 		)
 
-	if res, err := mgr.RunSelectQuery(qy); err != nil {
-		res.Close()
-		return "", "", err
-	} else {
-		var gameName string
-		var developerName string
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
 
-		// Check if there's any output from the query (there should be 1 row if the game exists)
-		if !res.Next() {
-			return "", "", errors.ErrGameNotFound
-		}
-		// Scan the output into the variables
-		if err := res.Scan(&gameName, &developerName); err != nil {
-			return "", "", err
-		}
+	// Check if there's any output from the query (there should be 1 row if the game exists)
+	if !res.Next() {
+		return nil, errors.ErrGameNotFound
+	}
 
-		res.Close()
-		return gameName, developerName, nil
+	// Scan the output into the variables
+	game := &structs.UGIQuery{}
+	if err := res.Scan(&game.GameName, &game.DeveloperName, &game.GameState, &game.DeveloperState); err != nil {
+		return nil, err
+	}
+
+	if !game.DeveloperState.Read(constants.DEVELOPER_IS_ACTIVE) {
+		return nil, errors.ErrDeveloperInactive
+	}
+	if !game.GameState.Read(constants.GAME_IS_ACTIVE) {
+		return nil, errors.ErrGameInactive
 	}
+	return game, nil
 }
 
 // VerifyMagicToken verifies a magic link token.
 //
 // It takes a linktoken string as a parameter and returns a client struct or an error.
+// Expired tokens return errors.ErrLinkExpired.
 func (mgr *Manager) VerifyMagicToken(linktoken string) (*structs.Client, uint8, error) {
 
 	// This does not work in authless mode
@@ -511,6 +713,8 @@ func (mgr *Manager) VerifyMagicToken(linktoken string) (*structs.Client, uint8,
 		qy.As("u.id", "userid"),
 		qy.As("u.state", "state"),
 		qy.As("m.mode", "mode"),
+		qy.As("m.created", "created"),
+		qy.As("m.expires", "expires"),
 	).
 		From("magic_links m", "users u").
 		Where(
@@ -518,6 +722,8 @@ func (mgr *Manager) VerifyMagicToken(linktoken string) (*structs.Client, uint8,
 			qy.And("u.id = m.userid"),
 		)
 	var linkmode uint8
+	var created int64
+	var expires sql.NullInt64
 	client := &structs.Client{}
 	res, err := mgr.RunSelectQuery(qy)
 	if err != nil {
@@ -526,12 +732,20 @@ func (mgr *Manager) VerifyMagicToken(linktoken string) (*structs.Client, uint8,
 	}
 	defer res.Close()
 	if res.Next() {
-		if err := res.Scan(&client.Username, &client.Email, &client.ULID, &client.UserState, &linkmode); err != nil {
+		if err := res.Scan(&client.Username, &client.Email, &client.ULID, &client.UserState, &linkmode, &created, &expires); err != nil {
 			return nil, constants.LINKMODE_UNDEFINED, err
 		}
 	} else {
 		return nil, constants.LINKMODE_UNDEFINED, errors.ErrLinkNotFound
 	}
+
+	// Links created before expiry times were stored expire after the lifetime of their mode
+	if !expires.Valid {
+		expires.Int64 = created + constants.MagicLinkLifetime(linkmode)
+	}
+	if expires.Int64 < time.Now().Unix() {
+		return nil, linkmode, errors.ErrLinkExpired
+	}
 	return client, linkmode, nil
 }
 
@@ -589,6 +803,9 @@ func (mgr *Manager) VerifySessionToken(usertoken string) (*structs.Client, error
 	} else {
 		return nil, errors.ErrSessionNotFound
 	}
+	if client.SessionState.Read(constants.SESSION_IS_REVOKED) {
+		return nil, errors.ErrSessionRevoked
+	}
 	return client, nil
 }
 
@@ -628,6 +845,9 @@ func (mgr *Manager) GetSessionInfoFromToken(usertoken string) (*structs.Session,
 	} else {
 		return nil, errors.ErrSessionNotFound
 	}
+	if session.State.Read(constants.SESSION_IS_REVOKED) {
+		return nil, errors.ErrSessionRevoked
+	}
 	return session, nil
 }
 
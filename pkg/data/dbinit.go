@@ -19,12 +19,21 @@ func (mgr *Manager) InitDB() {
 	mgr.createGamesTable()
 	mgr.createAdminsTable()
 	mgr.createSessionsTable()
+	mgr.createSessionFamiliesTable()
 	mgr.createSavesTable()
 	mgr.createGamesAuthorizedOriginsTable()
 	mgr.createDeveloperMembersTable()
 	mgr.createIPWhitelistTable()
 	mgr.createIPBlocklistTable()
 	mgr.createMagicLinksTable()
+	mgr.createUsersTOTPTable()
+	mgr.createRecoveryCodesTable()
+	mgr.createLoginChallengesTable()
+	mgr.createUserBansTable()
+	mgr.createLoginThrottleTable()
+	mgr.createGameAPIKeysTable()
+	mgr.createSchemaMigrationsTable()
+	mgr.runMigrations()
 	log.Print("[DB] Ready!")
 }
 
@@ -72,6 +81,10 @@ func (mgr *Manager) createDevelopersTable() {
 			`name`,
 			`TINYTEXT NOT NULL DEFAULT ''`, // 255 maximum length
 		).
+		Define(
+			`description`,
+			`TINYTEXT NOT NULL DEFAULT ''`, // 255 maximum length
+		).
 		Define(
 			`state`,
 			`TINYINT unsigned NOT NULL DEFAULT 0`,
@@ -161,6 +174,32 @@ func (mgr *Manager) createSessionsTable() {
 	mgr.buildTable("sessions", sb)
 }
 
+func (mgr *Manager) createSessionFamiliesTable() {
+	sb := sqlbuilder.NewCreateTableBuilder()
+	sb.CreateTable("session_families").IfNotExists().
+		Define(
+			`id`,
+			`CHAR(26) PRIMARY KEY UNIQUE NOT NULL`, // ULID string, session token
+		).
+		Define(
+			`family`,
+			`CHAR(26) NOT NULL`, // ULID string, the first session token of the family. Refreshed tokens inherit the family of the old token.
+		).
+		Define(
+			`userid`,
+			`CHAR(26) NOT NULL REFERENCES users(id) ON DELETE CASCADE`, // ULID string
+		).
+		Define(
+			`rotated`,
+			`BIGINT NOT NULL DEFAULT 0`, // UNIX Timestamp of when the token was refreshed, or 0 if it hasn't been refreshed
+		).
+		Define(
+			`expires`,
+			`BIGINT NOT NULL`, // UNIX Timestamp, same as the session
+		)
+	mgr.buildTable("session_families", sb)
+}
+
 func (mgr *Manager) createSavesTable() {
 	sb := sqlbuilder.NewCreateTableBuilder()
 	sb.CreateTable("saves").IfNotExists().
@@ -188,7 +227,7 @@ func (mgr *Manager) createGamesAuthorizedOriginsTable() {
 	sb.CreateTable("games_authorized_origins").IfNotExists().
 		Define(
 			`gameid`,
-			`CHAR(26) NOT NULL REFERENCES games(id)`, // ULID string
+			`CHAR(26) NOT NULL REFERENCES games(id) ON DELETE CASCADE`, // ULID string
 		).
 		Define(
 			`origin`,
@@ -214,7 +253,11 @@ func (mgr *Manager) createDeveloperMembersTable() {
 		).
 		Define(
 			`description`,
-			`TINYTEXT NOT NULL`, // ULID string
+			`TINYTEXT NOT NULL DEFAULT ''`,
+		).
+		Define(
+			`state`,
+			`TINYINT unsigned NOT NULL DEFAULT 0`,
 		)
 	mgr.buildTable("developer_members", sb)
 }
@@ -224,7 +267,19 @@ func (mgr *Manager) createIPBlocklistTable() {
 	sb.CreateTable("ip_blocklist").IfNotExists().
 		Define(
 			`address`,
-			`TINYTEXT NOT NULL`, // IP address
+			`TINYTEXT NOT NULL`, // IP address or CIDR range
+		).
+		Define(
+			`reason`,
+			`TINYTEXT NOT NULL DEFAULT ''`,
+		).
+		Define(
+			`created`,
+			`BIGINT NOT NULL DEFAULT UNIX_TIMESTAMP()`, // UNIX Timestamp
+		).
+		Define(
+			`expires`,
+			`BIGINT NOT NULL DEFAULT 0`, // UNIX Timestamp, 0 if the entry never expires
 		)
 	mgr.buildTable("ip_blocklist", sb)
 }
@@ -234,7 +289,19 @@ func (mgr *Manager) createIPWhitelistTable() {
 	sb.CreateTable("ip_whitelist").IfNotExists().
 		Define(
 			`address`,
-			`TINYTEXT NOT NULL`, // IP address
+			`TINYTEXT NOT NULL`, // IP address or CIDR range
+		).
+		Define(
+			`reason`,
+			`TINYTEXT NOT NULL DEFAULT ''`,
+		).
+		Define(
+			`created`,
+			`BIGINT NOT NULL DEFAULT UNIX_TIMESTAMP()`, // UNIX Timestamp
+		).
+		Define(
+			`expires`,
+			`BIGINT NOT NULL DEFAULT 0`, // UNIX Timestamp, 0 if the entry never expires
 		)
 	mgr.buildTable("ip_whitelist", sb)
 }
@@ -254,6 +321,10 @@ func (mgr *Manager) createMagicLinksTable() {
 			`userid`,
 			`CHAR(26) NOT NULL REFERENCES users(id) ON DELETE CASCADE`, // ULID string, used for identifying which user the magic link belongs to
 		).
+		Define(
+			`subject`,
+			`CHAR(26) NOT NULL DEFAULT ''`, // ULID string of what the magic link can be used on (i.e. a developer account), or empty
+		).
 		Define(
 			`created`,
 			`BIGINT NOT NULL DEFAULT UNIX_TIMESTAMP()`, // UNIX Timestamp
@@ -264,3 +335,175 @@ func (mgr *Manager) createMagicLinksTable() {
 		)
 	mgr.buildTable("magic_links", sb)
 }
+
+func (mgr *Manager) createUsersTOTPTable() {
+	sb := sqlbuilder.NewCreateTableBuilder()
+	sb.CreateTable("users_totp").IfNotExists().
+		Define(
+			`userid`,
+			`CHAR(26) PRIMARY KEY UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE`, // ULID string
+		).
+		Define(
+			`secret`,
+			`TINYTEXT NOT NULL`, // Base32 encoded TOTP secret
+		).
+		Define(
+			`state`,
+			`TINYINT unsigned NOT NULL DEFAULT 0`,
+		).
+		Define(
+			`laststep`,
+			`BIGINT NOT NULL DEFAULT 0`, // Time step of the last accepted code, used to reject reused codes
+		).
+		Define(
+			`created`,
+			`BIGINT NOT NULL DEFAULT UNIX_TIMESTAMP()`, // UNIX Timestamp
+		)
+	mgr.buildTable("users_totp", sb)
+}
+
+func (mgr *Manager) createRecoveryCodesTable() {
+	sb := sqlbuilder.NewCreateTableBuilder()
+	sb.CreateTable("recovery_codes").IfNotExists().
+		Define(
+			`id`,
+			`CHAR(26) PRIMARY KEY UNIQUE NOT NULL`, // ULID string
+		).
+		Define(
+			`userid`,
+			`CHAR(26) NOT NULL REFERENCES users(id) ON DELETE CASCADE`, // ULID string
+		).
+		Define(
+			`hash`,
+			`TINYTEXT NOT NULL`, // Scrypt hash
+		).
+		Define(
+			`created`,
+			`BIGINT NOT NULL DEFAULT UNIX_TIMESTAMP()`, // UNIX Timestamp
+		)
+	mgr.buildTable("recovery_codes", sb)
+}
+
+func (mgr *Manager) createLoginChallengesTable() {
+	sb := sqlbuilder.NewCreateTableBuilder()
+	sb.CreateTable("login_challenges").IfNotExists().
+		Define(
+			`id`,
+			`CHAR(26) PRIMARY KEY UNIQUE NOT NULL`, // ULID string
+		).
+		Define(
+			`userid`,
+			`CHAR(26) NOT NULL REFERENCES users(id) ON DELETE CASCADE`, // ULID string
+		).
+		Define(
+			`origin`,
+			`TINYTEXT NOT NULL DEFAULT ''`, // Origin of the session that will be created
+		).
+		Define(
+			`code`,
+			`TINYTEXT NOT NULL DEFAULT ''`, // Scrypt hash of the emailed security code, if one was sent
+		).
+		Define(
+			`persist`,
+			`BOOLEAN NOT NULL DEFAULT FALSE`, // Whether the session that will be created should persist ("remember me")
+		).
+		Define(
+			`attempts`,
+			`TINYINT unsigned NOT NULL DEFAULT 0`,
+		).
+		Define(
+			`created`,
+			`BIGINT NOT NULL DEFAULT UNIX_TIMESTAMP()`, // UNIX Timestamp
+		).
+		Define(
+			`expires`,
+			`BIGINT NOT NULL`, // UNIX Timestamp
+		)
+	mgr.buildTable("login_challenges", sb)
+}
+
+func (mgr *Manager) createUserBansTable() {
+	sb := sqlbuilder.NewCreateTableBuilder()
+	sb.CreateTable("user_bans").IfNotExists().
+		Define(
+			`userid`,
+			`CHAR(26) PRIMARY KEY UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE`, // ULID string
+		).
+		Define(
+			`reason`,
+			`TINYTEXT NOT NULL DEFAULT ''`, // Shown to the user
+		).
+		Define(
+			`admin`,
+			`CHAR(26) NOT NULL`, // ULID of the admin that issued the ban
+		).
+		Define(
+			`expires`,
+			`BIGINT NOT NULL DEFAULT 0`, // UNIX Timestamp, 0 for permanent bans
+		).
+		Define(
+			`appeal`,
+			`TINYTEXT NOT NULL DEFAULT ''`, // How the user can appeal the ban, shown to the user
+		).
+		Define(
+			`created`,
+			`BIGINT NOT NULL DEFAULT UNIX_TIMESTAMP()`, // UNIX Timestamp
+		)
+	mgr.buildTable("user_bans", sb)
+}
+
+func (mgr *Manager) createLoginThrottleTable() {
+	sb := sqlbuilder.NewCreateTableBuilder()
+	sb.CreateTable("login_throttle").IfNotExists().
+		Define(
+			`id`,
+			`VARCHAR(255) PRIMARY KEY UNIQUE NOT NULL`, // "email:" followed by an email address, or "ip:" followed by an IP address
+		).
+		Define(
+			`failures`,
+			`INT unsigned NOT NULL DEFAULT 0`,
+		).
+		Define(
+			`last`,
+			`BIGINT NOT NULL DEFAULT 0`, // UNIX Timestamp of the last failed login
+		).
+		Define(
+			`locked`,
+			`BIGINT NOT NULL DEFAULT 0`, // UNIX Timestamp, logins are refused until then
+		)
+	mgr.buildTable("login_throttle", sb)
+}
+
+func (mgr *Manager) createGameAPIKeysTable() {
+	sb := sqlbuilder.NewCreateTableBuilder()
+	sb.CreateTable("game_api_keys").IfNotExists().
+		Define(
+			`id`,
+			`CHAR(26) PRIMARY KEY UNIQUE NOT NULL`, // ULID string, public part of the key
+		).
+		Define(
+			`gameid`,
+			`CHAR(26) NOT NULL REFERENCES games(id) ON DELETE CASCADE`, // ULID string
+		).
+		Define(
+			`name`,
+			`TINYTEXT NOT NULL DEFAULT ''`, // Chosen by the developer, to tell keys apart
+		).
+		Define(
+			`hash`,
+			`CHAR(64) NOT NULL`, // SHA-256 hash of the secret part of the key, hex encoded
+		).
+		Define(
+			`scopes`,
+			`TINYINT unsigned NOT NULL DEFAULT 0`, // Bitfield, see the game API key scopes
+		).
+		Define(
+			`created`,
+			`BIGINT NOT NULL`, // UNIX Timestamp
+		).
+		Define(
+			`lastused`,
+			`BIGINT NOT NULL DEFAULT 0`, // UNIX Timestamp, or 0 if the key hasn't been used
+		)
+	mgr.buildTable("game_api_keys", sb)
+}
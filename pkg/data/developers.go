@@ -0,0 +1,411 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/cloudlink-omega/backend/pkg/bitfield"
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/oklog/ulid/v2"
+)
+
+// CreateDeveloper creates an unverified developer account, owned by the user who applied for it.
+// Returns the ID of the developer account.
+func (mgr *Manager) CreateDeveloper(ownerid string, name string, description string) (string, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return "", errors.ErrAuthlessMode
+	}
+
+	var id = ulid.Make().String()
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("developers").
+		Cols("id", "name", "description").
+		Values(id, name, description)
+	if _, err := mgr.RunInsertQuery(qy); err != nil {
+		return "", err
+	}
+
+	var state bitfield.Bitfield8
+	state.Set(constants.DEVMEMBER_IS_ACTIVE)
+	state.Set(constants.DEVMEMBER_IS_OWNER)
+	member := sqlbuilder.NewInsertBuilder().
+		InsertInto("developer_members").
+		Cols("developerid", "userid", "state").
+		Values(id, ownerid, uint8(state))
+	if _, err := mgr.RunInsertQuery(member); err != nil {
+		mgr.DeleteDeveloper(id)
+		return "", err
+	}
+	return id, nil
+}
+
+// GetDeveloper returns a developer account.
+func (mgr *Manager) GetDeveloper(developerid string) (*structs.DeveloperQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "name", "description", "state", "created").
+		From("developers").
+		Where(
+			qy.E("id", developerid),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	developer := &structs.DeveloperQuery{}
+	if res.Next() {
+		if err := res.Scan(&developer.ID, &developer.Name, &developer.Description, &developer.State, &developer.Created); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrDeveloperNotFound
+	}
+	return developer, nil
+}
+
+// GetDeveloperOwner returns the user who owns a developer account.
+func (mgr *Manager) GetDeveloperOwner(developerid string) (*structs.UserQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("userid").
+		From("developer_members").
+		Where(
+			qy.E("developerid", developerid),
+			qy.NotEqual(fmt.Sprintf("state & %d", 1<<constants.DEVMEMBER_IS_OWNER), 0),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	var userid string
+	if res.Next() {
+		if err := res.Scan(&userid); err != nil {
+			res.Close()
+			return nil, err
+		}
+	} else {
+		res.Close()
+		return nil, errors.ErrUserNotFound
+	}
+	res.Close()
+	return mgr.GetUserByID(userid)
+}
+
+// CountPendingDevelopers counts the developer accounts owned by a user that haven't been verified yet.
+func (mgr *Manager) CountPendingDevelopers(userid string) (int, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return 0, errors.ErrAuthlessMode
+	}
+
+	owned := sqlbuilder.NewSelectBuilder()
+	owned.Select("developerid").
+		From("developer_members").
+		Where(
+			owned.E("userid", userid),
+			owned.NotEqual(fmt.Sprintf("state & %d", 1<<constants.DEVMEMBER_IS_OWNER), 0),
+		)
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("COUNT(*)").
+		From("developers").
+		Where(
+			qy.In("id", owned),
+			qy.E(fmt.Sprintf("state & %d", 1<<constants.DEVELOPER_IS_VERIFIED), 0),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	var count int
+	if res.Next() {
+		if err := res.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// UpdateDeveloperState replaces the state of a developer account.
+func (mgr *Manager) UpdateDeveloperState(developerid string, state bitfield.Bitfield8) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	// Updates only count the rows they change, so check that the developer exists first
+	if _, err := mgr.GetDeveloper(developerid); err != nil {
+		return err
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("developers").
+		Set(
+			qy.Assign("state", uint8(state)),
+		).
+		Where(
+			qy.E("id", developerid),
+		).
+		Limit(1)
+	_, err := mgr.RunUpdateQuery(qy)
+	return err
+}
+
+// DeleteDeveloper deletes a developer account. Its members and games are deleted with it.
+func (mgr *Manager) DeleteDeveloper(developerid string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("developers").Where(qy.E("id", developerid))
+	res, err := mgr.RunDeleteQuery(qy)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrDeveloperNotFound
+	}
+	return nil
+}
+
+// GetAdmins returns every user that is a server admin.
+func (mgr *Manager) GetAdmins() ([]*structs.UserQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "username", "email", "state").
+		From("users").
+		Where(
+			qy.NotEqual(fmt.Sprintf("state & %d", 1<<constants.USER_IS_ADMIN), 0),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	admins := []*structs.UserQuery{}
+	for res.Next() {
+		admin := &structs.UserQuery{}
+		if err := res.Scan(&admin.ID, &admin.Username, &admin.Email, &admin.State); err != nil {
+			return nil, err
+		}
+		admins = append(admins, admin)
+	}
+	return admins, nil
+}
+
+// GetDeveloperMember returns a user's membership of a developer account, including pending invitations.
+func (mgr *Manager) GetDeveloperMember(developerid string, userid string) (*structs.DeveloperMemberQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("m.developerid", "m.userid", "u.username", "m.description", "m.state").
+		From("developer_members m", "users u").
+		Where(
+			qy.E("m.developerid", developerid),
+			qy.E("m.userid", userid),
+			qy.And("m.userid = u.id"),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	member := &structs.DeveloperMemberQuery{}
+	if res.Next() {
+		if err := res.Scan(&member.DeveloperID, &member.UserID, &member.Username, &member.Description, &member.State); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrDeveloperMemberNotFound
+	}
+	return member, nil
+}
+
+// GetDeveloperMembers returns every member of a developer account, including pending invitations.
+func (mgr *Manager) GetDeveloperMembers(developerid string) ([]*structs.DeveloperMemberQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("m.developerid", "m.userid", "u.username", "m.description", "m.state").
+		From("developer_members m", "users u").
+		Where(
+			qy.E("m.developerid", developerid),
+			qy.And("m.userid = u.id"),
+		).
+		OrderBy("u.username").Asc()
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	members := []*structs.DeveloperMemberQuery{}
+	for res.Next() {
+		member := &structs.DeveloperMemberQuery{}
+		if err := res.Scan(&member.DeveloperID, &member.UserID, &member.Username, &member.Description, &member.State); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// AddDeveloperMember adds a user to a developer account. Use DEVMEMBER_IS_INVITED in the state for invitations.
+func (mgr *Manager) AddDeveloperMember(developerid string, userid string, state bitfield.Bitfield8) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("developer_members").
+		Cols("developerid", "userid", "state").
+		Values(developerid, userid, uint8(state))
+	if _, err := mgr.RunInsertQuery(qy); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateDeveloperMemberState replaces the state of a developer member.
+func (mgr *Manager) UpdateDeveloperMemberState(developerid string, userid string, state bitfield.Bitfield8) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("developer_members").
+		Set(
+			qy.Assign("state", uint8(state)),
+		).
+		Where(
+			qy.E("developerid", developerid),
+			qy.E("userid", userid),
+		).
+		Limit(1)
+	if _, err := mgr.RunUpdateQuery(qy); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveDeveloperMember removes a user from a developer account, or withdraws their invitation.
+// Owners can't be removed, so that a developer account always has an owner.
+func (mgr *Manager) RemoveDeveloperMember(developerid string, userid string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("developer_members").
+		Where(
+			qy.E("developerid", developerid),
+			qy.E("userid", userid),
+			qy.E(fmt.Sprintf("state & %d", 1<<constants.DEVMEMBER_IS_OWNER), 0),
+		)
+	res, err := mgr.RunDeleteQuery(qy)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrDeveloperMemberNotFound
+	}
+	return nil
+}
+
+// TransferDeveloperOwnership makes an active member the owner of a developer account. The previous owner becomes an admin.
+//
+// The new owner is promoted before the previous owner is demoted, so the developer account is never left without an owner.
+func (mgr *Manager) TransferDeveloperOwnership(developerid string, from *structs.DeveloperMemberQuery, to *structs.DeveloperMemberQuery) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	if !from.State.Read(constants.DEVMEMBER_IS_OWNER) || !to.State.Read(constants.DEVMEMBER_IS_ACTIVE) || to.State.Read(constants.DEVMEMBER_IS_INVITED) {
+		return errors.ErrOwnershipTransfer
+	}
+
+	newOwner := to.State
+	constants.SetDeveloperRole(&newOwner, constants.DEVROLE_OWNER)
+	if err := mgr.UpdateDeveloperMemberState(developerid, to.UserID, newOwner); err != nil {
+		return err
+	}
+
+	oldOwner := from.State
+	constants.SetDeveloperRole(&oldOwner, constants.DEVROLE_ADMIN)
+	return mgr.UpdateDeveloperMemberState(developerid, from.UserID, oldOwner)
+}
+
+// CountOwnedDevelopers counts the developer accounts owned by a user.
+func (mgr *Manager) CountOwnedDevelopers(userid string) (int, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return 0, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("COUNT(*)").
+		From("developer_members").
+		Where(
+			qy.E("userid", userid),
+			qy.NotEqual(fmt.Sprintf("state & %d", 1<<constants.DEVMEMBER_IS_OWNER), 0),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	var count int
+	if res.Next() {
+		if err := res.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
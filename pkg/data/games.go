@@ -0,0 +1,177 @@
+package data
+
+import (
+	"time"
+
+	"github.com/cloudlink-omega/backend/pkg/bitfield"
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/oklog/ulid/v2"
+)
+
+// CreateGame creates an active game that belongs to a developer account. Returns the UGI of the game.
+func (mgr *Manager) CreateGame(developerid string, name string) (string, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return "", errors.ErrAuthlessMode
+	}
+
+	var state bitfield.Bitfield8
+	state.Set(constants.GAME_IS_ACTIVE)
+
+	var id = ulid.Make().String()
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("games").
+		Cols("id", "developerid", "name", "state", "created").
+		Values(id, developerid, name, uint8(state), time.Now().Unix())
+	if _, err := mgr.RunInsertQuery(qy); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// GetGame returns a game, as long as it belongs to the given developer account.
+func (mgr *Manager) GetGame(developerid string, gameid string) (*structs.GameQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "developerid", "name", "state", "created").
+		From("games").
+		Where(
+			qy.E("id", gameid),
+			qy.E("developerid", developerid),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	game := &structs.GameQuery{}
+	if res.Next() {
+		if err := res.Scan(&game.ID, &game.DeveloperID, &game.Name, &game.State, &game.Created); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrGameNotFound
+	}
+	return game, nil
+}
+
+// GetGames returns every game that belongs to a developer account, oldest first.
+func (mgr *Manager) GetGames(developerid string) ([]*structs.GameQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "developerid", "name", "state", "created").
+		From("games").
+		Where(
+			qy.E("developerid", developerid),
+		).
+		OrderBy("created").Asc()
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	games := []*structs.GameQuery{}
+	for res.Next() {
+		game := &structs.GameQuery{}
+		if err := res.Scan(&game.ID, &game.DeveloperID, &game.Name, &game.State, &game.Created); err != nil {
+			return nil, err
+		}
+		games = append(games, game)
+	}
+	return games, nil
+}
+
+// UpdateGame replaces the name and state of a game.
+func (mgr *Manager) UpdateGame(gameid string, name string, state bitfield.Bitfield8) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("games").
+		Set(
+			qy.Assign("name", name),
+			qy.Assign("state", uint8(state)),
+		).
+		Where(
+			qy.E("id", gameid),
+		).
+		Limit(1)
+	if _, err := mgr.RunUpdateQuery(qy); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddAuthorizedOrigin permits an origin pattern to connect to a game. See utils.OriginAllowed for the pattern format.
+func (mgr *Manager) AddAuthorizedOrigin(gameid string, origin string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	origins, err := mgr.GetAuthorizedOrigins(gameid)
+	if err != nil {
+		return err
+	}
+	for _, existing := range origins {
+		if existing == origin {
+			return errors.ErrOriginExists
+		}
+	}
+
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("games_authorized_origins").
+		Cols("gameid", "origin").
+		Values(gameid, origin)
+	if _, err := mgr.RunInsertQuery(qy); err != nil {
+		return err
+	}
+	mgr.InvalidateAuthorizedOrigins(gameid)
+	return nil
+}
+
+// RemoveAuthorizedOrigin stops an origin pattern from connecting to a game.
+func (mgr *Manager) RemoveAuthorizedOrigin(gameid string, origin string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("games_authorized_origins").
+		Where(
+			qy.E("gameid", gameid),
+			qy.E("origin", origin),
+		)
+	res, err := mgr.RunDeleteQuery(qy)
+	if err != nil {
+		return err
+	}
+	mgr.InvalidateAuthorizedOrigins(gameid)
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrOriginNotFound
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package data
+
+import (
+	"log"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// IPList is the name of a table of IP addresses and CIDR ranges.
+type IPList string
+
+const (
+	IPBlocklist IPList = "ip_blocklist" // Addresses that may not use the server
+	IPAllowlist IPList = "ip_whitelist" // Addresses that are never blocked, and are exempt from rate limits
+)
+
+// IPListCacheTTL is how long the IP lists are cached before they are queried again (i.e. to pick up expired entries
+// and changes made by other servers). Changes made by this server are picked up right away.
+var IPListCacheTTL = time.Minute
+
+type ipListEntry struct {
+	prefix  netip.Prefix
+	expires int64
+}
+
+// Cached IP lists, keyed by table.
+type ipListCache struct {
+	entries map[IPList][]ipListEntry
+	expires time.Time
+	lock    sync.RWMutex
+}
+
+// ParseIPListAddress parses an IP address ("203.0.113.7") or CIDR range ("203.0.113.0/24") into a prefix.
+// Single addresses are treated as a range containing only that address.
+func ParseIPListAddress(address string) (netip.Prefix, error) {
+	address = strings.TrimSpace(address)
+	if strings.Contains(address, "/") {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ipListAddress formats a prefix the way it is stored in the IP lists. Single addresses are stored without a prefix length.
+func ipListAddress(prefix netip.Prefix) string {
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String()
+	}
+	return prefix.String()
+}
+
+// IsIPBlocked returns true if an IP address is on the blocklist and not on the allowlist.
+func (mgr *Manager) IsIPBlocked(address string) bool {
+	return !mgr.ipListContains(IPAllowlist, address) && mgr.ipListContains(IPBlocklist, address)
+}
+
+// IsIPAllowed returns true if an IP address is on the allowlist.
+func (mgr *Manager) IsIPAllowed(address string) bool {
+	return mgr.ipListContains(IPAllowlist, address)
+}
+
+// ipListContains checks if an IP address is in any unexpired range of an IP list.
+func (mgr *Manager) ipListContains(list IPList, address string) bool {
+
+	// There are no IP lists in authless mode
+	if mgr.AuthlessMode {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	now := time.Now().Unix()
+	for _, entry := range mgr.getIPLists()[list] {
+		if entry.expires != 0 && entry.expires <= now {
+			continue
+		}
+		if entry.prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getIPLists returns the cached IP lists, loading them from the database if needed.
+func (mgr *Manager) getIPLists() map[IPList][]ipListEntry {
+	mgr.ipListCache.lock.RLock()
+	if mgr.ipListCache.entries != nil && time.Now().Before(mgr.ipListCache.expires) {
+		defer mgr.ipListCache.lock.RUnlock()
+		return mgr.ipListCache.entries
+	}
+	mgr.ipListCache.lock.RUnlock()
+
+	lists := make(map[IPList][]ipListEntry)
+	for _, list := range []IPList{IPBlocklist, IPAllowlist} {
+		entries, err := mgr.GetIPListEntries(list)
+		if err != nil {
+			log.Printf("[DB] Failed to load %s: %s", list, err)
+
+			// Keep using the previous list rather than letting everyone in
+			mgr.ipListCache.lock.RLock()
+			lists[list] = mgr.ipListCache.entries[list]
+			mgr.ipListCache.lock.RUnlock()
+			continue
+		}
+		for _, entry := range entries {
+			prefix, err := ParseIPListAddress(entry.Address)
+			if err != nil {
+				log.Printf("[DB] Ignoring invalid address \"%s\" in %s: %s", entry.Address, list, err)
+				continue
+			}
+			lists[list] = append(lists[list], ipListEntry{prefix: prefix, expires: entry.Expires})
+		}
+	}
+
+	// Cache the result
+	mgr.ipListCache.lock.Lock()
+	defer mgr.ipListCache.lock.Unlock()
+	mgr.ipListCache.entries = lists
+	mgr.ipListCache.expires = time.Now().Add(IPListCacheTTL)
+	return lists
+}
+
+// invalidateIPLists makes the next IP check reload the IP lists.
+func (mgr *Manager) invalidateIPLists() {
+	mgr.ipListCache.lock.Lock()
+	defer mgr.ipListCache.lock.Unlock()
+	mgr.ipListCache.expires = time.Time{}
+}
+
+// GetIPListEntries returns every entry of an IP list, including expired entries.
+func (mgr *Manager) GetIPListEntries(list IPList) ([]*structs.IPListEntry, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("address", "reason", "created", "expires").
+		From(string(list))
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	entries := []*structs.IPListEntry{}
+	for res.Next() {
+		entry := &structs.IPListEntry{}
+		if err := res.Scan(&entry.Address, &entry.Reason, &entry.Created, &entry.Expires); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// AddIPListEntry adds an IP address or CIDR range to an IP list, replacing any existing entry for it.
+//
+// expires - When the entry is removed (UNIX time), 0 if it never expires.
+func (mgr *Manager) AddIPListEntry(list IPList, address string, reason string, expires int64) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	prefix, err := ParseIPListAddress(address)
+	if err != nil {
+		return errors.ErrInvalidIPAddress
+	}
+
+	if _, err := mgr.deleteIPListEntry(list, ipListAddress(prefix)); err != nil {
+		return err
+	}
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto(string(list)).
+		Cols("address", "reason", "expires").
+		Values(ipListAddress(prefix), reason, expires)
+	if _, err := mgr.RunInsertQuery(qy); err != nil {
+		return err
+	}
+
+	mgr.invalidateIPLists()
+	return nil
+}
+
+// RemoveIPListEntry removes an IP address or CIDR range from an IP list.
+func (mgr *Manager) RemoveIPListEntry(list IPList, address string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	prefix, err := ParseIPListAddress(address)
+	if err != nil {
+		return errors.ErrInvalidIPAddress
+	}
+
+	rows, err := mgr.deleteIPListEntry(list, ipListAddress(prefix))
+	if err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrIPListEntryNotFound
+	}
+
+	mgr.invalidateIPLists()
+	return nil
+}
+
+func (mgr *Manager) deleteIPListEntry(list IPList, address string) (int64, error) {
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom(string(list)).Where(qy.E("address", address))
+	res, err := mgr.RunDeleteQuery(qy)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
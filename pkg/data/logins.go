@@ -0,0 +1,57 @@
+package data
+
+import (
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// IsNewLogin checks the origin of a new session against the origins of a user's other sessions.
+//
+// Returns true if the user has other sessions, but none of them came from the origin of this session.
+func (mgr *Manager) IsNewLogin(userid string, usertoken string) (bool, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return false, errors.ErrAuthlessMode
+	}
+
+	total, err := mgr.countOtherSessions(userid, usertoken, false)
+	if err != nil {
+		return false, err
+	}
+	known, err := mgr.countOtherSessions(userid, usertoken, true)
+	if err != nil {
+		return false, err
+	}
+
+	// The first login of an account is not new to anyone
+	return total > 0 && known == 0, nil
+}
+
+// countOtherSessions counts the sessions of a user other than usertoken, optionally only those from the same origin as usertoken.
+func (mgr *Manager) countOtherSessions(userid string, usertoken string, sameOrigin bool) (int, error) {
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("COUNT(*)").
+		From("sessions").
+		Where(
+			qy.E("userid", userid),
+			qy.NotEqual("id", usertoken),
+		)
+	if sameOrigin {
+		origin := sqlbuilder.NewSelectBuilder()
+		origin.Select("origin").From("sessions").Where(origin.E("id", usertoken))
+		qy.Where(qy.In("origin", origin))
+	}
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	var count int
+	if res.Next() {
+		if err := res.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"net/netip"
+	"strings"
+	"time"
 
+	"github.com/cloudlink-omega/backend/pkg/ratelimit"
 	"github.com/cloudlink-omega/backend/pkg/structs"
 )
 
@@ -14,10 +18,20 @@ type Manager struct {
 	ServerNickname       string
 	EnableEmail          bool
 	MailConfig           structs.MailConfig
+	KeyDBConfig          structs.KeyDBConfig
 	DB                   *sql.DB
 	AuthlessMode         bool
 	UseInMemoryClientMgr bool
-	AuthlessUserMap      map[string]string // ULID session token -> username. Used for authless mode.
+	SignalingIdleTimeout time.Duration             // Signaling connections that don't respond for this long are closed. Zero disables the timeout.
+	SignalingRateLimit   int                       // Messages per second each signaling client may send. Zero disables the limit.
+	SignalingUpgradeRate int                       // Signaling connections per minute each IP address may open. Zero disables the limit.
+	SignalingOpcodeRates map[string]ratelimit.Rate // Overrides the rate limits of specific opcodes. A zero rate removes the limit of an opcode.
+	SignalingStrikeRate  *ratelimit.Rate           // Overrides how many RATE_LIMITED replies a signaling client may receive before it is disconnected.
+	TrustedProxies       []netip.Prefix            // Proxies whose X-Forwarded-For, X-Real-IP and True-Client-IP headers are trusted.
+	AuthlessUserMap      map[string]string         // ULID session token -> username. Used for authless mode.
+	AuthlessOrigins      []string                  // Origin patterns permitted to connect to any game. Used for authless mode.
+	originCache          originCache
+	ipListCache          ipListCache
 }
 
 func New(
@@ -25,7 +39,17 @@ func New(
 	sqlDriver string,
 	sqlUrl string,
 	authlessMode bool,
+	authlessOrigins string,
 	useInMemoryClientMgr bool,
+	keydbHost string,
+	keydbPort int,
+	keydbDB int,
+	signalingIdleTimeout int,
+	signalingRateLimit int,
+	signalingUpgradeRate int,
+	signalingOpcodeRates string,
+	signalingStrikeRate string,
+	trustedProxies string,
 	enableEmail bool,
 	emailPort int,
 	emailServer string,
@@ -37,6 +61,33 @@ func New(
 	// Create background context
 	ctx := context.Background()
 
+	// Parse trusted proxy addresses
+	var proxies []netip.Prefix
+	for _, address := range strings.Split(trustedProxies, ",") {
+		if strings.TrimSpace(address) == "" {
+			continue
+		}
+		prefix, err := ParseIPListAddress(address)
+		if err != nil {
+			log.Fatalf("[Data Manager] Invalid trusted proxy address \"%s\": %s", address, err)
+		}
+		proxies = append(proxies, prefix)
+	}
+
+	// Parse signaling rate limit overrides
+	opcodeRates, err := ratelimit.ParseRates(signalingOpcodeRates)
+	if err != nil {
+		log.Fatalf("[Data Manager] Invalid signaling opcode rate limits: %s", err)
+	}
+	var strikeRate *ratelimit.Rate
+	if strings.TrimSpace(signalingStrikeRate) != "" {
+		rate, err := ratelimit.ParseRate(signalingStrikeRate)
+		if err != nil {
+			log.Fatalf("[Data Manager] Invalid signaling rate limit strikes: %s", err)
+		}
+		strikeRate = &rate
+	}
+
 	if authlessMode {
 		log.Println("[Data Manager] Bypassing DB connection due to authless mode.")
 
@@ -48,7 +99,14 @@ func New(
 			Ctx:                  ctx,
 			AuthlessMode:         true,
 			UseInMemoryClientMgr: useInMemoryClientMgr,
+			SignalingIdleTimeout: time.Duration(signalingIdleTimeout) * time.Second,
+			SignalingRateLimit:   signalingRateLimit,
+			SignalingUpgradeRate: signalingUpgradeRate,
+			SignalingOpcodeRates: opcodeRates,
+			SignalingStrikeRate:  strikeRate,
+			TrustedProxies:       proxies,
 			AuthlessUserMap:      make(map[string]string),
+			AuthlessOrigins:      strings.Split(authlessOrigins, ","),
 			EnableEmail:          enableEmail,
 			MailConfig: structs.MailConfig{
 				Port:     emailPort,
@@ -56,6 +114,11 @@ func New(
 				Username: emailUsername,
 				Password: emailPassword,
 			},
+			KeyDBConfig: structs.KeyDBConfig{
+				Host: keydbHost,
+				Port: keydbPort,
+				DB:   keydbDB,
+			},
 		}
 	}
 
@@ -83,6 +146,12 @@ func New(
 		Ctx:                  ctx,
 		AuthlessMode:         false,
 		UseInMemoryClientMgr: useInMemoryClientMgr,
+		SignalingIdleTimeout: time.Duration(signalingIdleTimeout) * time.Second,
+		SignalingRateLimit:   signalingRateLimit,
+		SignalingUpgradeRate: signalingUpgradeRate,
+		SignalingOpcodeRates: opcodeRates,
+		SignalingStrikeRate:  strikeRate,
+		TrustedProxies:       proxies,
 		AuthlessUserMap:      nil, // Not used in authless mode
 		EnableEmail:          enableEmail,
 		MailConfig: structs.MailConfig{
@@ -91,5 +160,10 @@ func New(
 			Username: emailUsername,
 			Password: emailPassword,
 		},
+		KeyDBConfig: structs.KeyDBConfig{
+			Host: keydbHost,
+			Port: keydbPort,
+			DB:   keydbDB,
+		},
 	}
 }
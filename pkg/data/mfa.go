@@ -0,0 +1,416 @@
+package data
+
+import (
+	"time"
+
+	"github.com/cloudlink-omega/backend/pkg/constants"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/oklog/ulid/v2"
+)
+
+// LoginChallengeLifetime is how long a user has to complete a login challenge.
+var LoginChallengeLifetime = 5 * time.Minute
+
+// MaxChallengeAttempts is how many codes can be tried (or security codes emailed) for a login challenge
+// before it is destroyed and the user has to log in again.
+const MaxChallengeAttempts = 5
+
+// GetTOTP retrieves the TOTP secret, state and last accepted time step of a user.
+func (mgr *Manager) GetTOTP(userid string) (*structs.TOTPQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("secret", "state", "laststep").
+		From("users_totp").
+		Where(
+			qy.E("userid", userid),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	totp := &structs.TOTPQuery{}
+	if res.Next() {
+		if err := res.Scan(&totp.Secret, &totp.State, &totp.LastStep); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrTOTPNotFound
+	}
+	return totp, nil
+}
+
+// SetTOTPSecret stores a new, unconfirmed TOTP secret for a user, replacing any previous secret.
+func (mgr *Manager) SetTOTPSecret(userid string, secret string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	if err := mgr.DeleteTOTP(userid); err != nil {
+		return err
+	}
+
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("users_totp").
+		Cols("userid", "secret").
+		Values(userid, secret)
+	res, err := mgr.RunInsertQuery(qy)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows != 1 {
+		return errors.ErrDatabaseError
+	}
+	return nil
+}
+
+// EnableTOTP marks the TOTP secret of a user as confirmed, using the time step of the confirmation code.
+func (mgr *Manager) EnableTOTP(userid string, step int64) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	var state uint
+	state |= 1 << constants.TOTP_IS_ENABLED
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("users_totp").
+		Set(
+			qy.Assign("state", state),
+			qy.Assign("laststep", step),
+		).
+		Where(
+			qy.E("userid", userid),
+		).
+		Limit(1)
+	res, err := mgr.RunUpdateQuery(qy)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrTOTPNotFound
+	}
+	return nil
+}
+
+// ConsumeTOTPStep records the time step of an accepted TOTP code.
+//
+// Returns false if a code from the same (or a later) time step was already accepted,
+// which means the code is being reused and must be rejected.
+func (mgr *Manager) ConsumeTOTPStep(userid string, step int64) (bool, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return false, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("users_totp").
+		Set(
+			qy.Assign("laststep", step),
+		).
+		Where(
+			qy.E("userid", userid),
+			qy.LessThan("laststep", step),
+		).
+		Limit(1)
+	res, err := mgr.RunUpdateQuery(qy)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// DeleteTOTP removes the TOTP secret of a user, disabling TOTP two-factor authentication.
+func (mgr *Manager) DeleteTOTP(userid string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("users_totp").Where(qy.E("userid", userid))
+	_, err := mgr.RunDeleteQuery(qy)
+	return err
+}
+
+// ReplaceRecoveryCodes replaces every recovery code of a user with the given scrypt hashes.
+func (mgr *Manager) ReplaceRecoveryCodes(userid string, hashes []string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	if err := mgr.DeleteRecoveryCodes(userid); err != nil {
+		return err
+	}
+
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("recovery_codes").
+		Cols("id", "userid", "hash")
+	for _, hash := range hashes {
+		qy.Values(ulid.Make().String(), userid, hash)
+	}
+	res, err := mgr.RunInsertQuery(qy)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows != int64(len(hashes)) {
+		return errors.ErrDatabaseError
+	}
+	return nil
+}
+
+// GetRecoveryCodes retrieves the IDs and hashes of the unused recovery codes of a user.
+func (mgr *Manager) GetRecoveryCodes(userid string) ([]*structs.RecoveryCodeQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "hash").
+		From("recovery_codes").
+		Where(
+			qy.E("userid", userid),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var codes []*structs.RecoveryCodeQuery
+	for res.Next() {
+		code := &structs.RecoveryCodeQuery{}
+		if err := res.Scan(&code.ID, &code.Hash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// ConsumeRecoveryCode deletes a recovery code after it has been used.
+//
+// Returns false if the code was already deleted (i.e. used by another request at the same time).
+func (mgr *Manager) ConsumeRecoveryCode(id string) (bool, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return false, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("recovery_codes").Where(qy.E("id", id))
+	res, err := mgr.RunDeleteQuery(qy)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// DeleteRecoveryCodes removes every recovery code of a user.
+func (mgr *Manager) DeleteRecoveryCodes(userid string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("recovery_codes").Where(qy.E("userid", userid))
+	_, err := mgr.RunDeleteQuery(qy)
+	return err
+}
+
+// CreateLoginChallenge creates a login challenge for a user that has entered the correct password,
+// but still needs to enter a second factor before a session token is issued.
+//
+// Returns the challenge ID and its expiry time.
+func (mgr *Manager) CreateLoginChallenge(userid string, origin string, persist bool) (string, int64, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return "", 0, errors.ErrAuthlessMode
+	}
+
+	id := ulid.Make().String()
+	expires := time.Now().Add(LoginChallengeLifetime).Unix()
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("login_challenges").
+		Cols("id", "userid", "origin", "persist", "expires").
+		Values(id, userid, origin, persist, expires)
+	res, err := mgr.RunInsertQuery(qy)
+	if err != nil {
+		return "", 0, err
+	}
+	rows, _ := res.RowsAffected()
+	if rows != 1 {
+		return "", 0, errors.ErrDatabaseError
+	}
+	return id, expires, nil
+}
+
+// GetLoginChallenge retrieves a login challenge. Expired challenges are deleted and return ErrChallengeExpired.
+func (mgr *Manager) GetLoginChallenge(id string) (*structs.LoginChallengeQuery, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "userid", "origin", "code", "persist", "attempts", "expires").
+		From("login_challenges").
+		Where(
+			qy.E("id", id),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	challenge := &structs.LoginChallengeQuery{}
+	if res.Next() {
+		if err := res.Scan(&challenge.ID, &challenge.UserID, &challenge.Origin, &challenge.Code, &challenge.Persist, &challenge.Attempts, &challenge.Expires); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.ErrChallengeNotFound
+	}
+
+	if challenge.Expires < time.Now().Unix() {
+		if err := mgr.DeleteLoginChallenge(id); err != nil {
+			return nil, err
+		}
+		return nil, errors.ErrChallengeExpired
+	}
+	return challenge, nil
+}
+
+// CountLoginChallengeAttempt increments the number of attempts made on a login challenge.
+//
+// Returns false if the challenge has no attempts left (or no longer exists), in which case it is deleted.
+func (mgr *Manager) CountLoginChallengeAttempt(id string) (bool, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return false, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("login_challenges").
+		Set(
+			qy.Incr("attempts"),
+		).
+		Where(
+			qy.E("id", id),
+			qy.LessThan("attempts", MaxChallengeAttempts),
+		).
+		Limit(1)
+	res, err := mgr.RunUpdateQuery(qy)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, mgr.DeleteLoginChallenge(id)
+	}
+	return true, nil
+}
+
+// SetLoginChallengeCode stores the scrypt hash of the security code that was emailed for a login challenge,
+// replacing any previously emailed code.
+func (mgr *Manager) SetLoginChallengeCode(id string, hash string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("login_challenges").
+		Set(
+			qy.Assign("code", hash),
+		).
+		Where(
+			qy.E("id", id),
+		).
+		Limit(1)
+	res, err := mgr.RunUpdateQuery(qy)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrChallengeNotFound
+	}
+	return nil
+}
+
+// DeleteLoginChallenge removes a login challenge.
+func (mgr *Manager) DeleteLoginChallenge(id string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("login_challenges").Where(qy.E("id", id))
+	_, err := mgr.RunDeleteQuery(qy)
+	return err
+}
+
+// CompleteLoginChallenge deletes a login challenge once its second factor has been verified.
+//
+// Returns false if the challenge was already completed by another request, in which case no session should be issued.
+func (mgr *Manager) CompleteLoginChallenge(id string) (bool, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return false, errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("login_challenges").Where(qy.E("id", id))
+	res, err := mgr.RunDeleteQuery(qy)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
@@ -0,0 +1,189 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	constants "github.com/cloudlink-omega/backend/pkg/constants"
+)
+
+// A migration brings a database created by an older version of the server up to date. Tables are created with
+// CREATE TABLE IF NOT EXISTS, so columns added to an existing table, and any backfill of existing rows, need one.
+//
+// Migrations run once each, in order, after the tables are created, and are recorded in the schema_migrations table.
+// New databases run them too, so every step must also work on a database that already has the new columns.
+type migration struct {
+	id    string
+	apply func(mgr *Manager) error
+}
+
+var migrations = []migration{
+	{"ip-list-details", func(mgr *Manager) error {
+		for _, table := range []string{"ip_blocklist", "ip_whitelist"} {
+			if _, err := mgr.addColumn(table, "reason", `TINYTEXT NOT NULL DEFAULT ''`); err != nil {
+				return err
+			}
+			if _, err := mgr.addColumn(table, "created", `BIGINT NOT NULL DEFAULT UNIX_TIMESTAMP()`); err != nil {
+				return err
+			}
+			if _, err := mgr.addColumn(table, "expires", `BIGINT NOT NULL DEFAULT 0`); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"developer-description", func(mgr *Manager) error {
+		_, err := mgr.addColumn("developers", "description", `TINYTEXT NOT NULL DEFAULT ''`)
+		return err
+	}},
+	{"developer-member-roles", func(mgr *Manager) error {
+		// Members are now added without a description
+		if _, err := mgr.DB.Exec("ALTER TABLE developer_members MODIFY COLUMN description TINYTEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+
+		added, err := mgr.addColumn("developer_members", "state", `TINYINT unsigned NOT NULL DEFAULT 0`)
+		if err != nil || !added {
+			return err
+		}
+
+		// Existing members had full access, so they all become active
+		if _, err := mgr.DB.Exec(fmt.Sprintf(
+			"UPDATE developer_members SET state = state | %d",
+			1<<constants.DEVMEMBER_IS_ACTIVE,
+		)); err != nil {
+			return err
+		}
+
+		// Every developer account needs an owner. Pick the member with the oldest user account.
+		_, err = mgr.DB.Exec(fmt.Sprintf(
+			`UPDATE developer_members m
+			JOIN (
+				SELECT developerid, MIN(userid) AS userid FROM developer_members
+				GROUP BY developerid HAVING SUM(state & %[1]d) = 0
+			) o ON m.developerid = o.developerid AND m.userid = o.userid
+			SET m.state = m.state | %[1]d`,
+			1<<constants.DEVMEMBER_IS_OWNER,
+		))
+		return err
+	}},
+	{"active-games-and-developers", func(mgr *Manager) error {
+		// Games and developers that predate the active flags were in use already, and developers had no review process
+		if _, err := mgr.DB.Exec(fmt.Sprintf(
+			"UPDATE developers SET state = state | %d",
+			1<<constants.DEVELOPER_IS_ACTIVE|1<<constants.DEVELOPER_IS_VERIFIED,
+		)); err != nil {
+			return err
+		}
+		_, err := mgr.DB.Exec(fmt.Sprintf(
+			"UPDATE games SET state = state | %d",
+			1<<constants.GAME_IS_ACTIVE,
+		))
+		return err
+	}},
+	{"magic-link-subject", func(mgr *Manager) error {
+		_, err := mgr.addColumn("magic_links", "subject", `CHAR(26) NOT NULL DEFAULT ''`)
+		return err
+	}},
+	{"game-origins-backfill", func(mgr *Manager) error {
+		// Browsers could connect to games from any website before authorized origins were enforced.
+		// Keep it that way for existing games until their developers list their origins.
+		_, err := mgr.DB.Exec(
+			`INSERT INTO games_authorized_origins (gameid, origin)
+			SELECT g.id, '*' FROM games g
+			WHERE NOT EXISTS (SELECT 1 FROM games_authorized_origins o WHERE o.gameid = g.id)`,
+		)
+		return err
+	}},
+	{"drop-login-history", func(mgr *Manager) error {
+		// New logins are detected from the origins of existing sessions instead.
+		_, err := mgr.DB.Exec(`DROP TABLE IF EXISTS login_history`)
+		return err
+	}},
+}
+
+func (mgr *Manager) createSchemaMigrationsTable() {
+	sb := sqlbuilder.NewCreateTableBuilder()
+	sb.CreateTable("schema_migrations").IfNotExists().
+		Define(
+			`id`,
+			`VARCHAR(64) PRIMARY KEY UNIQUE NOT NULL`, // ID of the migration
+		).
+		Define(
+			`applied`,
+			`BIGINT NOT NULL`, // UNIX Timestamp
+		)
+	mgr.buildTable("schema_migrations", sb)
+}
+
+// runMigrations applies every migration that hasn't been applied yet. It stops at the first failure, so that
+// migrations never run out of order. The failed migration is retried the next time the server starts.
+func (mgr *Manager) runMigrations() {
+	for _, m := range migrations {
+		qy := sqlbuilder.NewSelectBuilder()
+		qy.Select("COUNT(*)").From("schema_migrations").Where(qy.E("id", m.id))
+		res, err := mgr.RunSelectQuery(qy)
+		if err != nil {
+			log.Printf(`[DB] Failed to check migration "%s": %s`, m.id, err)
+			return
+		}
+		var applied int
+		if res.Next() {
+			err = res.Scan(&applied)
+		}
+		res.Close()
+		if err != nil {
+			log.Printf(`[DB] Failed to check migration "%s": %s`, m.id, err)
+			return
+		}
+		if applied > 0 {
+			continue
+		}
+
+		if err := m.apply(mgr); err != nil {
+			log.Printf(`[DB] Failed to apply migration "%s": %s`, m.id, err)
+			return
+		}
+		record := sqlbuilder.NewInsertBuilder().
+			InsertInto("schema_migrations").
+			Cols("id", "applied").
+			Values(m.id, time.Now().Unix())
+		if _, err := mgr.RunInsertQuery(record); err != nil {
+			log.Printf(`[DB] Failed to record migration "%s": %s`, m.id, err)
+			return
+		}
+		log.Printf(`[DB] Applied migration "%s"`, m.id)
+	}
+}
+
+// addColumn adds a column to a table, unless the table already has it. Returns true if the column was added.
+func (mgr *Manager) addColumn(table string, column string, definition string) (bool, error) {
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("COUNT(*)").
+		From("information_schema.COLUMNS").
+		Where(
+			"TABLE_SCHEMA = DATABASE()",
+			qy.E("TABLE_NAME", table),
+			qy.E("COLUMN_NAME", column),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return false, err
+	}
+	var exists int
+	if res.Next() {
+		err = res.Scan(&exists)
+	}
+	res.Close()
+	if err != nil || exists > 0 {
+		return false, err
+	}
+
+	if _, err = mgr.DB.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"sync"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// OriginCacheTTL is how long the authorized origins of a game are cached before they are queried again.
+var OriginCacheTTL = time.Minute
+
+// OriginCacheSize limits how many games have their authorized origins cached.
+var OriginCacheSize = 10000
+
+type cachedOrigins struct {
+	origins []string
+	expires time.Time
+}
+
+// Authorized origins of each game, keyed by UGI.
+type originCache struct {
+	entries map[string]cachedOrigins
+	lock    sync.RWMutex
+}
+
+// GetAuthorizedOrigins returns the origin patterns that are permitted to connect to a game.
+// In authless mode, the origins specified by AUTHLESS_ORIGINS are used for every game.
+func (mgr *Manager) GetAuthorizedOrigins(ugi string) ([]string, error) {
+	if mgr.AuthlessMode {
+		return mgr.AuthlessOrigins, nil
+	}
+
+	// Check the cache first
+	mgr.originCache.lock.RLock()
+	cached, ok := mgr.originCache.entries[ugi]
+	mgr.originCache.lock.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.origins, nil
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("origin").
+		From("games_authorized_origins").
+		Where(qy.E("gameid", ugi))
+
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	origins := []string{}
+	for res.Next() {
+		var origin string
+		if err := res.Scan(&origin); err != nil {
+			return nil, err
+		}
+		origins = append(origins, origin)
+	}
+
+	// Cache the result
+	mgr.originCache.lock.Lock()
+	defer mgr.originCache.lock.Unlock()
+	if mgr.originCache.entries == nil {
+		mgr.originCache.entries = make(map[string]cachedOrigins)
+	}
+	if len(mgr.originCache.entries) >= OriginCacheSize {
+		mgr.originCache.evict()
+	}
+	mgr.originCache.entries[ugi] = cachedOrigins{
+		origins: origins,
+		expires: time.Now().Add(OriginCacheTTL),
+	}
+	return origins, nil
+}
+
+// InvalidateAuthorizedOrigins removes the cached authorized origins of a game. Use this after changing them.
+func (mgr *Manager) InvalidateAuthorizedOrigins(ugi string) {
+	mgr.originCache.lock.Lock()
+	defer mgr.originCache.lock.Unlock()
+	delete(mgr.originCache.entries, ugi)
+}
+
+// evict makes room in a full cache by removing expired entries. If none have expired, random entries are removed
+// until the cache is below its size limit.
+func (c *originCache) evict() {
+	now := time.Now()
+	for ugi, cached := range c.entries {
+		if now.After(cached.expires) {
+			delete(c.entries, ugi)
+		}
+	}
+	for ugi := range c.entries {
+		if len(c.entries) < OriginCacheSize {
+			break
+		}
+		delete(c.entries, ugi)
+	}
+}
@@ -0,0 +1,331 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	accounts "github.com/cloudlink-omega/backend/pkg/accounts"
+	"github.com/cloudlink-omega/backend/pkg/constants"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/oklog/ulid/v2"
+)
+
+// SessionLifetime is how long a session token is valid for.
+var SessionLifetime = 24 * time.Hour
+
+// PersistentSessionLifetime is how long a session token is valid for if the user asked to be remembered.
+var PersistentSessionLifetime = 30 * 24 * time.Hour
+
+// createSession inserts a new active session token. The token joins the given token family, or starts a new family if it is empty.
+func (mgr *Manager) createSession(userid string, origin string, persist bool, family string) (string, error) {
+	usertoken := ulid.Make().String()
+	if family == "" {
+		family = usertoken
+	}
+
+	var state uint
+	state |= 1 << constants.SESSION_IS_ACTIVE
+	lifetime := SessionLifetime
+	if persist {
+		state |= 1 << constants.SESSION_PERSIST
+		lifetime = PersistentSessionLifetime
+	}
+	expires := time.Now().Add(lifetime).Unix()
+
+	qy := sqlbuilder.NewInsertBuilder().
+		InsertInto("sessions").
+		Cols("id", "userid", "origin", "state", "expires").
+		Values(usertoken, userid, origin, state, expires)
+	res, err := mgr.RunInsertQuery(qy)
+	if err != nil {
+		return "", err
+	}
+	rows, _ := res.RowsAffected()
+	if rows != 1 {
+		return "", errors.ErrDatabaseError
+	}
+
+	fq := sqlbuilder.NewInsertBuilder().
+		InsertInto("session_families").
+		Cols("id", "family", "userid", "expires").
+		Values(usertoken, family, userid, expires)
+	if _, err := mgr.RunInsertQuery(fq); err != nil {
+		return "", err
+	}
+	return usertoken, nil
+}
+
+// getActiveSessions returns every active, unexpired session of a user, and their tokens.
+func (mgr *Manager) getActiveSessions(userid string) ([]*structs.SessionListing, []string, error) {
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "origin", "created", "expires").
+		From("sessions").
+		Where(
+			qy.E("userid", userid),
+			qy.E(fmt.Sprintf("state & %d", 1<<constants.SESSION_IS_REVOKED), 0),
+			qy.GreaterThan("expires", time.Now().Unix()),
+		).
+		OrderBy("created").Desc()
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Close()
+	var sessions []*structs.SessionListing
+	var tokens []string
+	for res.Next() {
+		var token string
+		session := &structs.SessionListing{}
+		if err := res.Scan(&token, &session.Origin, &session.Created, &session.Expires); err != nil {
+			return nil, nil, err
+		}
+		session.ID = accounts.SessionID(token)
+		sessions = append(sessions, session)
+		tokens = append(tokens, token)
+	}
+	return sessions, tokens, nil
+}
+
+// GetSessions lists every active session of a user, newest first. The session using the given token is marked as current.
+func (mgr *Manager) GetSessions(userid string, current string) ([]*structs.SessionListing, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, errors.ErrAuthlessMode
+	}
+
+	sessions, tokens, err := mgr.getActiveSessions(userid)
+	if err != nil {
+		return nil, err
+	}
+	for i, token := range tokens {
+		sessions[i].Current = token == current
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes an active session of a user, using the public ID of the session (see accounts.SessionID).
+//
+// Returns the token of the revoked session, or ErrSessionNotFound if the user has no active session with that ID.
+func (mgr *Manager) RevokeSession(userid string, id string) (string, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return "", errors.ErrAuthlessMode
+	}
+
+	sessions, tokens, err := mgr.getActiveSessions(userid)
+	if err != nil {
+		return "", err
+	}
+	for i, session := range sessions {
+		if session.ID == id {
+			return tokens[i], mgr.RevokeSessionToken(tokens[i])
+		}
+	}
+	return "", errors.ErrSessionNotFound
+}
+
+// RevokeSessionToken revokes a session token, logging out the device that uses it.
+func (mgr *Manager) RevokeSessionToken(token string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("sessions").
+		Set(
+			fmt.Sprintf("state = state | %d", 1<<constants.SESSION_IS_REVOKED),
+		).
+		Where(
+			qy.E("id", token),
+		).
+		Limit(1)
+	res, err := mgr.RunUpdateQuery(qy)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrSessionNotFound
+	}
+	return nil
+}
+
+// RefreshSessionToken exchanges a valid session token for a new one with a fresh lifetime. The old token is revoked.
+//
+// Each token can only be refreshed once. If a token that was already refreshed is used again, it has probably been stolen,
+// so every token of its family (the tokens it was refreshed from, and refreshed into) is revoked and ErrSessionReused is returned.
+func (mgr *Manager) RefreshSessionToken(token string) (string, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return "", errors.ErrAuthlessMode
+	}
+
+	// Find the family of the token. Sessions created before token families were tracked start a new family.
+	family, rotated, err := mgr.getSessionFamily(token)
+	tracked := err == nil
+	if err == errors.ErrSessionNotFound {
+		family = token
+	} else if err != nil {
+		return "", err
+	}
+
+	// Detect reuse
+	if rotated != 0 {
+		if err := mgr.RevokeSessionFamily(family); err != nil {
+			return "", err
+		}
+		return "", errors.ErrSessionReused
+	}
+
+	session, err := mgr.GetSessionInfoFromToken(token)
+	if err != nil {
+		return "", err
+	}
+	if session.Expiry <= time.Now().Unix() {
+		return "", errors.ErrSessionExpired
+	}
+
+	// Mark the token as refreshed. If another request refreshed it first, the token is being reused.
+	now := time.Now().Unix()
+	if tracked {
+		qy := sqlbuilder.NewUpdateBuilder()
+		qy.Update("session_families").
+			Set(
+				qy.Assign("rotated", now),
+			).
+			Where(
+				qy.E("id", token),
+				qy.E("rotated", 0),
+			).
+			Limit(1)
+		res, err := mgr.RunUpdateQuery(qy)
+		if err != nil {
+			return "", err
+		}
+		if rows, err := res.RowsAffected(); err != nil {
+			return "", err
+		} else if rows == 0 {
+			if err := mgr.RevokeSessionFamily(family); err != nil {
+				return "", err
+			}
+			return "", errors.ErrSessionReused
+		}
+	} else {
+		qy := sqlbuilder.NewInsertBuilder().
+			InsertInto("session_families").
+			Cols("id", "family", "userid", "rotated", "expires").
+			Values(token, family, session.UserID, now, session.Expiry)
+		if _, err := mgr.RunInsertQuery(qy); err != nil {
+			return "", err
+		}
+	}
+
+	if err := mgr.RevokeSessionToken(token); err != nil {
+		return "", err
+	}
+	return mgr.createSession(session.UserID, session.Origin, session.State.Read(constants.SESSION_PERSIST), family)
+}
+
+// getSessionFamily returns the family of a session token, and when the token was refreshed (0 if it hasn't been refreshed).
+func (mgr *Manager) getSessionFamily(token string) (string, int64, error) {
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("family", "rotated").
+		From("session_families").
+		Where(
+			qy.E("id", token),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Close()
+	var family string
+	var rotated int64
+	if res.Next() {
+		if err := res.Scan(&family, &rotated); err != nil {
+			return "", 0, err
+		}
+	} else {
+		return "", 0, errors.ErrSessionNotFound
+	}
+	return family, rotated, nil
+}
+
+// GetSessionFamily returns the user and every token in the family of a session token (including the token itself),
+// i.e. to find the connections that used an older token of a session that was revoked.
+//
+// If the token is not part of a family, the token itself is returned without a user.
+func (mgr *Manager) GetSessionFamily(token string) (string, []string, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return "", nil, errors.ErrAuthlessMode
+	}
+
+	family, _, err := mgr.getSessionFamily(token)
+	if err == errors.ErrSessionNotFound {
+		return "", []string{token}, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "userid").
+		From("session_families").
+		Where(
+			qy.E("family", family),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return "", nil, err
+	}
+	defer res.Close()
+	var userid string
+	var tokens []string
+	for res.Next() {
+		var member string
+		if err := res.Scan(&member, &userid); err != nil {
+			return "", nil, err
+		}
+		tokens = append(tokens, member)
+	}
+	return userid, tokens, nil
+}
+
+// RevokeSessionFamily revokes every session token of a token family.
+func (mgr *Manager) RevokeSessionFamily(family string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	members := sqlbuilder.NewSelectBuilder()
+	members.Select("id").
+		From("session_families").
+		Where(
+			members.E("family", family),
+		)
+
+	qy := sqlbuilder.NewUpdateBuilder()
+	qy.Update("sessions").
+		Set(
+			fmt.Sprintf("state = state | %d", 1<<constants.SESSION_IS_REVOKED),
+		).
+		Where(
+			qy.Or(
+				qy.E("id", family),
+				qy.In("id", members),
+			),
+		)
+	_, err := mgr.RunUpdateQuery(qy)
+	return err
+}
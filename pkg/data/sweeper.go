@@ -0,0 +1,123 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cloudlink-omega/backend/pkg/constants"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// SweepInterval is how often expired magic links, sessions and login challenges are deleted.
+var SweepInterval = 15 * time.Minute
+
+// StartSweeper periodically deletes expired magic links, sessions and login challenges in the background.
+func (mgr *Manager) StartSweeper() {
+
+	// Nothing to clean up in authless mode
+	if mgr.AuthlessMode {
+		return
+	}
+
+	go func() {
+		for range time.Tick(SweepInterval) {
+			mgr.Sweep()
+		}
+	}()
+}
+
+// Sweep deletes expired magic links, expired login challenges, and expired or revoked sessions.
+func (mgr *Manager) Sweep() {
+	now := time.Now().Unix()
+
+	// DELETE FROM magic_links WHERE expires < (now)
+	links := sqlbuilder.NewDeleteBuilder()
+	links.DeleteFrom("magic_links").Where(
+		links.IsNotNull("expires"),
+		links.LessThan("expires", now),
+	)
+	var deletedLinks, deletedSessions, deletedChallenges int64
+	if res, err := mgr.RunDeleteQuery(links); err != nil {
+		log.Printf("[DB] Failed to delete expired magic links: %s", err)
+	} else {
+		deletedLinks, _ = res.RowsAffected()
+	}
+
+	// Magic links created before expiry times were stored expire after the lifetime of their mode
+	for _, mode := range []uint8{
+		constants.LINKMODE_EMAIL,
+		constants.LINKMODE_PASSWORD,
+		constants.LINKMODE_DEVELOPER,
+		constants.LINKMODE_UNSUBSCRIBE,
+	} {
+		legacy := sqlbuilder.NewDeleteBuilder()
+		legacy.DeleteFrom("magic_links").Where(
+			legacy.IsNull("expires"),
+			legacy.E("mode", mode),
+			legacy.LessThan("created", now-constants.MagicLinkLifetime(mode)),
+		)
+		if res, err := mgr.RunDeleteQuery(legacy); err != nil {
+			log.Printf("[DB] Failed to delete expired magic links: %s", err)
+		} else {
+			rows, _ := res.RowsAffected()
+			deletedLinks += rows
+		}
+	}
+
+	// DELETE FROM sessions WHERE expires < (now) OR state & SESSION_IS_REVOKED != 0
+	sessions := sqlbuilder.NewDeleteBuilder()
+	sessions.DeleteFrom("sessions").Where(
+		sessions.Or(
+			sessions.LessThan("expires", now),
+			sessions.NotEqual(fmt.Sprintf("state & %d", 1<<constants.SESSION_IS_REVOKED), 0),
+		),
+	)
+	if res, err := mgr.RunDeleteQuery(sessions); err != nil {
+		log.Printf("[DB] Failed to delete expired or revoked sessions: %s", err)
+	} else {
+		deletedSessions, _ = res.RowsAffected()
+	}
+
+	// Refreshed tokens are remembered until they expire, to detect reuse
+	families := sqlbuilder.NewDeleteBuilder()
+	families.DeleteFrom("session_families").Where(families.LessThan("expires", now))
+	if _, err := mgr.RunDeleteQuery(families); err != nil {
+		log.Printf("[DB] Failed to delete expired session families: %s", err)
+	}
+
+	// Forget old failed logins, unless they are still locked out
+	throttle := sqlbuilder.NewDeleteBuilder()
+	throttle.DeleteFrom("login_throttle").Where(
+		throttle.LessThan("last", now-int64(LoginFailureWindow.Seconds())),
+		throttle.LessThan("locked", now),
+	)
+	if _, err := mgr.RunDeleteQuery(throttle); err != nil {
+		log.Printf("[DB] Failed to delete old failed logins: %s", err)
+	}
+
+	// Remove expired IP list entries
+	for _, list := range []IPList{IPBlocklist, IPAllowlist} {
+		entries := sqlbuilder.NewDeleteBuilder()
+		entries.DeleteFrom(string(list)).Where(
+			entries.NotEqual("expires", 0),
+			entries.LessThan("expires", now),
+		)
+		if _, err := mgr.RunDeleteQuery(entries); err != nil {
+			log.Printf("[DB] Failed to delete expired %s entries: %s", list, err)
+		}
+	}
+
+	// DELETE FROM login_challenges WHERE expires < (now)
+	challenges := sqlbuilder.NewDeleteBuilder()
+	challenges.DeleteFrom("login_challenges").Where(challenges.LessThan("expires", now))
+	if res, err := mgr.RunDeleteQuery(challenges); err != nil {
+		log.Printf("[DB] Failed to delete expired login challenges: %s", err)
+	} else {
+		deletedChallenges, _ = res.RowsAffected()
+	}
+
+	if deletedLinks > 0 || deletedSessions > 0 || deletedChallenges > 0 {
+		log.Printf("[DB] Deleted %d expired magic links, %d expired or revoked sessions and %d expired login challenges", deletedLinks, deletedSessions, deletedChallenges)
+	}
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// LoginThrottle describes how failed logins are throttled.
+type LoginThrottle struct {
+	FreeAttempts    int           // Failures allowed before each attempt has to wait longer than the last
+	MaxDelay        time.Duration // Longest wait between attempts
+	Lockout         int           // Failures before logins are refused for LockoutDuration
+	LockoutDuration time.Duration
+}
+
+// AccountLoginThrottle throttles failed logins to an account, regardless of where they come from.
+var AccountLoginThrottle = LoginThrottle{FreeAttempts: 3, MaxDelay: 30 * time.Second, Lockout: 10, LockoutDuration: 15 * time.Minute}
+
+// IPLoginThrottle throttles failed logins from an IP address, regardless of which accounts they are for.
+var IPLoginThrottle = LoginThrottle{FreeAttempts: 10, MaxDelay: 30 * time.Second, Lockout: 50, LockoutDuration: 15 * time.Minute}
+
+// LoginFailureWindow is how long failed logins are remembered after the last one.
+var LoginFailureWindow = 15 * time.Minute
+
+// Login throttle key of an email address.
+// Email addresses are used instead of user IDs, so that accounts that don't exist are throttled the same way.
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// Login throttle key of an IP address.
+func ipThrottleKey(address string) string {
+	return "ip:" + address
+}
+
+// LoginRetryAfter returns how long a client has to wait before it may try to log in to an account again.
+// Zero means it may try right away. Allowlisted IP addresses are only throttled per account.
+func (mgr *Manager) LoginRetryAfter(email string, address string) (time.Duration, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return 0, errors.ErrAuthlessMode
+	}
+
+	wait, err := mgr.retryAfter(accountThrottleKey(email), AccountLoginThrottle)
+	if err != nil || mgr.IsIPAllowed(address) {
+		return wait, err
+	}
+	ipWait, err := mgr.retryAfter(ipThrottleKey(address), IPLoginThrottle)
+	return max(wait, ipWait), err
+}
+
+// RecordLoginFailure counts a failed login to an account from an IP address.
+// Returns true if the failure locked the account out.
+func (mgr *Manager) RecordLoginFailure(email string, address string) (bool, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return false, errors.ErrAuthlessMode
+	}
+
+	if !mgr.IsIPAllowed(address) {
+		if locked, err := mgr.recordFailure(ipThrottleKey(address), IPLoginThrottle); err != nil {
+			return false, err
+		} else if locked {
+			log.Printf("[DB] Too many failed logins from %s, locked out for %s", address, IPLoginThrottle.LockoutDuration)
+		}
+	}
+	return mgr.recordFailure(accountThrottleKey(email), AccountLoginThrottle)
+}
+
+// ClearLoginFailures forgets the failed logins to an account (i.e. after a successful login).
+func (mgr *Manager) ClearLoginFailures(email string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	return mgr.deleteLoginFailures(accountThrottleKey(email))
+}
+
+// retryAfter returns how long a throttle key has to wait before it may try to log in again.
+func (mgr *Manager) retryAfter(key string, throttle LoginThrottle) (time.Duration, error) {
+	failures, last, locked, err := mgr.getLoginFailures(key)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	if until := time.Unix(locked, 0); until.After(now) {
+		return until.Sub(now), nil
+	}
+	if failures <= throttle.FreeAttempts {
+		return 0, nil
+	}
+
+	// Wait 1, 2, 4, 8... seconds after each failure past the free attempts
+	delay := time.Duration(math.Pow(2, float64(failures-throttle.FreeAttempts-1))) * time.Second
+	if delay > throttle.MaxDelay || delay <= 0 {
+		delay = throttle.MaxDelay
+	}
+	if next := time.Unix(last, 0).Add(delay); next.After(now) {
+		return next.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// recordFailure counts a failed login of a throttle key. Returns true if the failure locked the key out.
+// Concurrent failures of the same key are all counted, and only one of them locks the key out.
+func (mgr *Manager) recordFailure(key string, throttle LoginThrottle) (bool, error) {
+	now := time.Now()
+
+	// Count the failure, starting over if the last one was too long ago.
+	// MariaDB assigns columns from left to right, so failures is counted before last is replaced.
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("login_throttle").
+		Cols("id", "failures", "last", "locked").
+		Values(key, 1, now.Unix(), 0)
+	ib.SQL(fmt.Sprintf(
+		"ON DUPLICATE KEY UPDATE failures = IF(last < %s, 1, failures + 1), last = %s",
+		ib.Var(now.Add(-LoginFailureWindow).Unix()),
+		ib.Var(now.Unix()),
+	))
+	if _, err := mgr.RunInsertQuery(ib); err != nil {
+		return false, err
+	}
+
+	// Lock the key out once it has failed too often
+	ub := sqlbuilder.NewUpdateBuilder()
+	ub.Update("login_throttle").
+		Set(
+			ub.Assign("failures", 0),
+			ub.Assign("locked", now.Add(throttle.LockoutDuration).Unix()),
+		).
+		Where(
+			ub.E("id", key),
+			ub.GreaterEqualThan("failures", throttle.Lockout),
+		)
+	res, err := mgr.RunUpdateQuery(ub)
+	if err != nil {
+		return false, err
+	}
+	locked, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return locked != 0, nil
+}
+
+func (mgr *Manager) deleteLoginFailures(key string) error {
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("login_throttle").Where(qy.E("id", key))
+	_, err := mgr.RunDeleteQuery(qy)
+	return err
+}
+
+// getLoginFailures returns the failed logins of a key that happened within LoginFailureWindow, when the last one happened,
+// and until when the key is locked out.
+func (mgr *Manager) getLoginFailures(key string) (int, int64, int64, error) {
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("failures", "last", "locked").
+		From("login_throttle").
+		Where(
+			qy.E("id", key),
+		)
+	res, err := mgr.RunSelectQuery(qy)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer res.Close()
+
+	var failures int
+	var last, locked int64
+	if res.Next() {
+		if err := res.Scan(&failures, &last, &locked); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	// Forget old failures
+	if last < time.Now().Add(-LoginFailureWindow).Unix() {
+		failures = 0
+	}
+	return failures, last, locked, nil
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// SearchUsers finds users whose ID matches the query, or whose username or email address contains it.
+// An empty query matches every user. Newest users are returned first.
+//
+// Returns a page of at most limit users starting at offset, and the total number of matching users.
+func (mgr *Manager) SearchUsers(query string, offset int, limit int) ([]*structs.UserQuery, int, error) {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return nil, 0, errors.ErrAuthlessMode
+	}
+
+	// Count every match
+	count := sqlbuilder.NewSelectBuilder()
+	count.Select("COUNT(*)").From("users")
+	if query != "" {
+		count.Where(count.Or(
+			count.E("id", query),
+			count.Like("username", "%"+query+"%"),
+			count.Like("email", "%"+query+"%"),
+		))
+	}
+	res, err := mgr.RunSelectQuery(count)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int
+	if res.Next() {
+		if err := res.Scan(&total); err != nil {
+			res.Close()
+			return nil, 0, err
+		}
+	}
+	res.Close()
+
+	// Read the requested page
+	qy := sqlbuilder.NewSelectBuilder()
+	qy.Select("id", "username", "email", "state", "created").
+		From("users").
+		OrderBy("created").Desc().
+		Limit(limit).
+		Offset(offset)
+	if query != "" {
+		qy.Where(qy.Or(
+			qy.E("id", query),
+			qy.Like("username", "%"+query+"%"),
+			qy.Like("email", "%"+query+"%"),
+		))
+	}
+	res, err = mgr.RunSelectQuery(qy)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Close()
+
+	users := []*structs.UserQuery{}
+	for res.Next() {
+		user := &structs.UserQuery{}
+		if err := res.Scan(&user.ID, &user.Username, &user.Email, &user.State, &user.Created); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, nil
+}
+
+// DeleteUser deletes a user account. Everything that belongs to the user (sessions, saves, magic links, etc.) is deleted with it.
+func (mgr *Manager) DeleteUser(userid string) error {
+
+	// Cannot work in authless mode
+	if mgr.AuthlessMode {
+		return errors.ErrAuthlessMode
+	}
+
+	qy := sqlbuilder.NewDeleteBuilder()
+	qy.DeleteFrom("users").Where(qy.E("id", userid))
+	res, err := mgr.RunDeleteQuery(qy)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.ErrUserNotFound
+	}
+	return nil
+}
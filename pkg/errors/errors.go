@@ -8,9 +8,30 @@ import (
 var ErrUserNotFound = errors.New("user not found")
 var ErrUserExists = errors.New("user already exists")
 var ErrSessionNotFound = errors.New("session not found")
+var ErrSessionRevoked = errors.New("session revoked")
+var ErrSessionExpired = errors.New("session expired")
+var ErrSessionReused = errors.New("session token reused")
 var ErrEmailInUse = errors.New("email in use")
 var ErrUsernameInUse = errors.New("username taken")
 var ErrDatabaseError = errors.New("db error")
 var ErrGameNotFound = errors.New("game not found")
 var ErrAuthlessMode = errors.New("authless mode")
 var ErrLinkNotFound = errors.New("magic link not found")
+var ErrLinkExpired = errors.New("magic link expired")
+var ErrTOTPNotFound = errors.New("totp not enrolled")
+var ErrChallengeNotFound = errors.New("login challenge not found")
+var ErrChallengeExpired = errors.New("login challenge expired")
+var ErrUserBlocked = errors.New("user is blocked")
+var ErrUserBanned = errors.New("user is banned")
+var ErrBanNotFound = errors.New("ban not found")
+var ErrIPListEntryNotFound = errors.New("ip list entry not found")
+var ErrInvalidIPAddress = errors.New("invalid ip address or cidr range")
+var ErrDeveloperNotFound = errors.New("developer not found")
+var ErrDeveloperMemberNotFound = errors.New("developer member not found")
+var ErrOriginNotFound = errors.New("authorized origin not found")
+var ErrOriginExists = errors.New("authorized origin already exists")
+var ErrOwnershipTransfer = errors.New("ownership can only be transferred from the owner to an active member")
+var ErrGameInactive = errors.New("game is inactive")
+var ErrDeveloperInactive = errors.New("developer of this game is inactive")
+var ErrAPIKeyNotFound = errors.New("api key not found")
+var ErrAPIKeyInvalid = errors.New("invalid api key")
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate describes a token bucket: Burst tokens can be used at once, and tokens are refilled at PerSecond.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// ParseRate reads a rate written as "PerSecond/Burst", e.g. "0.5/3".
+func ParseRate(s string) (Rate, error) {
+	perSecond, burst, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		return Rate{}, fmt.Errorf("rate \"%s\" is not written as PerSecond/Burst", s)
+	}
+	var rate Rate
+	var err error
+	if rate.PerSecond, err = strconv.ParseFloat(perSecond, 64); err != nil || rate.PerSecond < 0 {
+		return Rate{}, fmt.Errorf("rate \"%s\" has an invalid number of tokens per second", s)
+	}
+	if rate.Burst, err = strconv.Atoi(burst); err != nil || rate.Burst < 0 {
+		return Rate{}, fmt.Errorf("rate \"%s\" has an invalid burst", s)
+	}
+	return rate, nil
+}
+
+// ParseRates reads a comma-separated list of keyed rates written as "Key=PerSecond/Burst", e.g. "ICE=20/100,LOBBY_LIST=1/5".
+func ParseRates(s string) (map[string]Rate, error) {
+	rates := make(map[string]Rate)
+	for _, entry := range strings.Split(s, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("rate \"%s\" is not written as Key=PerSecond/Burst", entry)
+		}
+		rate, err := ParseRate(value)
+		if err != nil {
+			return nil, err
+		}
+		rates[key] = rate
+	}
+	return rates, nil
+}
+
+// Bucket is a token bucket. Each allowed event takes one token.
+type Bucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+// NewBucket creates a full token bucket.
+func NewBucket(rate Rate) *Bucket {
+	return &Bucket{
+		rate:   rate,
+		tokens: float64(rate.Burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens earned since the last call. The caller must hold the lock.
+func (b *Bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate.PerSecond
+	if b.tokens > float64(b.rate.Burst) {
+		b.tokens = float64(b.rate.Burst)
+	}
+	b.last = now
+}
+
+// Allow takes a token from the bucket. Returns false if the bucket is empty.
+func (b *Bucket) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full returns true if the bucket has refilled completely, meaning it hasn't been used for a while.
+func (b *Bucket) full(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(now)
+	return b.tokens >= float64(b.rate.Burst)
+}
+
+// Limiter keeps a separate token bucket for every key (e.g. a remote IP address).
+type Limiter struct {
+	rate    Rate
+	buckets map[string]*Bucket
+	lock    sync.Mutex
+}
+
+// NewLimiter creates a keyed rate limiter. Buckets that are no longer in use are removed every minute.
+func NewLimiter(rate Rate) *Limiter {
+	l := &Limiter{
+		rate:    rate,
+		buckets: make(map[string]*Bucket),
+	}
+	go l.sweep(time.Minute)
+	return l
+}
+
+// Allow takes a token from the bucket of a key. Returns false if the bucket is empty.
+func (l *Limiter) Allow(key string) bool {
+	l.lock.Lock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewBucket(l.rate)
+		l.buckets[key] = bucket
+	}
+	l.lock.Unlock()
+	return bucket.Allow()
+}
+
+// sweep periodically removes full buckets, since they behave the same as a new bucket.
+func (l *Limiter) sweep(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+		l.lock.Lock()
+		for key, bucket := range l.buckets {
+			if bucket.full(now) {
+				delete(l.buckets, key)
+			}
+		}
+		l.lock.Unlock()
+	}
+}
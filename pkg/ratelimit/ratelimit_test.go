@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Rate
+		ok   bool
+	}{
+		{"0.5/3", Rate{PerSecond: 0.5, Burst: 3}, true},
+		{"20/100", Rate{PerSecond: 20, Burst: 100}, true},
+		{" 1/5 ", Rate{PerSecond: 1, Burst: 5}, true},
+		{"0/0", Rate{}, true},
+		{"5", Rate{}, false},
+		{"a/3", Rate{}, false},
+		{"1/b", Rate{}, false},
+		{"1/2.5", Rate{}, false},
+		{"-1/3", Rate{}, false},
+		{"1/-3", Rate{}, false},
+	} {
+		got, err := ParseRate(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseRate(%q) = %+v, %v; want %+v, ok %v", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestParseRates(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want map[string]Rate
+		ok   bool
+	}{
+		{"", map[string]Rate{}, true},
+		{"ICE=20/100", map[string]Rate{"ICE": {PerSecond: 20, Burst: 100}}, true},
+		{"ICE=20/100, LOBBY_LIST=1/5,", map[string]Rate{"ICE": {PerSecond: 20, Burst: 100}, "LOBBY_LIST": {PerSecond: 1, Burst: 5}}, true},
+		{"ICE", nil, false},
+		{"=1/5", nil, false},
+		{"ICE=20", nil, false},
+	} {
+		got, err := ParseRates(tc.in)
+		if (err == nil) != tc.ok || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseRates(%q) = %+v, %v; want %+v, ok %v", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	b := NewBucket(Rate{PerSecond: 2, Burst: 3})
+
+	// A new bucket allows a burst, then runs dry
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("Event %d of the burst was refused", i+1)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("Event after the burst was allowed")
+	}
+	if b.full(time.Now()) {
+		t.Fatal("Empty bucket is full")
+	}
+
+	// Tokens are earned back over time, up to the burst
+	b.last = b.last.Add(-time.Second)
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("Event %d after one second was refused", i+1)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("More events were allowed than tokens were earned")
+	}
+	b.last = b.last.Add(-time.Hour)
+	if !b.full(time.Now()) {
+		t.Fatal("Bucket did not refill")
+	}
+	if b.tokens != 3 {
+		t.Fatalf("Bucket has %v tokens, want at most the burst of 3", b.tokens)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Rate{PerSecond: 1, Burst: 1})
+	if !l.Allow("a") || l.Allow("a") {
+		t.Fatal("Key a should be allowed exactly once")
+	}
+
+	// Keys have separate buckets
+	if !l.Allow("b") {
+		t.Fatal("Key b was limited by key a")
+	}
+}
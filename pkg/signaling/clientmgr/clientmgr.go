@@ -10,11 +10,33 @@ import (
 
 // Client manager is a pseudo-database for signaling clients.
 
+// Ensure both client managers implement the Store interface
+var _ Store = (*ClientDB)(nil)
+var _ Store = (*KeyDB)(nil)
+
+// Index key for a lobby within a UGI.
+type lobbyIndexKey struct {
+	ugi   string
+	lobby string
+}
+
+// The values a client was last indexed with, so that stale index entries can be removed.
+type indexEntry struct {
+	ulid  string
+	ugi   string
+	lobby string
+}
+
 // In-memory pseudo-DB
 type ClientDB struct {
 	clients       map[uint64]*structs.Client                      // Clients.
+	byULID        map[string]*structs.Client                      // Index of clients by ULID.
+	byUGI         map[string]map[uint64]*structs.Client           // Index of clients by UGI.
+	byLobby       map[lobbyIndexKey]map[uint64]*structs.Client    // Index of clients by UGI and lobby. Clients without a lobby are indexed under "".
+	indexed       map[uint64]indexEntry                           // Values each client is currently indexed with.
+	resumeTokens  map[string]*structs.Client                      // Clients by resume token.
 	idIncrementer uint64                                          // ID Autoincrement.
-	queryLock     sync.Mutex                                      // Locks the entire query process. Prevents deadlocks.
+	queryLock     sync.RWMutex                                    // Locks the entire query process. Prevents deadlocks.
 	Lobbies       map[string]map[string]*structs.LobbyConfigStore // Lobbies.
 }
 
@@ -23,14 +45,62 @@ func New() *ClientDB {
 	log.Print("[Client Manager] Initializing new signaling client manager...")
 	return &ClientDB{
 		clients:       make(map[uint64]*structs.Client),
+		byULID:        make(map[string]*structs.Client),
+		byUGI:         make(map[string]map[uint64]*structs.Client),
+		byLobby:       make(map[lobbyIndexKey]map[uint64]*structs.Client),
+		indexed:       make(map[uint64]indexEntry),
+		resumeTokens:  make(map[string]*structs.Client),
 		idIncrementer: 0, // AUTOINCREMENT
-		queryLock:     sync.Mutex{},
+		queryLock:     sync.RWMutex{},
 		Lobbies:       make(map[string]map[string]*structs.LobbyConfigStore),
 	}
 }
 
+// index adds a client to every index using its current values. The caller must hold the write lock.
+func (db *ClientDB) index(client *structs.Client) {
+	entry := indexEntry{ulid: client.ULID, ugi: client.UGI, lobby: client.Lobby}
+	if entry.ulid != "" {
+		db.byULID[entry.ulid] = client
+	}
+	if _, ok := db.byUGI[entry.ugi]; !ok {
+		db.byUGI[entry.ugi] = make(map[uint64]*structs.Client)
+	}
+	db.byUGI[entry.ugi][client.ID] = client
+	key := lobbyIndexKey{ugi: entry.ugi, lobby: entry.lobby}
+	if _, ok := db.byLobby[key]; !ok {
+		db.byLobby[key] = make(map[uint64]*structs.Client)
+	}
+	db.byLobby[key][client.ID] = client
+	db.indexed[client.ID] = entry
+}
+
+// unindex removes a client from every index using the values it was last indexed with. The caller must hold the write lock.
+func (db *ClientDB) unindex(id uint64) {
+	entry, ok := db.indexed[id]
+	if !ok {
+		return
+	}
+	if entry.ulid != "" && db.byULID[entry.ulid] != nil && db.byULID[entry.ulid].ID == id {
+		delete(db.byULID, entry.ulid)
+	}
+	if clients, ok := db.byUGI[entry.ugi]; ok {
+		delete(clients, id)
+		if len(clients) == 0 {
+			delete(db.byUGI, entry.ugi)
+		}
+	}
+	key := lobbyIndexKey{ugi: entry.ugi, lobby: entry.lobby}
+	if clients, ok := db.byLobby[key]; ok {
+		delete(clients, id)
+		if len(clients) == 0 {
+			delete(db.byLobby, key)
+		}
+	}
+	delete(db.indexed, id)
+}
+
 // CreateLobbyConfigStorage creates a new lobby config store for a specified UGI.
-// Returns the lobby config store.
+// Returns the lobby config store, or nil if the lobby already exists.
 func (db *ClientDB) CreateLobbyConfigStorage(ugi string, lobbyname string) *structs.LobbyConfigStore {
 
 	// Get write lock
@@ -38,27 +108,72 @@ func (db *ClientDB) CreateLobbyConfigStorage(ugi string, lobbyname string) *stru
 
 	// Delete client and free lock
 	defer db.queryLock.Unlock()
-	func() {
+	return func() *structs.LobbyConfigStore {
 		// Check if the root UGI lobby store manager exists, and create it if it doesn't.
 		if _, ok := db.Lobbies[ugi]; !ok {
 			log.Printf("[Client Manager] Creating UGI %s root lobby config store...", ugi)
 			db.Lobbies[ugi] = make(map[string]*structs.LobbyConfigStore)
 		}
 
+		// Another client may have created the lobby already
+		if _, ok := db.Lobbies[ugi][lobbyname]; ok {
+			return nil
+		}
+
 		// Create the lobby config store
 		log.Printf("[Client Manager] Creating lobby %s configuration store in UGI %s...", lobbyname, ugi)
-		db.Lobbies[ugi][lobbyname] = &structs.LobbyConfigStore{}
+		db.Lobbies[ugi][lobbyname] = &structs.LobbyConfigStore{ID: lobbyname}
+		return db.Lobbies[ugi][lobbyname]
 	}()
-	return db.Lobbies[ugi][lobbyname]
+}
+
+// UpdateLobbyConfigStorage saves changes made to a lobby config store.
+// Lobby config stores are kept in memory, so this only replaces the stored pointer if it has changed.
+func (db *ClientDB) UpdateLobbyConfigStorage(ugi string, lobbyname string, lobby *structs.LobbyConfigStore) {
+
+	// Get write lock
+	db.queryLock.Lock()
+
+	// Update config and free lock
+	defer db.queryLock.Unlock()
+	if _, ok := db.Lobbies[ugi]; !ok {
+		return
+	}
+	if _, ok := db.Lobbies[ugi][lobbyname]; ok {
+		db.Lobbies[ugi][lobbyname] = lobby
+	}
+}
+
+// DeleteLobbyConfigStorage deletes the lobby config store for a lobby.
+// If the root UGI has no remaining lobbies, the root UGI lobby store manager is deleted as well.
+func (db *ClientDB) DeleteLobbyConfigStorage(ugi string, lobbyname string) {
+
+	// Get write lock
+	db.queryLock.Lock()
+
+	// Delete config and free lock
+	defer db.queryLock.Unlock()
+	if _, ok := db.Lobbies[ugi]; !ok {
+		return
+	}
+
+	log.Printf("[Client Manager] Deleting unused lobby config store %s in UGI %s...", lobbyname, ugi)
+	delete(db.Lobbies[ugi], lobbyname)
+
+	// Check if the root UGI has no remaining lobbies. If there are no remaining lobbies, delete the root UGI lobby manager.
+	if len(db.Lobbies[ugi]) == 0 {
+		log.Printf("[Client Manager] Deleting unused UGI %s root lobby config store...", ugi)
+		delete(db.Lobbies, ugi)
+	}
 }
 
 func (db *ClientDB) GetLobbyConfigStorage(ugi string, lobbyname string) *structs.LobbyConfigStore {
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
 	// Read config and free lock
-	defer db.queryLock.Unlock()
+	defer db.queryLock.RUnlock()
 	return func() *structs.LobbyConfigStore {
 		if _, ok := db.Lobbies[ugi]; !ok {
 			return nil
@@ -67,6 +182,7 @@ func (db *ClientDB) GetLobbyConfigStorage(ugi string, lobbyname string) *structs
 	}()
 }
 
+// DELETE FROM clients WHERE ID = (client.ID)
 func (db *ClientDB) Delete(client *structs.Client) {
 
 	// Get write lock
@@ -76,9 +192,26 @@ func (db *ClientDB) Delete(client *structs.Client) {
 
 	// Delete client and free lock
 	defer db.queryLock.Unlock()
+	db.unindex(client.ID)
 	delete(db.clients, client.ID)
 }
 
+// UPDATE clients SET ... WHERE ID = (client.ID)
+// Clients are kept in memory, so this only re-indexes the client using its current ULID and lobby.
+func (db *ClientDB) Update(client *structs.Client) {
+
+	// Get write lock
+	db.queryLock.Lock()
+
+	// Re-index client and free lock
+	defer db.queryLock.Unlock()
+	if _, ok := db.clients[client.ID]; !ok {
+		return
+	}
+	db.unindex(client.ID)
+	db.index(client)
+}
+
 // INSERT INTO clients (Game, Name) VALUES (?, ?)
 func (db *ClientDB) Add(client *structs.Client) *structs.Client {
 	// Get write lock
@@ -91,6 +224,7 @@ func (db *ClientDB) Add(client *structs.Client) *structs.Client {
 		db.idIncrementer++
 		log.Printf("[Client Manager] Adding client (%d) in %s...", client.ID, client.UGI)
 		db.clients[client.ID] = client
+		db.index(client)
 	}()
 
 	return client
@@ -98,114 +232,126 @@ func (db *ClientDB) Add(client *structs.Client) *structs.Client {
 
 // SELECT client FROM clients WHERE ULID = (ulid)
 func (db *ClientDB) GetClientByULID(query string) *structs.Client {
-	var res *structs.Client = nil
 
 	// Get read lock
+	db.queryLock.RLock()
+
+	// Return match and free lock
+	defer db.queryLock.RUnlock()
+	if query == "" {
+		return nil
+	}
+	return db.byULID[query]
+}
+
+// SetResumeToken makes a resume token refer to a client.
+func (db *ClientDB) SetResumeToken(token string, client *structs.Client) {
+
+	// Get write lock
 	db.queryLock.Lock()
 
-	log.Printf("[Client Manager] Finding client given ULID %s...", query)
+	// Store token and free lock
+	defer db.queryLock.Unlock()
+	db.resumeTokens[token] = client
+}
 
-	// Return match and free lock
+// DeleteResumeToken removes a resume token.
+func (db *ClientDB) DeleteResumeToken(token string) {
+
+	// Get write lock
+	db.queryLock.Lock()
+
+	// Delete token and free lock
 	defer db.queryLock.Unlock()
-	func() {
-		for _, client := range db.clients {
-			if client.ULID == query {
-				log.Printf("[Client Manager] Found match, returning client %d...", client.ID)
-				res = client
-			}
-		}
-	}()
-	if res == nil {
-		log.Printf("[Client Manager] No client found matching ULID %s", query)
-	}
-	return res
+	delete(db.resumeTokens, token)
+}
+
+// GetClientByResumeToken returns the client that a resume token refers to, or nil if the token does not exist.
+func (db *ClientDB) GetClientByResumeToken(token string) *structs.Client {
+
+	// Get read lock
+	db.queryLock.RLock()
+
+	// Return match and free lock
+	defer db.queryLock.RUnlock()
+	return db.resumeTokens[token]
 }
 
+// Attach makes a client that was connected to another server local to this server.
+// Clients are kept in memory and shared by every server in this process, so this only saves the client.
+func (db *ClientDB) Attach(client *structs.Client) {
+	db.Update(client)
+}
+
+// Detach forgets a local client whose session was resumed on another server.
+// Clients are kept in memory and shared by every server in this process, so there is nothing to forget.
+func (db *ClientDB) Detach(client *structs.Client) {}
+
 // SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = (lobby) AND Peer = 1
 func (db *ClientDB) GetPeerClientsByUGIAndLobby(ugi string, lobby string) []*structs.Client {
-	log.Printf("[Client Manager] Finding all peers given UGI %s and lobby %s...", ugi, lobby)
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
-	// Return match and free lock
-	defer db.queryLock.Unlock()
+	// Return matches and free lock
+	defer db.queryLock.RUnlock()
 	return func() (res []*structs.Client) {
-		for _, client := range db.clients {
-			if client.UGI == ugi && client.Lobby == lobby && client.IsPeer {
-				log.Printf("[Client Manager] Found match, appending client %d...", client.ID)
+		for _, client := range db.byLobby[lobbyIndexKey{ugi: ugi, lobby: lobby}] {
+			if client.IsPeer {
 				res = append(res, client)
 			}
 		}
-		if len(res) == 0 {
-			log.Printf("[Client Manager] No peers found matching lobby %s in UGI %s", lobby, ugi)
-		}
 		return res
 	}()
 }
 
 // SELECT client FROM clients WHERE ULID = (ulid) AND UGI = (ugi) AND Lobby = (lobby)
 func (db *ClientDB) GetClientBySpecificULIDinUGIAndLobby(ulid string, ugi string, lobby string) *structs.Client {
-	log.Printf("[Client Manager] Finding peer given ULID %s in UGI %s and lobby %s...", ulid, ugi, lobby)
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
 	// Return match and free lock
-	defer db.queryLock.Unlock()
-	return func() *structs.Client {
-		for _, client := range db.clients {
-			if client.UGI == ugi && client.Lobby == lobby && client.ULID == ulid {
-				log.Printf("[Client Manager] Found match, returning client %d...", client.ID)
-				return client
-			}
-		}
-		log.Printf("[Client Manager] No peer found matching ULID %s in lobby %s in UGI %s", ulid, lobby, ugi)
+	defer db.queryLock.RUnlock()
+	client, ok := db.byULID[ulid]
+	if !ok || ulid == "" {
 		return nil
-	}()
+	}
+	if entry := db.indexed[client.ID]; entry.ugi != ugi || entry.lobby != lobby {
+		return nil
+	}
+	return client
 }
 
 // SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = (lobby) AND Host = 1 AND Peer = 0
 func (db *ClientDB) GetHostClientsByUGIAndLobby(ugi string, lobby string) []*structs.Client {
-	log.Printf("[Client Manager] Finding all hosts given UGI %s and lobby %s...", ugi, lobby)
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
-	// Return match and free lock
-	defer db.queryLock.Unlock()
+	// Return matches and free lock
+	defer db.queryLock.RUnlock()
 	return func() (res []*structs.Client) {
-		for _, client := range db.clients {
-			if client.UGI == ugi && client.Lobby == lobby && client.IsHost {
-				log.Printf("[Client Manager] Found match, appending client %d...", client.ID)
+		for _, client := range db.byLobby[lobbyIndexKey{ugi: ugi, lobby: lobby}] {
+			if client.IsHost {
 				res = append(res, client)
 			}
 		}
-		if len(res) == 0 {
-			log.Printf("[Client Manager] No host found matching lobby %s in UGI %s", lobby, ugi)
-		}
 		return res
 	}()
 }
 
 // SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = ""
 func (db *ClientDB) GetAllClientsWithoutLobby(ugi string) []*structs.Client {
-	log.Printf("[Client Manager] Finding all clients without a lobby in UGI %s...", ugi)
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
-	// Return match and free lock
-	defer db.queryLock.Unlock()
+	// Return matches and free lock
+	defer db.queryLock.RUnlock()
 	return func() (res []*structs.Client) {
-		for _, client := range db.clients {
-			if client.UGI == ugi && client.Lobby == "" {
-				log.Printf("[Client Manager] Found match, appending client %d...", client.ID)
-				res = append(res, client)
-			}
-		}
-		if len(res) == 0 {
-			log.Printf("[Client Manager] No clients found without a lobby in UGI %s", ugi)
+		for _, client := range db.byLobby[lobbyIndexKey{ugi: ugi, lobby: ""}] {
+			res = append(res, client)
 		}
 		return res
 	}()
@@ -213,13 +359,12 @@ func (db *ClientDB) GetAllClientsWithoutLobby(ugi string) []*structs.Client {
 
 // SELECT ulid FROM clients
 func (db *ClientDB) GetAllClientULIDs() []string {
-	log.Println("[Client Manager] Gathering all client ULIDs...")
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
 	// Return all IDs and free lock
-	defer db.queryLock.Unlock()
+	defer db.queryLock.RUnlock()
 	return func() (ulids []string) {
 		for _, client := range db.clients {
 			ulids = append(ulids, client.ULID)
@@ -230,13 +375,12 @@ func (db *ClientDB) GetAllClientULIDs() []string {
 
 // SELECT client FROM clients
 func (db *ClientDB) GetAllClients() []*structs.Client {
-	log.Println("[Client Manager] Gathering all clients...")
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
 	// Return all clients and free lock
-	defer db.queryLock.Unlock()
+	defer db.queryLock.RUnlock()
 	return func() (clients []*structs.Client) {
 		for _, client := range db.clients {
 			clients = append(clients, client)
@@ -249,37 +393,28 @@ func (db *ClientDB) GetAllClients() []*structs.Client {
 func (db *ClientDB) GetClientsByUGI(ugi string) []*structs.Client {
 
 	// Get read lock
-	db.queryLock.Lock()
-
-	log.Printf("[Client Manager] Gathering all clients with UGI %s...", ugi)
+	db.queryLock.RLock()
 
-	defer db.queryLock.Unlock()
+	defer db.queryLock.RUnlock()
 	return func() (clients []*structs.Client) {
-		for _, client := range db.clients {
-			if strings.Compare(client.UGI, ugi) == 0 {
-				clients = append(clients, client)
-			}
+		for _, client := range db.byUGI[ugi] {
+			clients = append(clients, client)
 		}
 		return clients
 	}()
 }
 
 // GetAllHostsByUGI returns all clients that are hosts for the given UGI.
-// SELECT * FROM clients WHERE UGI LIKE (ugi) AND IsPeer = 1
+// SELECT * FROM clients WHERE UGI LIKE (ugi) AND IsPeer = 0
 func (db *ClientDB) GetAllHostsByUGI(ugi string) []*structs.Client {
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
-	log.Printf("[Client Manager] Gathering all hosts within UGI %s...", ugi)
-
-	defer db.queryLock.Unlock()
+	defer db.queryLock.RUnlock()
 	return func() (clients []*structs.Client) {
-		for _, client := range db.clients {
-			if client.IsPeer {
-				continue
-			}
-			if strings.Compare(client.UGI, ugi) == 0 {
+		for _, client := range db.byUGI[ugi] {
+			if !client.IsPeer {
 				clients = append(clients, client)
 			}
 		}
@@ -288,52 +423,50 @@ func (db *ClientDB) GetAllHostsByUGI(ugi string) []*structs.Client {
 }
 
 // GetAllPublicLobbiesByUGI returns all lobbies that are public for the given UGI.
+// Only lobbies that currently have a host are returned.
 func (db *ClientDB) GetAllPublicLobbiesByUGI(ugi string) []string {
 
 	// Get read lock
-	db.queryLock.Lock()
-
-	log.Printf("[Client Manager] Gathering all public lobbies within UGI %s...", ugi)
+	db.queryLock.RLock()
 
 	lobbies := []string{}
-	defer db.queryLock.Unlock()
-	for _, client := range db.clients {
-		if client.IsPeer {
-			continue
-		}
-		if !client.IsHost {
-			continue
+	defer db.queryLock.RUnlock()
+	for name, lobby := range db.Lobbies[ugi] {
+		if lobby.IsPublic && lobby.CurrentOwnerULID != "" {
+			lobbies = append(lobbies, name)
 		}
-		if strings.Compare(client.UGI, ugi) == 0 {
-			// Skip if there is no lobby entry for this UGI
-			if _, ok := db.Lobbies[ugi]; !ok {
-				continue
-			}
+	}
+	return lobbies
+}
 
-			// If the lobby is public, add it to the list
-			if db.Lobbies[ugi][client.Lobby].IsPublic {
-				lobbies = append(lobbies, client.Lobby)
-			}
+// GetAllLobbiesByUGI returns all lobbies for the given UGI, public or not.
+// Only lobbies that currently have a host are returned.
+func (db *ClientDB) GetAllLobbiesByUGI(ugi string) []string {
+
+	// Get read lock
+	db.queryLock.RLock()
+
+	lobbies := []string{}
+	defer db.queryLock.RUnlock()
+	for name, lobby := range db.Lobbies[ugi] {
+		if lobby.CurrentOwnerULID != "" {
+			lobbies = append(lobbies, name)
 		}
 	}
 	return lobbies
 }
 
-// GetAllHostsByUGI returns all clients that are peers for the given UGI.
+// GetAllPeersByUGI returns all clients that are peers for the given UGI.
 // SELECT * FROM clients WHERE UGI LIKE (ugi) AND IsHost = 0
 func (db *ClientDB) GetAllPeersByUGI(ugi string) []*structs.Client {
-	log.Printf("[Client Manager] Gathering all peers within UGI %s...", ugi)
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
-	defer db.queryLock.Unlock()
+	defer db.queryLock.RUnlock()
 	return func() (clients []*structs.Client) {
-		for _, client := range db.clients {
-			if client.IsHost {
-				continue
-			}
-			if strings.Compare(client.UGI, ugi) == 0 {
+		for _, client := range db.byUGI[ugi] {
+			if !client.IsHost {
 				clients = append(clients, client)
 			}
 		}
@@ -342,16 +475,14 @@ func (db *ClientDB) GetAllPeersByUGI(ugi string) []*structs.Client {
 }
 
 // GetClientsByUsernameSimilarTo returns all clients that have a username similar to the query.
-// Each individual client will get a read lock if matched.
 // SELECT * FROM clients WHERE Name LIKE (query)%
 func (db *ClientDB) GetClientsByUsernameSimilarTo(query string) []*structs.Client {
-	log.Printf("[Client Manager] Finding all clients with similar username: %s...", query)
 
 	// Get read lock
-	db.queryLock.Lock()
+	db.queryLock.RLock()
 
 	// Return all matches and release locks
-	defer db.queryLock.Unlock()
+	defer db.queryLock.RUnlock()
 	return func() (clients []*structs.Client) {
 		for _, client := range db.clients {
 			if strings.Contains(client.Username, query) {
@@ -361,3 +492,80 @@ func (db *ClientDB) GetClientsByUsernameSimilarTo(query string) []*structs.Clien
 		return clients
 	}()
 }
+
+// ClaimLobbyOwnership atomically makes the client the owner of a lobby, but only if the lobby currently has no owner.
+// Returns true if the client is now the owner of the lobby.
+// UPDATE lobbies SET Owner = (client) WHERE UGI = (ugi) AND ID = (lobby) AND Owner IS NULL
+func (db *ClientDB) ClaimLobbyOwnership(ugi string, lobbyname string, client *structs.Client) bool {
+
+	// Get write lock
+	db.queryLock.Lock()
+
+	log.Printf("[Client Manager] Client %d is claiming ownership of lobby %s in UGI %s...", client.ID, lobbyname, ugi)
+
+	// Claim lobby and free lock
+	defer db.queryLock.Unlock()
+	return func() bool {
+		if _, ok := db.Lobbies[ugi]; !ok {
+			return false
+		}
+		lobby, ok := db.Lobbies[ugi][lobbyname]
+		if !ok || lobby.CurrentOwnerULID != "" {
+			log.Printf("[Client Manager] Client %d failed to claim lobby %s in UGI %s", client.ID, lobbyname, ugi)
+			return false
+		}
+		lobby.CurrentOwnerID = client.ID
+		lobby.CurrentOwnerULID = client.ULID
+		lobby.CurrentOwnerUsername = client.Username
+		return true
+	}()
+}
+
+// ReleaseLobbyOwnership removes the current owner of a lobby so that it can be claimed again.
+// UPDATE lobbies SET Owner = NULL WHERE UGI = (ugi) AND ID = (lobby)
+func (db *ClientDB) ReleaseLobbyOwnership(ugi string, lobbyname string) {
+
+	// Get write lock
+	db.queryLock.Lock()
+
+	log.Printf("[Client Manager] Releasing ownership of lobby %s in UGI %s...", lobbyname, ugi)
+
+	// Release lobby and free lock
+	defer db.queryLock.Unlock()
+	if _, ok := db.Lobbies[ugi]; !ok {
+		return
+	}
+	if lobby, ok := db.Lobbies[ugi][lobbyname]; ok {
+		lobby.CurrentOwnerID = 0
+		lobby.CurrentOwnerULID = ""
+		lobby.CurrentOwnerUsername = ""
+	}
+}
+
+// TransferLobbyOwnership atomically moves the ownership of a lobby from one client to another.
+// Returns true if the transfer succeeded, or false if the current owner of the lobby is not the "from" client.
+// UPDATE lobbies SET Owner = (to) WHERE UGI = (ugi) AND ID = (lobby) AND Owner = (from)
+func (db *ClientDB) TransferLobbyOwnership(ugi string, lobbyname string, from *structs.Client, to *structs.Client) bool {
+
+	// Get write lock
+	db.queryLock.Lock()
+
+	log.Printf("[Client Manager] Transferring ownership of lobby %s in UGI %s from client %d to client %d...", lobbyname, ugi, from.ID, to.ID)
+
+	// Transfer lobby and free lock
+	defer db.queryLock.Unlock()
+	return func() bool {
+		if _, ok := db.Lobbies[ugi]; !ok {
+			return false
+		}
+		lobby, ok := db.Lobbies[ugi][lobbyname]
+		if !ok || lobby.CurrentOwnerULID != from.ULID {
+			log.Printf("[Client Manager] Client %d does not own lobby %s in UGI %s", from.ID, lobbyname, ugi)
+			return false
+		}
+		lobby.CurrentOwnerID = to.ID
+		lobby.CurrentOwnerULID = to.ULID
+		lobby.CurrentOwnerUsername = to.Username
+		return true
+	}()
+}
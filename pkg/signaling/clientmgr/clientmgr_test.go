@@ -0,0 +1,111 @@
+package clientmgr
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+)
+
+// Client counts to benchmark queries at.
+var benchmarkSizes = []int{1000, 5000}
+
+// Games and lobby sizes of benchmark client managers.
+const (
+	benchmarkGames      = 10
+	benchmarkLobbyPeers = 8
+)
+
+// UGIs of the games in benchmark client managers.
+var benchmarkUGIs = func() (ugis []string) {
+	for i := 0; i < benchmarkGames; i++ {
+		ugis = append(ugis, fmt.Sprintf("game-%d", i))
+	}
+	return ugis
+}()
+
+// newBenchmarkClientDB fills an in-memory client manager with clients spread over several games.
+// Every game has lobbies of one host and several peers, and every other lobby is public. Returns the ULIDs of the clients.
+func newBenchmarkClientDB(b *testing.B, clients int) (*ClientDB, []string) {
+	b.Helper()
+
+	// Adding thousands of clients would otherwise log every one of them
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	db := New()
+	ulids := make([]string, clients)
+	for i := range ulids {
+		ugi := benchmarkUGIs[i%benchmarkGames]
+		index := i / benchmarkGames / (benchmarkLobbyPeers + 1)
+		lobby := fmt.Sprintf("lobby-%d", index)
+		host := (i/benchmarkGames)%(benchmarkLobbyPeers+1) == 0
+
+		ulids[i] = fmt.Sprintf("client-%d", i)
+		client := db.Add(&structs.Client{
+			UGI:          ugi,
+			ULID:         ulids[i],
+			Username:     ulids[i],
+			ValidSession: true,
+			Lobby:        lobby,
+			IsHost:       host,
+			IsPeer:       !host,
+		})
+		if host {
+			config := db.CreateLobbyConfigStorage(ugi, lobby)
+			config.IsPublic = index%2 == 0
+			db.ClaimLobbyOwnership(ugi, lobby, client)
+		}
+	}
+	return db, ulids
+}
+
+func BenchmarkGetClientByULID(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("%d clients", size), func(b *testing.B) {
+			db, ulids := newBenchmarkClientDB(b, size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if db.GetClientByULID(ulids[i%len(ulids)]) == nil {
+					b.Fatal("Client not found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetPeerClientsByUGIAndLobby(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("%d clients", size), func(b *testing.B) {
+			db, _ := newBenchmarkClientDB(b, size)
+			lobbies := make([]string, size/benchmarkGames/(benchmarkLobbyPeers+1))
+			for i := range lobbies {
+				lobbies[i] = fmt.Sprintf("lobby-%d", i)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ugi, lobby := benchmarkUGIs[i%benchmarkGames], lobbies[i%len(lobbies)]
+				if len(db.GetPeerClientsByUGIAndLobby(ugi, lobby)) != benchmarkLobbyPeers {
+					b.Fatalf("Lobby %s in %s doesn't have %d peers", lobby, ugi, benchmarkLobbyPeers)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetAllPublicLobbiesByUGI(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("%d clients", size), func(b *testing.B) {
+			db, _ := newBenchmarkClientDB(b, size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if len(db.GetAllPublicLobbiesByUGI(benchmarkUGIs[i%benchmarkGames])) == 0 {
+					b.Fatal("No public lobbies found")
+				}
+			}
+		})
+	}
+}
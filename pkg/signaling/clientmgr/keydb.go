@@ -0,0 +1,587 @@
+package clientmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyDB is a signaling client manager backed by a KeyDB (or any other Redis protocol compatible) server.
+//
+// Client records and lobby config stores are shared between every server connected to the same KeyDB server,
+// which allows running multiple signaling servers behind a load balancer. Websocket connections are not
+// shareable, so clients connected to this server are also kept in memory. Clients connected to other servers
+// are returned as copies without a connection.
+type KeyDB struct {
+	rdb       redis.UniversalClient
+	ctx       context.Context
+	local     map[uint64]*structs.Client // Clients connected to this server.
+	localLock sync.RWMutex
+}
+
+// ClientTTL is how long clients and lobbies are kept in KeyDB after the server they are connected to stops refreshing them,
+// i.e. because it crashed. Servers refresh their clients, and the lobbies those clients host, every third of this time.
+var ClientTTL = 90 * time.Second
+
+// How many times an update is retried when another server changes the client at the same time.
+const updateRetries = 3
+
+// Returned while updating a client that was deleted (i.e. by another server) since it was read.
+var errClientDeleted = errors.New("client was deleted")
+
+// Keys used by the KeyDB client manager.
+const (
+	keyPrefix   = "clomega"
+	syncChannel = keyPrefix + ":sync" // Publishes the ID of a client that was updated by another server.
+)
+
+// Atomically replaces the owner of a lobby, but only if the ULID of the current owner matches ARGV[1].
+var lobbyClaimScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'owner_ulid') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'owner_id', ARGV[2], 'owner_ulid', ARGV[3], 'owner_username', ARGV[4])
+return 1
+`)
+
+// Atomically creates a lobby config store, but only if the lobby does not exist yet.
+var lobbyCreateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'id', ARGV[1], 'max_peers', 0, 'allow_host_reclaim', 0, 'allow_peers_to_reclaim', 0,
+	'owner_id', 0, 'owner_ulid', '', 'owner_username', '', 'password', '', 'public', 0, 'locked', 0)
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+redis.call('SADD', KEYS[2], ARGV[1])
+return 1
+`)
+
+func clientKey(id uint64) string {
+	return fmt.Sprintf("%s:client:%d", keyPrefix, id)
+}
+
+func ulidsKey() string {
+	return keyPrefix + ":ulids"
+}
+
+func resumeTokensKey() string {
+	return keyPrefix + ":resume_tokens"
+}
+
+func membersKey(ugi string, lobby string) string {
+	return fmt.Sprintf("%s:ugi:%s:members:%s", keyPrefix, ugi, lobby)
+}
+
+func lobbiesKey(ugi string) string {
+	return fmt.Sprintf("%s:ugi:%s:lobbies", keyPrefix, ugi)
+}
+
+func lobbyKey(ugi string, lobby string) string {
+	return fmt.Sprintf("%s:ugi:%s:lobby:%s", keyPrefix, ugi, lobby)
+}
+
+// NewKeyDB creates a new KeyDB client manager using an existing Redis client.
+func NewKeyDB(rdb redis.UniversalClient) *KeyDB {
+	log.Print("[Client Manager] Initializing new KeyDB signaling client manager...")
+	db := &KeyDB{
+		rdb:   rdb,
+		ctx:   context.Background(),
+		local: make(map[uint64]*structs.Client),
+	}
+
+	// Listen for clients that were updated by other servers
+	pubsub := rdb.Subscribe(db.ctx, syncChannel)
+	go db.listen(pubsub)
+
+	// Keep the clients of this server alive in KeyDB
+	go func() {
+		for range time.Tick(ClientTTL / 3) {
+			db.refresh()
+		}
+	}()
+
+	return db
+}
+
+// refresh resets the TTL of every client connected to this server, and of every lobby they host.
+// Clients and lobbies of servers that stopped refreshing them expire on their own.
+func (db *KeyDB) refresh() {
+	db.localLock.RLock()
+	clients := make([]*structs.Client, 0, len(db.local))
+	for _, client := range db.local {
+		clients = append(clients, client)
+	}
+	db.localLock.RUnlock()
+
+	pipe := db.rdb.Pipeline()
+	for _, client := range clients {
+		client.Lock.RLock()
+		pipe.Expire(db.ctx, clientKey(client.ID), ClientTTL)
+		if client.IsHost && client.Lobby != "" {
+			pipe.Expire(db.ctx, lobbyKey(client.UGI, client.Lobby), ClientTTL)
+		}
+		client.Lock.RUnlock()
+	}
+	if _, err := pipe.Exec(db.ctx); err != nil && err != redis.Nil {
+		log.Printf("[Client Manager] Failed to refresh clients: %s", err)
+	}
+}
+
+// expired returns true if a key no longer exists. Errors are logged, and treated as if the key exists.
+func (db *KeyDB) expired(key string) bool {
+	n, err := db.rdb.Exists(db.ctx, key).Result()
+	if err != nil {
+		log.Printf("[Client Manager] Failed to check %s: %s", key, err)
+		return false
+	}
+	return n == 0
+}
+
+// listen refreshes local clients whenever another server updates them (i.e. promoting a peer to a host).
+func (db *KeyDB) listen(pubsub *redis.PubSub) {
+	for msg := range pubsub.Channel() {
+		id, err := strconv.ParseUint(msg.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		db.localLock.RLock()
+		client, ok := db.local[id]
+		db.localLock.RUnlock()
+		if !ok {
+			continue
+		}
+
+		remote := &structs.Client{}
+		if err := db.rdb.HGetAll(db.ctx, clientKey(id)).Scan(remote); err != nil {
+			log.Printf("[Client Manager] Failed to refresh client %d: %s", id, err)
+			continue
+		}
+
+		log.Printf("[Client Manager] Refreshing client %d after a remote update...", id)
+		func() {
+			client.Lock.Lock()
+			defer client.Lock.Unlock()
+			client.IsHost = remote.IsHost
+			client.IsPeer = remote.IsPeer
+			client.Lobby = remote.Lobby
+			client.PublicKey = remote.PublicKey
+		}()
+	}
+}
+
+// get returns the client with the given ID. Local clients are returned as-is, remote clients are loaded from KeyDB.
+func (db *KeyDB) get(id uint64) *structs.Client {
+	db.localLock.RLock()
+	client, ok := db.local[id]
+	db.localLock.RUnlock()
+	if ok {
+		return client
+	}
+
+	cmd := db.rdb.HGetAll(db.ctx, clientKey(id))
+	if res, err := cmd.Result(); err != nil || len(res) == 0 {
+		return nil
+	}
+
+	client = &structs.Client{}
+	if err := cmd.Scan(client); err != nil {
+		log.Printf("[Client Manager] Failed to load client %d: %s", id, err)
+		return nil
+	}
+	return client
+}
+
+// members returns every client within a UGI and lobby. An empty lobby returns all clients without a lobby.
+func (db *KeyDB) members(ugi string, lobby string) (clients []*structs.Client) {
+	ids, err := db.rdb.SMembers(db.ctx, membersKey(ugi, lobby)).Result()
+	if err != nil {
+		log.Printf("[Client Manager] Failed to find clients in lobby %s in UGI %s: %s", lobby, ugi, err)
+		return nil
+	}
+	for _, raw := range ids {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			continue
+		}
+		client := db.get(id)
+		if client == nil {
+			// Forget clients that expired after their server stopped refreshing them
+			if db.expired(clientKey(id)) {
+				db.rdb.SRem(db.ctx, membersKey(ugi, lobby), id)
+			}
+			continue
+		}
+		if client.UGI == ugi && client.Lobby == lobby {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// INSERT INTO clients (Game, Name) VALUES (?, ?)
+func (db *KeyDB) Add(client *structs.Client) *structs.Client {
+	id, err := db.rdb.Incr(db.ctx, keyPrefix+":client_id").Result()
+	if err != nil {
+		log.Printf("[Client Manager] Failed to allocate a client ID: %s", err)
+		return nil
+	}
+	client.ID = uint64(id)
+
+	log.Printf("[Client Manager] Adding client (%d) in %s...", client.ID, client.UGI)
+
+	db.localLock.Lock()
+	db.local[client.ID] = client
+	db.localLock.Unlock()
+
+	if _, err := db.rdb.TxPipelined(db.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(db.ctx, clientKey(client.ID), client)
+		pipe.Expire(db.ctx, clientKey(client.ID), ClientTTL)
+		pipe.SAdd(db.ctx, membersKey(client.UGI, client.Lobby), client.ID)
+		return nil
+	}); err != nil {
+		log.Printf("[Client Manager] Failed to add client %d: %s", client.ID, err)
+	}
+
+	return client
+}
+
+// UPDATE clients SET ... WHERE ID = (client.ID)
+//
+// Clients that were deleted (i.e. by another server while this one was updating them) are not recreated.
+func (db *KeyDB) Update(client *structs.Client) {
+	db.localLock.RLock()
+	_, isLocal := db.local[client.ID]
+	db.localLock.RUnlock()
+
+	var err error
+	for i := 0; i < updateRetries; i++ {
+		if err = db.rdb.Watch(db.ctx, func(tx *redis.Tx) error {
+			return db.update(tx, client, isLocal)
+		}, clientKey(client.ID)); err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err == errClientDeleted {
+		log.Printf("[Client Manager] Not updating client %d: it was deleted", client.ID)
+	} else if err != nil {
+		log.Printf("[Client Manager] Failed to update client %d: %s", client.ID, err)
+	}
+}
+
+// update saves a client within a transaction that fails if the client is changed or deleted before it is saved.
+func (db *KeyDB) update(tx *redis.Tx, client *structs.Client, isLocal bool) error {
+	cmd := tx.HGetAll(db.ctx, clientKey(client.ID))
+	if res, err := cmd.Result(); err != nil {
+		return err
+	} else if len(res) == 0 {
+		return errClientDeleted
+	}
+	old := &structs.Client{}
+	if err := cmd.Scan(old); err != nil {
+		return err
+	}
+
+	_, err := tx.TxPipelined(db.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(db.ctx, clientKey(client.ID), client)
+
+		// Move the client between lobbies
+		if old.Lobby != client.Lobby {
+			pipe.SMove(db.ctx, membersKey(client.UGI, old.Lobby), membersKey(client.UGI, client.Lobby), client.ID)
+		}
+
+		// Keep the ULID index up to date
+		if old.ULID != client.ULID {
+			if old.ULID != "" {
+				pipe.HDel(db.ctx, ulidsKey(), old.ULID)
+			}
+			if client.ULID != "" {
+				pipe.HSet(db.ctx, ulidsKey(), client.ULID, client.ID)
+			}
+		}
+
+		// Tell the server that owns the client to refresh it
+		if !isLocal {
+			pipe.Publish(db.ctx, syncChannel, client.ID)
+		}
+		return nil
+	})
+	return err
+}
+
+// DELETE FROM clients WHERE ID = (client.ID)
+func (db *KeyDB) Delete(client *structs.Client) {
+	log.Printf("[Client Manager] Deleting client (%d) in %s...", client.ID, client.UGI)
+
+	// The stored lobby may differ from the client's lobby if the client was changed without being updated
+	old := &structs.Client{}
+	if err := db.rdb.HGetAll(db.ctx, clientKey(client.ID)).Scan(old); err != nil {
+		log.Printf("[Client Manager] Failed to read client %d: %s", client.ID, err)
+	}
+
+	db.localLock.Lock()
+	delete(db.local, client.ID)
+	db.localLock.Unlock()
+
+	if _, err := db.rdb.TxPipelined(db.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(db.ctx, clientKey(client.ID))
+		pipe.SRem(db.ctx, membersKey(client.UGI, client.Lobby), client.ID)
+		if old.Lobby != client.Lobby {
+			pipe.SRem(db.ctx, membersKey(client.UGI, old.Lobby), client.ID)
+		}
+		if client.ULID != "" {
+			pipe.HDel(db.ctx, ulidsKey(), client.ULID)
+		}
+		return nil
+	}); err != nil {
+		log.Printf("[Client Manager] Failed to delete client %d: %s", client.ID, err)
+	}
+}
+
+// SELECT client FROM clients WHERE ULID = (ulid)
+func (db *KeyDB) GetClientByULID(query string) *structs.Client {
+	if query == "" {
+		return nil
+	}
+	id, err := db.rdb.HGet(db.ctx, ulidsKey(), query).Uint64()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("[Client Manager] Failed to find client given ULID %s: %s", query, err)
+		}
+		return nil
+	}
+	client := db.get(id)
+	if client == nil && db.expired(clientKey(id)) {
+		db.rdb.HDel(db.ctx, ulidsKey(), query)
+	}
+	return client
+}
+
+// SetResumeToken makes a resume token refer to a client, so that the client can be found by any server.
+func (db *KeyDB) SetResumeToken(token string, client *structs.Client) {
+	if err := db.rdb.HSet(db.ctx, resumeTokensKey(), token, client.ID).Err(); err != nil {
+		log.Printf("[Client Manager] Failed to store resume token of client %d: %s", client.ID, err)
+	}
+}
+
+// DeleteResumeToken removes a resume token.
+func (db *KeyDB) DeleteResumeToken(token string) {
+	if err := db.rdb.HDel(db.ctx, resumeTokensKey(), token).Err(); err != nil {
+		log.Printf("[Client Manager] Failed to delete resume token: %s", err)
+	}
+}
+
+// GetClientByResumeToken returns the client that a resume token refers to, or nil if the token does not exist.
+// Clients connected to other servers are returned as copies; their server must hand them over before they are resumed.
+func (db *KeyDB) GetClientByResumeToken(token string) *structs.Client {
+	id, err := db.rdb.HGet(db.ctx, resumeTokensKey(), token).Uint64()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("[Client Manager] Failed to find client given a resume token: %s", err)
+		}
+		return nil
+	}
+	return db.get(id)
+}
+
+// Attach makes a client that was connected to another server local to this server, after resuming its session here.
+func (db *KeyDB) Attach(client *structs.Client) {
+	log.Printf("[Client Manager] Attaching client (%d) in %s...", client.ID, client.UGI)
+
+	db.localLock.Lock()
+	db.local[client.ID] = client
+	db.localLock.Unlock()
+
+	db.Update(client)
+}
+
+// Detach forgets a local client whose session was resumed on another server, without deleting it.
+func (db *KeyDB) Detach(client *structs.Client) {
+	log.Printf("[Client Manager] Detaching client (%d) in %s...", client.ID, client.UGI)
+
+	db.localLock.Lock()
+	delete(db.local, client.ID)
+	db.localLock.Unlock()
+}
+
+// SELECT client FROM clients WHERE ULID = (ulid) AND UGI = (ugi) AND Lobby = (lobby)
+func (db *KeyDB) GetClientBySpecificULIDinUGIAndLobby(ulid string, ugi string, lobby string) *structs.Client {
+	client := db.GetClientByULID(ulid)
+	if client == nil || client.UGI != ugi || client.Lobby != lobby {
+		return nil
+	}
+	return client
+}
+
+// SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = (lobby) AND Peer = 1
+func (db *KeyDB) GetPeerClientsByUGIAndLobby(ugi string, lobby string) (res []*structs.Client) {
+	for _, client := range db.members(ugi, lobby) {
+		if client.IsPeer {
+			res = append(res, client)
+		}
+	}
+	return res
+}
+
+// SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = (lobby) AND Host = 1 AND Peer = 0
+func (db *KeyDB) GetHostClientsByUGIAndLobby(ugi string, lobby string) (res []*structs.Client) {
+	for _, client := range db.members(ugi, lobby) {
+		if client.IsHost {
+			res = append(res, client)
+		}
+	}
+	return res
+}
+
+// SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = ""
+func (db *KeyDB) GetAllClientsWithoutLobby(ugi string) []*structs.Client {
+	return db.members(ugi, "")
+}
+
+// GetAllPublicLobbiesByUGI returns all lobbies that are public and have a host for the given UGI.
+func (db *KeyDB) GetAllPublicLobbiesByUGI(ugi string) []string {
+	lobbies := []string{}
+	names, err := db.rdb.SMembers(db.ctx, lobbiesKey(ugi)).Result()
+	if err != nil {
+		log.Printf("[Client Manager] Failed to gather public lobbies within UGI %s: %s", ugi, err)
+		return lobbies
+	}
+	for _, name := range names {
+		if lobby := db.getLobby(ugi, name); lobby != nil && lobby.IsPublic && lobby.CurrentOwnerULID != "" {
+			lobbies = append(lobbies, name)
+		}
+	}
+	return lobbies
+}
+
+// GetAllLobbiesByUGI returns all lobbies for the given UGI, public or not.
+// Only lobbies that currently have a host are returned.
+func (db *KeyDB) GetAllLobbiesByUGI(ugi string) []string {
+	lobbies := []string{}
+	names, err := db.rdb.SMembers(db.ctx, lobbiesKey(ugi)).Result()
+	if err != nil {
+		log.Printf("[Client Manager] Failed to gather lobbies within UGI %s: %s", ugi, err)
+		return lobbies
+	}
+	for _, name := range names {
+		if lobby := db.getLobby(ugi, name); lobby != nil && lobby.CurrentOwnerULID != "" {
+			lobbies = append(lobbies, name)
+		}
+	}
+	return lobbies
+}
+
+// getLobby returns a lobby listed in a UGI, forgetting the lobby if it expired after its host's server stopped refreshing it.
+func (db *KeyDB) getLobby(ugi string, lobbyname string) *structs.LobbyConfigStore {
+	lobby := db.GetLobbyConfigStorage(ugi, lobbyname)
+	if lobby == nil && db.expired(lobbyKey(ugi, lobbyname)) {
+		db.rdb.SRem(db.ctx, lobbiesKey(ugi), lobbyname)
+	}
+	return lobby
+}
+
+// CreateLobbyConfigStorage creates a new lobby config store for a specified UGI.
+// Returns the lobby config store, or nil if the lobby already exists (possibly created by another server).
+func (db *KeyDB) CreateLobbyConfigStorage(ugi string, lobbyname string) *structs.LobbyConfigStore {
+	log.Printf("[Client Manager] Creating lobby %s configuration store in UGI %s...", lobbyname, ugi)
+	res, err := lobbyCreateScript.Run(db.ctx, db.rdb, []string{lobbyKey(ugi, lobbyname), lobbiesKey(ugi)}, lobbyname, int(ClientTTL.Seconds())).Int()
+	if err != nil {
+		log.Printf("[Client Manager] Failed to create lobby %s in UGI %s: %s", lobbyname, ugi, err)
+		return nil
+	}
+	if res != 1 {
+		return nil
+	}
+	return &structs.LobbyConfigStore{ID: lobbyname}
+}
+
+// GetLobbyConfigStorage returns a copy of the lobby config store for a lobby, or nil if it does not exist.
+func (db *KeyDB) GetLobbyConfigStorage(ugi string, lobbyname string) *structs.LobbyConfigStore {
+	cmd := db.rdb.HGetAll(db.ctx, lobbyKey(ugi, lobbyname))
+	if res, err := cmd.Result(); err != nil || len(res) == 0 {
+		return nil
+	}
+	lobby := &structs.LobbyConfigStore{}
+	if err := cmd.Scan(lobby); err != nil {
+		log.Printf("[Client Manager] Failed to read lobby %s in UGI %s: %s", lobbyname, ugi, err)
+		return nil
+	}
+	return lobby
+}
+
+// UpdateLobbyConfigStorage saves changes made to a lobby config store.
+// The owner of the lobby is not saved; use the lobby ownership functions instead.
+func (db *KeyDB) UpdateLobbyConfigStorage(ugi string, lobbyname string, lobby *structs.LobbyConfigStore) {
+	if n, err := db.rdb.Exists(db.ctx, lobbyKey(ugi, lobbyname)).Result(); err != nil || n == 0 {
+		return
+	}
+	if err := db.rdb.HSet(db.ctx, lobbyKey(ugi, lobbyname),
+		"id", lobby.ID,
+		"max_peers", lobby.MaximumPeers,
+		"allow_host_reclaim", lobby.AllowHostReclaim,
+		"allow_peers_to_reclaim", lobby.AllowPeersToReclaim,
+		"password", lobby.Password,
+		"public", lobby.IsPublic,
+		"locked", lobby.Locked,
+	).Err(); err != nil {
+		log.Printf("[Client Manager] Failed to update lobby %s in UGI %s: %s", lobbyname, ugi, err)
+	}
+}
+
+// DeleteLobbyConfigStorage deletes the lobby config store for a lobby.
+func (db *KeyDB) DeleteLobbyConfigStorage(ugi string, lobbyname string) {
+	log.Printf("[Client Manager] Deleting unused lobby config store %s in UGI %s...", lobbyname, ugi)
+	if _, err := db.rdb.TxPipelined(db.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(db.ctx, lobbyKey(ugi, lobbyname))
+		pipe.SRem(db.ctx, lobbiesKey(ugi), lobbyname)
+		return nil
+	}); err != nil {
+		log.Printf("[Client Manager] Failed to delete lobby %s in UGI %s: %s", lobbyname, ugi, err)
+	}
+}
+
+// setLobbyOwner atomically replaces the owner of a lobby, but only if the current owner's ULID matches.
+func (db *KeyDB) setLobbyOwner(ugi string, lobbyname string, expected string, owner *structs.Client) bool {
+	var id uint64
+	var ulid, username string
+	if owner != nil {
+		id, ulid, username = owner.ID, owner.ULID, owner.Username
+	}
+	res, err := lobbyClaimScript.Run(db.ctx, db.rdb, []string{lobbyKey(ugi, lobbyname)}, expected, id, ulid, username).Int()
+	if err != nil {
+		log.Printf("[Client Manager] Failed to change owner of lobby %s in UGI %s: %s", lobbyname, ugi, err)
+		return false
+	}
+	return res == 1
+}
+
+// ClaimLobbyOwnership atomically makes the client the owner of a lobby, but only if the lobby currently has no owner.
+// Returns true if the client is now the owner of the lobby.
+func (db *KeyDB) ClaimLobbyOwnership(ugi string, lobbyname string, client *structs.Client) bool {
+	log.Printf("[Client Manager] Client %d is claiming ownership of lobby %s in UGI %s...", client.ID, lobbyname, ugi)
+	return db.setLobbyOwner(ugi, lobbyname, "", client)
+}
+
+// ReleaseLobbyOwnership removes the current owner of a lobby so that it can be claimed again.
+func (db *KeyDB) ReleaseLobbyOwnership(ugi string, lobbyname string) {
+	log.Printf("[Client Manager] Releasing ownership of lobby %s in UGI %s...", lobbyname, ugi)
+	lobby := db.GetLobbyConfigStorage(ugi, lobbyname)
+	if lobby == nil {
+		return
+	}
+	db.setLobbyOwner(ugi, lobbyname, lobby.CurrentOwnerULID, nil)
+}
+
+// TransferLobbyOwnership atomically moves the ownership of a lobby from one client to another.
+// Returns true if the transfer succeeded, or false if the current owner of the lobby is not the "from" client.
+func (db *KeyDB) TransferLobbyOwnership(ugi string, lobbyname string, from *structs.Client, to *structs.Client) bool {
+	log.Printf("[Client Manager] Transferring ownership of lobby %s in UGI %s from client %d to client %d...", lobbyname, ugi, from.ID, to.ID)
+	return db.setLobbyOwner(ugi, lobbyname, from.ULID, to)
+}
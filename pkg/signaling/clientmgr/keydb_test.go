@@ -0,0 +1,285 @@
+package clientmgr
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+)
+
+// newTestKeyDBs creates client managers for several servers sharing one in-memory KeyDB server.
+func newTestKeyDBs(t *testing.T, servers int) []*KeyDB {
+	dbs, _ := newTestKeyDBServer(t, servers)
+	return dbs
+}
+
+// newTestKeyDBServer is like newTestKeyDBs, but also returns the KeyDB server, i.e. to fast forward its clock.
+func newTestKeyDBServer(t *testing.T, servers int) ([]*KeyDB, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	dbs := make([]*KeyDB, servers)
+	for i := range dbs {
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { rdb.Close() })
+		dbs[i] = NewKeyDB(rdb)
+	}
+	return dbs, mr
+}
+
+// addTestClient adds a client with a ULID, like the INIT opcode does.
+func addTestClient(db *KeyDB, ugi string, ulid string) *structs.Client {
+	client := db.Add(&structs.Client{UGI: ugi})
+	client.ULID = ulid
+	client.Username = "user-" + ulid
+	client.ValidSession = true
+	db.Update(client)
+	return client
+}
+
+// joinTestLobby moves a client into a lobby as a host or a peer, like the CONFIG_HOST and CONFIG_PEER opcodes do.
+func joinTestLobby(db *KeyDB, client *structs.Client, lobby string, host bool) {
+	client.Lobby = lobby
+	client.IsHost = host
+	client.IsPeer = !host
+	db.Update(client)
+}
+
+func TestKeyDBAddDelete(t *testing.T) {
+	dbs := newTestKeyDBs(t, 2)
+	local, remote := dbs[0], dbs[1]
+
+	client := addTestClient(local, "ugi", "A")
+	if client.ID == 0 {
+		t.Fatal("Add did not assign a client ID")
+	}
+	if other := addTestClient(local, "ugi", "B"); other.ID == client.ID {
+		t.Fatalf("Add assigned ID %d twice", client.ID)
+	}
+
+	// Clients connected to this server are returned as-is
+	if got := local.GetClientByULID("A"); got != client {
+		t.Fatalf("GetClientByULID returned %v, want the local client", got)
+	}
+
+	// Clients connected to other servers are returned as copies
+	got := remote.GetClientByULID("A")
+	if got == nil || got == client || got.ID != client.ID || got.Username != client.Username || !got.ValidSession {
+		t.Fatalf("GetClientByULID on another server returned %+v, want a copy of client %d", got, client.ID)
+	}
+	if got := remote.GetClientBySpecificULIDinUGIAndLobby("A", "ugi", ""); got == nil {
+		t.Fatal("GetClientBySpecificULIDinUGIAndLobby did not find the client")
+	}
+	if got := remote.GetClientBySpecificULIDinUGIAndLobby("A", "other", ""); got != nil {
+		t.Fatal("GetClientBySpecificULIDinUGIAndLobby found the client in another UGI")
+	}
+	if got := remote.GetAllClientsWithoutLobby("ugi"); len(got) != 2 {
+		t.Fatalf("GetAllClientsWithoutLobby returned %d clients, want 2", len(got))
+	}
+
+	local.Delete(client)
+	if got := local.GetClientByULID("A"); got != nil {
+		t.Fatal("GetClientByULID found a deleted client")
+	}
+	if got := remote.GetClientByULID("A"); got != nil {
+		t.Fatal("GetClientByULID on another server found a deleted client")
+	}
+	if got := local.GetAllClientsWithoutLobby("ugi"); len(got) != 1 || got[0].ULID != "B" {
+		t.Fatalf("GetAllClientsWithoutLobby returned %v after a delete, want only client B", got)
+	}
+}
+
+func TestKeyDBLobbyQueries(t *testing.T) {
+	dbs := newTestKeyDBs(t, 2)
+	local, remote := dbs[0], dbs[1]
+
+	host := addTestClient(local, "ugi", "host")
+	peer := addTestClient(remote, "ugi", "peer")
+	idle := addTestClient(local, "ugi", "idle")
+
+	// Lobbies can only be created once, by any server
+	if local.CreateLobbyConfigStorage("ugi", "public") == nil {
+		t.Fatal("CreateLobbyConfigStorage failed to create a lobby")
+	}
+	if remote.CreateLobbyConfigStorage("ugi", "public") != nil {
+		t.Fatal("CreateLobbyConfigStorage created a lobby that already exists")
+	}
+
+	lobby := local.GetLobbyConfigStorage("ugi", "public")
+	if lobby == nil || lobby.ID != "public" {
+		t.Fatalf("GetLobbyConfigStorage returned %+v, want the new lobby", lobby)
+	}
+	lobby.MaximumPeers = 4
+	lobby.IsPublic = true
+	local.UpdateLobbyConfigStorage("ugi", "public", lobby)
+	if got := remote.GetLobbyConfigStorage("ugi", "public"); got == nil || got.MaximumPeers != 4 || !got.IsPublic {
+		t.Fatalf("GetLobbyConfigStorage on another server returned %+v, want the updated settings", got)
+	}
+
+	// Lobbies without an owner aren't listed
+	if got := remote.GetAllPublicLobbiesByUGI("ugi"); len(got) != 0 {
+		t.Fatalf("GetAllPublicLobbiesByUGI returned %v before the lobby had an owner", got)
+	}
+
+	joinTestLobby(local, host, "public", true)
+	local.ClaimLobbyOwnership("ugi", "public", host)
+	joinTestLobby(remote, peer, "public", false)
+
+	if local.CreateLobbyConfigStorage("ugi", "private") == nil {
+		t.Fatal("CreateLobbyConfigStorage failed to create a second lobby")
+	}
+	local.ClaimLobbyOwnership("ugi", "private", idle)
+
+	if got := remote.GetAllPublicLobbiesByUGI("ugi"); !slices.Equal(got, []string{"public"}) {
+		t.Fatalf("GetAllPublicLobbiesByUGI returned %v, want [public]", got)
+	}
+	got := remote.GetAllLobbiesByUGI("ugi")
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"private", "public"}) {
+		t.Fatalf("GetAllLobbiesByUGI returned %v, want [private public]", got)
+	}
+	if got := remote.GetAllPublicLobbiesByUGI("other"); len(got) != 0 {
+		t.Fatalf("GetAllPublicLobbiesByUGI returned %v for another UGI", got)
+	}
+
+	if hosts := remote.GetHostClientsByUGIAndLobby("ugi", "public"); len(hosts) != 1 || hosts[0].ULID != "host" {
+		t.Fatalf("GetHostClientsByUGIAndLobby returned %v, want only the host", hosts)
+	}
+	if peers := local.GetPeerClientsByUGIAndLobby("ugi", "public"); len(peers) != 1 || peers[0].ULID != "peer" {
+		t.Fatalf("GetPeerClientsByUGIAndLobby returned %v, want only the peer", peers)
+	}
+	if got := local.GetAllClientsWithoutLobby("ugi"); len(got) != 1 || got[0] != idle {
+		t.Fatalf("GetAllClientsWithoutLobby returned %v, want only the idle client", got)
+	}
+
+	local.DeleteLobbyConfigStorage("ugi", "public")
+	if remote.GetLobbyConfigStorage("ugi", "public") != nil {
+		t.Fatal("GetLobbyConfigStorage found a deleted lobby")
+	}
+	if got := remote.GetAllLobbiesByUGI("ugi"); !slices.Equal(got, []string{"private"}) {
+		t.Fatalf("GetAllLobbiesByUGI returned %v after a delete, want [private]", got)
+	}
+	if local.CreateLobbyConfigStorage("ugi", "public") == nil {
+		t.Fatal("CreateLobbyConfigStorage failed to create a lobby again after it was deleted")
+	}
+}
+
+func TestKeyDBLobbyOwnership(t *testing.T) {
+	dbs := newTestKeyDBs(t, 2)
+	local, remote := dbs[0], dbs[1]
+
+	first := addTestClient(local, "ugi", "first")
+	second := addTestClient(remote, "ugi", "second")
+	third := addTestClient(local, "ugi", "third")
+
+	// Lobbies that don't exist can't be claimed
+	if local.ClaimLobbyOwnership("ugi", "lobby", first) {
+		t.Fatal("ClaimLobbyOwnership claimed a lobby that doesn't exist")
+	}
+
+	local.CreateLobbyConfigStorage("ugi", "lobby")
+	if !local.ClaimLobbyOwnership("ugi", "lobby", first) {
+		t.Fatal("ClaimLobbyOwnership failed to claim a lobby without an owner")
+	}
+	if remote.ClaimLobbyOwnership("ugi", "lobby", second) {
+		t.Fatal("ClaimLobbyOwnership claimed a lobby that already has an owner")
+	}
+	if lobby := remote.GetLobbyConfigStorage("ugi", "lobby"); lobby.CurrentOwnerULID != "first" || lobby.CurrentOwnerID != first.ID {
+		t.Fatalf("Lobby is owned by %s (%d), want first (%d)", lobby.CurrentOwnerULID, lobby.CurrentOwnerID, first.ID)
+	}
+
+	// Only the owner can transfer the lobby
+	if remote.TransferLobbyOwnership("ugi", "lobby", second, third) {
+		t.Fatal("TransferLobbyOwnership transferred a lobby from a client that doesn't own it")
+	}
+	if !remote.TransferLobbyOwnership("ugi", "lobby", first, second) {
+		t.Fatal("TransferLobbyOwnership failed to transfer the lobby from its owner")
+	}
+	if lobby := local.GetLobbyConfigStorage("ugi", "lobby"); lobby.CurrentOwnerULID != "second" || lobby.CurrentOwnerUsername != second.Username {
+		t.Fatalf("Lobby is owned by %s (%s) after the transfer, want second", lobby.CurrentOwnerULID, lobby.CurrentOwnerUsername)
+	}
+	if local.TransferLobbyOwnership("ugi", "lobby", first, third) {
+		t.Fatal("TransferLobbyOwnership transferred a lobby from its previous owner")
+	}
+
+	// Released lobbies can be claimed again, once
+	local.ReleaseLobbyOwnership("ugi", "lobby")
+	if lobby := remote.GetLobbyConfigStorage("ugi", "lobby"); lobby.CurrentOwnerULID != "" {
+		t.Fatalf("Lobby is owned by %s after it was released", lobby.CurrentOwnerULID)
+	}
+	if !local.ClaimLobbyOwnership("ugi", "lobby", third) {
+		t.Fatal("ClaimLobbyOwnership failed to claim a released lobby")
+	}
+	if remote.ClaimLobbyOwnership("ugi", "lobby", second) {
+		t.Fatal("ClaimLobbyOwnership claimed a lobby that was claimed after it was released")
+	}
+}
+
+func TestKeyDBUpdateAfterDelete(t *testing.T) {
+	dbs, mr := newTestKeyDBServer(t, 2)
+	local, remote := dbs[0], dbs[1]
+
+	client := addTestClient(local, "ugi", "A")
+	joinTestLobby(local, client, "lobby", false)
+
+	// Another server deletes the client (i.e. kicking it) while this server still has it
+	remote.Delete(remote.GetClientByULID("A"))
+	client.IsHost = true
+	local.Update(client)
+
+	if mr.Exists(clientKey(client.ID)) {
+		t.Fatal("Update recreated a deleted client")
+	}
+	if got := remote.GetClientByULID("A"); got != nil {
+		t.Fatalf("GetClientByULID found a deleted client after an update: %+v", got)
+	}
+	if got := remote.GetHostClientsByUGIAndLobby("ugi", "lobby"); len(got) != 0 {
+		t.Fatalf("GetHostClientsByUGIAndLobby returned %v after the client was deleted", got)
+	}
+}
+
+func TestKeyDBExpiry(t *testing.T) {
+	dbs, mr := newTestKeyDBServer(t, 2)
+	crashed, alive := dbs[0], dbs[1]
+
+	// A host and a peer on a server that crashes, and a peer on a server that keeps running
+	host := addTestClient(crashed, "ugi", "host")
+	crashed.CreateLobbyConfigStorage("ugi", "lobby")
+	joinTestLobby(crashed, host, "lobby", true)
+	crashed.ClaimLobbyOwnership("ugi", "lobby", host)
+	addTestClient(crashed, "ugi", "idle")
+	peer := addTestClient(alive, "ugi", "peer")
+	joinTestLobby(alive, peer, "lobby", false)
+
+	// Only the running server refreshes its clients
+	for elapsed := time.Duration(0); elapsed <= ClientTTL; elapsed += ClientTTL / 3 {
+		alive.refresh()
+		mr.FastForward(ClientTTL / 3)
+	}
+
+	if got := alive.GetClientByULID("host"); got != nil {
+		t.Fatalf("GetClientByULID found a client of a crashed server: %+v", got)
+	}
+	if got := alive.GetAllClientsWithoutLobby("ugi"); len(got) != 0 {
+		t.Fatalf("GetAllClientsWithoutLobby returned %v, want no clients of the crashed server", got)
+	}
+	if got := alive.GetAllLobbiesByUGI("ugi"); len(got) != 0 {
+		t.Fatalf("GetAllLobbiesByUGI returned %v, want no lobbies hosted on the crashed server", got)
+	}
+	if peers := alive.GetPeerClientsByUGIAndLobby("ugi", "lobby"); len(peers) != 1 || peers[0] != peer {
+		t.Fatalf("GetPeerClientsByUGIAndLobby returned %v, want the refreshed peer", peers)
+	}
+
+	// Stale references are forgotten too
+	if members, _ := mr.SMembers(membersKey("ugi", "")); len(members) != 0 {
+		t.Fatalf("Clients without a lobby still lists %v", members)
+	}
+	if mr.HGet(ulidsKey(), "host") != "" {
+		t.Fatal("The ULID index still refers to an expired client")
+	}
+	if ok, _ := mr.SIsMember(lobbiesKey("ugi"), "lobby"); ok {
+		t.Fatal("The lobby list still refers to an expired lobby")
+	}
+}
@@ -0,0 +1,79 @@
+package clientmgr
+
+import (
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+)
+
+// Store is the interface implemented by every signaling client manager backend.
+//
+// Clients returned by a Store may be shared between goroutines. Callers are responsible for locking a client
+// while changing it, and must call Update (or UpdateLobbyConfigStorage for lobbies) afterwards so that
+// the change is persisted by backends that do not keep clients in memory.
+type Store interface {
+	// INSERT INTO clients (Game, Name) VALUES (?, ?)
+	Add(client *structs.Client) *structs.Client
+
+	// UPDATE clients SET ... WHERE ID = (client.ID)
+	Update(client *structs.Client)
+
+	// DELETE FROM clients WHERE ID = (client.ID)
+	Delete(client *structs.Client)
+
+	// SELECT client FROM clients WHERE ULID = (ulid)
+	GetClientByULID(query string) *structs.Client
+
+	// SetResumeToken makes a resume token refer to a client, so that the client can be found by any server.
+	SetResumeToken(token string, client *structs.Client)
+
+	// DeleteResumeToken removes a resume token.
+	DeleteResumeToken(token string)
+
+	// GetClientByResumeToken returns the client that a resume token refers to, or nil if the token does not exist.
+	GetClientByResumeToken(token string) *structs.Client
+
+	// Attach makes a client that was connected to another server local to this server, after resuming its session here.
+	Attach(client *structs.Client)
+
+	// Detach forgets a local client whose session was resumed on another server, without deleting it.
+	Detach(client *structs.Client)
+
+	// SELECT client FROM clients WHERE ULID = (ulid) AND UGI = (ugi) AND Lobby = (lobby)
+	GetClientBySpecificULIDinUGIAndLobby(ulid string, ugi string, lobby string) *structs.Client
+
+	// SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = (lobby) AND Peer = 1
+	GetPeerClientsByUGIAndLobby(ugi string, lobby string) []*structs.Client
+
+	// SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = (lobby) AND Host = 1 AND Peer = 0
+	GetHostClientsByUGIAndLobby(ugi string, lobby string) []*structs.Client
+
+	// SELECT client FROM clients WHERE UGI = (ugi) AND Lobby = ""
+	GetAllClientsWithoutLobby(ugi string) []*structs.Client
+
+	// GetAllPublicLobbiesByUGI returns all lobbies that are public for the given UGI.
+	GetAllPublicLobbiesByUGI(ugi string) []string
+
+	// GetAllLobbiesByUGI returns all lobbies for the given UGI, public or not.
+	GetAllLobbiesByUGI(ugi string) []string
+
+	// CreateLobbyConfigStorage atomically creates a new lobby config store for a specified UGI.
+	// Returns nil if the lobby already exists.
+	CreateLobbyConfigStorage(ugi string, lobbyname string) *structs.LobbyConfigStore
+
+	// GetLobbyConfigStorage returns the lobby config store for a lobby, or nil if it does not exist.
+	GetLobbyConfigStorage(ugi string, lobbyname string) *structs.LobbyConfigStore
+
+	// UpdateLobbyConfigStorage saves changes made to a lobby config store.
+	UpdateLobbyConfigStorage(ugi string, lobbyname string, lobby *structs.LobbyConfigStore)
+
+	// DeleteLobbyConfigStorage deletes the lobby config store for a lobby.
+	DeleteLobbyConfigStorage(ugi string, lobbyname string)
+
+	// ClaimLobbyOwnership atomically makes the client the owner of a lobby that has no owner.
+	ClaimLobbyOwnership(ugi string, lobbyname string, client *structs.Client) bool
+
+	// ReleaseLobbyOwnership removes the current owner of a lobby so that it can be claimed again.
+	ReleaseLobbyOwnership(ugi string, lobbyname string)
+
+	// TransferLobbyOwnership atomically moves the ownership of a lobby from one client to another.
+	TransferLobbyOwnership(ugi string, lobbyname string, from *structs.Client, to *structs.Client) bool
+}
@@ -0,0 +1,53 @@
+package signaling
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// IdleTimeout is how long a connection may go without sending anything (including pongs) before it is treated
+// as disconnected. The server pings every connection at half this interval. Set to 0 to disable.
+var IdleTimeout = 60 * time.Second
+
+// extendDeadline gives the client another IdleTimeout to send something.
+func extendDeadline(conn *websocket.Conn) error {
+	if IdleTimeout <= 0 {
+		return nil
+	}
+	return conn.SetReadDeadline(time.Now().Add(IdleTimeout))
+}
+
+// heartbeat pings a connection until stop is closed. Every pong from the client extends the read deadline.
+// If the connection stops responding, the pending read fails and the client goes through the normal disconnect path.
+func heartbeat(conn *websocket.Conn) (stop chan struct{}) {
+	stop = make(chan struct{})
+	if IdleTimeout <= 0 {
+		return stop
+	}
+
+	extendDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		return extendDeadline(conn)
+	})
+
+	go func() {
+		ticker := time.NewTicker(IdleTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// Close the connection if the ping can't be sent, so that the reader is woken up right away
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(IdleTimeout/2)); err != nil {
+					log.Printf("[Signaling] Failed to ping %s, closing connection: %s", conn.RemoteAddr(), err)
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+	return stop
+}
@@ -0,0 +1,258 @@
+package signaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/oklog/ulid/v2"
+
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+)
+
+// testLobbyClient is a client in a test lobby, and the browser end of its connection.
+type testLobbyClient struct {
+	*structs.Client
+	browser *websocket.Conn
+}
+
+// newTestLobby creates a lobby with a host and the given number of peers, all connected to this server.
+func newTestLobby(t *testing.T, reclaim bool, peersReclaim bool, peers int) (*structs.LobbyConfigStore, *testLobbyClient, []*testLobbyClient) {
+	useTestRelay(t)
+
+	server, browser := newTestConn(t)
+	host := &testLobbyClient{addTestClient(server, "lobby", true), browser}
+	lobby := Manager.CreateLobbyConfigStorage("ugi", "lobby")
+	if !Manager.ClaimLobbyOwnership("ugi", "lobby", host.Client) {
+		t.Fatal("Host failed to claim the test lobby")
+	}
+	lobby.AllowHostReclaim = reclaim
+	lobby.AllowPeersToReclaim = peersReclaim
+	Manager.UpdateLobbyConfigStorage("ugi", "lobby", lobby)
+
+	var members []*testLobbyClient
+	for i := 0; i < peers; i++ {
+		server, browser := newTestConn(t)
+		members = append(members, &testLobbyClient{addTestClient(server, "lobby", false), browser})
+	}
+	return lobby, host, members
+}
+
+// expectPacket reads the next packet sent to a browser, and checks its opcode.
+func expectPacket(t *testing.T, client *testLobbyClient, opcode string) *structs.SignalPacket {
+	t.Helper()
+	packet := readPacket(t, client.browser)
+	if packet.Opcode != opcode {
+		t.Fatalf("Client %d received %+v, want %s", client.ID, packet, opcode)
+	}
+	return packet
+}
+
+// expectNewHost reads a HOST_RECLAIM packet sent to a browser, and checks who the new host is.
+func expectNewHost(t *testing.T, client *testLobbyClient, host *testLobbyClient) {
+	t.Helper()
+	packet := expectPacket(t, client, "HOST_RECLAIM")
+	if payload, ok := packet.Payload.(map[string]any); !ok || payload["id"] != host.ULID {
+		t.Fatalf("Client %d was told the new host is %v, want %s", client.ID, packet.Payload, host.ULID)
+	}
+}
+
+func TestLockOpcode(t *testing.T) {
+	lobby, host, peers := newTestLobby(t, false, false, 1)
+
+	// Peers can't lock the lobby
+	HandleLockOpcode(peers[0].Client, &structs.SignalPacket{Opcode: "LOCK"}, true)
+	expectPacket(t, peers[0], "NOT_HOST")
+	if lobby.Locked {
+		t.Fatal("A peer locked the lobby")
+	}
+
+	HandleLockOpcode(host.Client, &structs.SignalPacket{Opcode: "LOCK", Listener: "lock"}, true)
+	if packet := expectPacket(t, host, "ACK_LOCK"); packet.Listener != "lock" {
+		t.Fatalf("ACK_LOCK has listener %q, want lock", packet.Listener)
+	}
+	if !lobby.Locked {
+		t.Fatal("Lobby is not locked after LOCK")
+	}
+
+	HandleLockOpcode(host.Client, &structs.SignalPacket{Opcode: "UNLOCK"}, false)
+	expectPacket(t, host, "ACK_UNLOCK")
+	if lobby.Locked {
+		t.Fatal("Lobby is still locked after UNLOCK")
+	}
+}
+
+func TestSizeOpcode(t *testing.T) {
+	lobby, host, peers := newTestLobby(t, false, false, 2)
+	lobby.MaximumPeers = 5
+
+	for _, tc := range []struct {
+		name   string
+		client *testLobbyClient
+		packet string
+		want   string
+		size   int
+	}{
+		{"peer", peers[0], `{"opcode":"SIZE","payload":{"max_peers":3}}`, "NOT_HOST", 5},
+		{"missing payload", host, `{"opcode":"SIZE"}`, "WARNING", 5},
+		{"missing max_peers", host, `{"opcode":"SIZE","payload":{"force":true}}`, "WARNING", 5},
+		{"too large", host, `{"opcode":"SIZE","payload":{"max_peers":101}}`, "WARNING", 5},
+		{"smaller than lobby", host, `{"opcode":"SIZE","payload":{"max_peers":1}}`, "SIZE_TOO_SMALL", 5},
+		{"forced", host, `{"opcode":"SIZE","payload":{"max_peers":1,"force":true}}`, "ACK_SIZE", 1},
+		{"unlimited", host, `{"opcode":"SIZE","payload":{"max_peers":0}}`, "ACK_SIZE", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			HandleSizeOpcode(tc.client.Client, &structs.SignalPacket{Opcode: "SIZE"}, []byte(tc.packet))
+			expectPacket(t, tc.client, tc.want)
+			if lobby.MaximumPeers != tc.size {
+				t.Fatalf("Lobby has %d maximum peers, want %d", lobby.MaximumPeers, tc.size)
+			}
+		})
+	}
+}
+
+func TestKickOpcode(t *testing.T) {
+	_, host, peers := newTestLobby(t, false, false, 2)
+	kicked, other := peers[0], peers[1]
+
+	// Peers can't kick each other
+	HandleKickOpcode(other.Client, &structs.SignalPacket{Opcode: "KICK", Recipient: kicked.ULID})
+	expectPacket(t, other, "NOT_HOST")
+
+	HandleKickOpcode(host.Client, &structs.SignalPacket{Opcode: "KICK", Recipient: "not a ulid"})
+	expectPacket(t, host, "WARNING")
+
+	// Only peers of the host's lobby can be kicked
+	HandleKickOpcode(host.Client, &structs.SignalPacket{Opcode: "KICK", Recipient: ulid.Make().String()})
+	expectPacket(t, host, "PEER_INVALID")
+	stranger := &testLobbyClient{addTestClient(nil, "other", false), nil}
+	HandleKickOpcode(host.Client, &structs.SignalPacket{Opcode: "KICK", Recipient: stranger.ULID})
+	expectPacket(t, host, "PEER_INVALID")
+
+	HandleKickOpcode(host.Client, &structs.SignalPacket{Opcode: "KICK", Recipient: kicked.ULID})
+	if packet := expectPacket(t, kicked, "KICKED"); packet.Payload != "lobby" {
+		t.Fatalf("KICKED names lobby %v, want lobby", packet.Payload)
+	}
+	if packet := expectPacket(t, other, "PEER_GONE"); packet.Payload != kicked.ULID {
+		t.Fatalf("PEER_GONE names %v, want %s", packet.Payload, kicked.ULID)
+	}
+	if packet := expectPacket(t, host, "ACK_KICK"); packet.Payload != kicked.ULID {
+		t.Fatalf("ACK_KICK names %v, want %s", packet.Payload, kicked.ULID)
+	}
+	if kicked.IsPeer || kicked.Lobby != "" {
+		t.Fatal("Kicked peer is still in the lobby")
+	}
+	if len(Manager.GetPeerClientsByUGIAndLobby("ugi", "lobby")) != 1 {
+		t.Fatal("Lobby should have one peer left")
+	}
+}
+
+func TestTransferHostOpcode(t *testing.T) {
+	lobby, host, peers := newTestLobby(t, false, false, 2)
+	newHost, other := peers[0], peers[1]
+
+	HandleTransferHostOpcode(other.Client, &structs.SignalPacket{Opcode: "TRANSFER_HOST", Recipient: newHost.ULID})
+	expectPacket(t, other, "NOT_HOST")
+
+	// The host isn't a peer of its own lobby
+	HandleTransferHostOpcode(host.Client, &structs.SignalPacket{Opcode: "TRANSFER_HOST", Recipient: host.ULID})
+	expectPacket(t, host, "PEER_INVALID")
+
+	HandleTransferHostOpcode(host.Client, &structs.SignalPacket{Opcode: "TRANSFER_HOST", Recipient: newHost.ULID})
+	expectNewHost(t, newHost, newHost)
+	expectNewHost(t, other, newHost)
+	expectPacket(t, host, "TRANSFER_OK")
+
+	if !newHost.IsHost || newHost.IsPeer || host.IsHost || !host.IsPeer {
+		t.Fatal("Host and peer did not swap roles")
+	}
+	if lobby.CurrentOwnerULID != newHost.ULID {
+		t.Fatalf("Lobby is owned by %s, want %s", lobby.CurrentOwnerULID, newHost.ULID)
+	}
+
+	// The old host can no longer transfer the lobby
+	HandleTransferHostOpcode(host.Client, &structs.SignalPacket{Opcode: "TRANSFER_HOST", Recipient: other.ULID})
+	expectPacket(t, host, "NOT_HOST")
+}
+
+func TestClaimHostOpcode(t *testing.T) {
+	lobby, host, peers := newTestLobby(t, false, false, 2)
+	claimer, other := peers[0], peers[1]
+
+	HandleClaimHostOpcode(host.Client, &structs.SignalPacket{Opcode: "CLAIM_HOST"})
+	expectPacket(t, host, "ALREADY_HOST")
+
+	server, browser := newTestConn(t)
+	outsider := &testLobbyClient{addTestClient(server, "", false), browser}
+	outsider.IsPeer = false
+	HandleClaimHostOpcode(outsider.Client, &structs.SignalPacket{Opcode: "CLAIM_HOST"})
+	expectPacket(t, outsider, "NOT_PEER")
+
+	// Lobbies must let peers reclaim them
+	HandleClaimHostOpcode(claimer.Client, &structs.SignalPacket{Opcode: "CLAIM_HOST"})
+	expectPacket(t, claimer, "RECLAIM_DISABLED")
+
+	// Peers can't take over a lobby that still has a host
+	lobby.AllowHostReclaim = true
+	lobby.AllowPeersToReclaim = true
+	HandleClaimHostOpcode(claimer.Client, &structs.SignalPacket{Opcode: "CLAIM_HOST"})
+	expectPacket(t, claimer, "HOST_EXISTS")
+
+	// Once the host leaves, the first peer to claim the lobby wins
+	CloseHandler(host.Client)
+	expectPacket(t, claimer, "HOST_GONE")
+	expectPacket(t, other, "HOST_GONE")
+
+	HandleClaimHostOpcode(claimer.Client, &structs.SignalPacket{Opcode: "CLAIM_HOST", Listener: "claim"})
+	expectNewHost(t, other, claimer)
+	if packet := expectPacket(t, claimer, "ACK_HOST"); packet.Listener != "claim" {
+		t.Fatalf("ACK_HOST has listener %q, want claim", packet.Listener)
+	}
+	HandleClaimHostOpcode(other.Client, &structs.SignalPacket{Opcode: "CLAIM_HOST"})
+	expectPacket(t, other, "HOST_EXISTS")
+
+	if !claimer.IsHost || claimer.IsPeer || lobby.CurrentOwnerULID != claimer.ULID {
+		t.Fatal("Claiming peer did not become the host")
+	}
+
+	// The lobby no longer waits to be closed
+	reclaimTimersLock.Lock()
+	_, waiting := reclaimTimers[[2]string{"ugi", "lobby"}]
+	reclaimTimersLock.Unlock()
+	if waiting {
+		t.Fatal("Claimed lobby is still waiting to be closed")
+	}
+}
+
+func TestUnclaimedLobbyCloses(t *testing.T) {
+	timeout := HostReclaimTimeout
+	HostReclaimTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { HostReclaimTimeout = timeout })
+
+	_, host, peers := newTestLobby(t, true, true, 1)
+	CloseHandler(host.Client)
+	expectPacket(t, peers[0], "HOST_GONE")
+
+	if packet := expectPacket(t, peers[0], "LOBBY_CLOSE"); packet.Payload != "lobby" {
+		t.Fatalf("LOBBY_CLOSE names lobby %v, want lobby", packet.Payload)
+	}
+	eventually(t, "the lobby to be deleted", func() bool {
+		return Manager.GetLobbyConfigStorage("ugi", "lobby") == nil
+	})
+}
+
+func TestServerHostReclaim(t *testing.T) {
+	lobby, host, peers := newTestLobby(t, true, false, 2)
+
+	// The longest-connected peer becomes the host
+	CloseHandler(host.Client)
+	for _, peer := range peers {
+		expectPacket(t, peer, "HOST_GONE")
+	}
+	for _, peer := range peers {
+		expectNewHost(t, peer, peers[0])
+	}
+	if !peers[0].IsHost || lobby.CurrentOwnerULID != peers[0].ULID {
+		t.Fatal("Longest-connected peer did not become the host")
+	}
+}
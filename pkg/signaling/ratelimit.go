@@ -0,0 +1,61 @@
+package signaling
+
+import (
+	"github.com/cloudlink-omega/backend/pkg/ratelimit"
+)
+
+// ClientRateLimit limits how many messages each client can send, regardless of opcode. Set PerSecond to 0 to disable.
+var ClientRateLimit = ratelimit.Rate{PerSecond: 30, Burst: 90}
+
+// OpcodeRateLimits limits how often each client can send specific opcodes.
+// Opcodes that are not listed are only limited by ClientRateLimit.
+var OpcodeRateLimits = map[string]ratelimit.Rate{
+	"INIT":        {PerSecond: 0.2, Burst: 3},
+	"RESUME":      {PerSecond: 0.2, Burst: 3},
+	"CONFIG_HOST": {PerSecond: 0.5, Burst: 3},
+	"CONFIG_PEER": {PerSecond: 0.5, Burst: 3},
+	"LOBBY_LIST":  {PerSecond: 1, Burst: 5},
+	"LOBBY_INFO":  {PerSecond: 2, Burst: 10},
+	"MAKE_OFFER":  {PerSecond: 5, Burst: 20},
+	"MAKE_ANSWER": {PerSecond: 5, Burst: 20},
+	"ICE":         {PerSecond: 20, Burst: 100},
+}
+
+// RateLimitStrikes limits how many RATE_LIMITED replies a client can receive before it is disconnected with VIOLATION.
+var RateLimitStrikes = ratelimit.Rate{PerSecond: 0.1, Burst: 5}
+
+// UpgradeLimiter limits how often each remote IP address can open a signaling connection. Nil disables the limit.
+var UpgradeLimiter *ratelimit.Limiter
+
+// Rate limits of a single connection.
+type connectionLimits struct {
+	messages *ratelimit.Bucket
+	opcodes  map[string]*ratelimit.Bucket
+	strikes  *ratelimit.Bucket
+}
+
+func newConnectionLimits() *connectionLimits {
+	return &connectionLimits{
+		messages: ratelimit.NewBucket(ClientRateLimit),
+		opcodes:  make(map[string]*ratelimit.Bucket),
+		strikes:  ratelimit.NewBucket(RateLimitStrikes),
+	}
+}
+
+// allow returns true if the connection may send a message with the given opcode.
+func (l *connectionLimits) allow(opcode string) bool {
+	if ClientRateLimit.PerSecond > 0 && !l.messages.Allow() {
+		return false
+	}
+
+	rate, ok := OpcodeRateLimits[opcode]
+	if !ok {
+		return true
+	}
+	bucket, ok := l.opcodes[opcode]
+	if !ok {
+		bucket = ratelimit.NewBucket(rate)
+		l.opcodes[opcode] = bucket
+	}
+	return bucket.Allow()
+}
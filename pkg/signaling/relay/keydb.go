@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"context"
+	"log"
+
+	json "github.com/goccy/go-json"
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyDBBus is a relay transport that uses KeyDB (or Redis) pub/sub. Each node listens on its own channel.
+type KeyDBBus struct {
+	rdb redis.UniversalClient
+	ctx context.Context
+}
+
+// NewKeyDBBus creates a new relay transport using an existing Redis client.
+func NewKeyDBBus(rdb redis.UniversalClient) *KeyDBBus {
+	return &KeyDBBus{
+		rdb: rdb,
+		ctx: context.Background(),
+	}
+}
+
+func channel(node string) string {
+	return "clomega:relay:" + node
+}
+
+// Publish sends a message to the specified node.
+func (b *KeyDBBus) Publish(node string, msg *Message) error {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// Check if anyone received the message
+	receivers, err := b.rdb.Publish(b.ctx, channel(node), raw).Result()
+	if err != nil {
+		return err
+	}
+	if receivers == 0 {
+		log.Printf("[Relay] Dropping message for %s: node %s not found", msg.Recipient, node)
+		return ErrNodeNotFound
+	}
+	return nil
+}
+
+// Subscribe calls the handler for every message sent to the specified node.
+func (b *KeyDBBus) Subscribe(node string, handler func(*Message)) error {
+	pubsub := b.rdb.Subscribe(b.ctx, channel(node))
+
+	// Wait for the subscription to be confirmed
+	if _, err := pubsub.Receive(b.ctx); err != nil {
+		return err
+	}
+
+	log.Printf("[Relay] Node %s is listening for relayed messages", node)
+	go func() {
+		for raw := range pubsub.Channel() {
+			msg := &Message{}
+			if err := json.Unmarshal([]byte(raw.Payload), msg); err != nil {
+				log.Printf("[Relay] Error reading relayed message: %s", err)
+				continue
+			}
+			handler(msg)
+		}
+	}()
+	return nil
+}
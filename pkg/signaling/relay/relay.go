@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	json "github.com/goccy/go-json"
+)
+
+// The relay delivers signaling packets to clients that are connected to a different signaling server (node).
+// Each node is identified by its server nickname, and listens for messages addressed to its own clients.
+
+var ErrNodeNotFound = errors.New("relay node not found")
+
+// Message is a signaling packet addressed to a client on another node.
+type Message struct {
+	Origin    string          `json:"origin"`             // Nickname of the node that sent the message
+	Recipient string          `json:"recipient"`          // ULID of the client that should receive the message
+	Packet    json.RawMessage `json:"packet"`             // JSON-encoded signaling packet
+	Close     bool            `json:"close,omitempty"`    // Disconnect the recipient after delivering the packet
+	Sessions  []string        `json:"sessions,omitempty"` // Only deliver the packet if the recipient uses one of these session tokens
+	Request   string          `json:"request,omitempty"`  // ID of a request that expects a reply, or of the request this message replies to
+	Reply     bool            `json:"reply,omitempty"`    // Set if this message is a reply to a request
+	OK        bool            `json:"ok,omitempty"`       // Set in a reply if the request succeeded
+	Evict     bool            `json:"evict,omitempty"`    // Delete the recipient if it is parked, waiting to resume its session
+	Handoff   string          `json:"handoff,omitempty"`  // Hand the recipient over to the origin, if this is its resume token
+
+	// Set in the reply to a handoff
+	Authorization string            `json:"authorization,omitempty"` // Session token of the recipient
+	Queue         []json.RawMessage `json:"queue,omitempty"`         // Messages queued while the recipient was parked
+}
+
+// Bus is the interface implemented by every relay transport.
+type Bus interface {
+	// Publish sends a message to the specified node.
+	Publish(node string, msg *Message) error
+
+	// Subscribe calls the handler for every message sent to the specified node.
+	Subscribe(node string, handler func(*Message)) error
+}
+
+// MemoryBus is an in-process relay transport. Useful for standalone servers and testing.
+type MemoryBus struct {
+	handlers map[string]func(*Message)
+	lock     sync.RWMutex
+}
+
+// NewMemoryBus creates a new in-process relay transport.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		handlers: make(map[string]func(*Message)),
+	}
+}
+
+// Publish sends a message to the specified node.
+func (b *MemoryBus) Publish(node string, msg *Message) error {
+	b.lock.RLock()
+	handler, ok := b.handlers[node]
+	b.lock.RUnlock()
+	if !ok {
+		log.Printf("[Relay] Dropping message for %s: node %s not found", msg.Recipient, node)
+		return ErrNodeNotFound
+	}
+
+	// Deliver asynchronously, as a network transport would
+	go handler(msg)
+	return nil
+}
+
+// Subscribe calls the handler for every message sent to the specified node.
+func (b *MemoryBus) Subscribe(node string, handler func(*Message)) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	log.Printf("[Relay] Node %s is listening for relayed messages", node)
+	b.handlers[node] = handler
+	return nil
+}
@@ -0,0 +1,302 @@
+package signaling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/oklog/ulid/v2"
+
+	clientmgr "github.com/cloudlink-omega/backend/pkg/signaling/clientmgr"
+	relay "github.com/cloudlink-omega/backend/pkg/signaling/relay"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	json "github.com/goccy/go-json"
+)
+
+// useTestRelay makes this server node "A" on a new in-process relay, with a fresh client manager.
+// Node "B" is played by the test: every message relayed to it is sent to the returned channel.
+func useTestRelay(t *testing.T) (*relay.MemoryBus, chan *relay.Message) {
+	Manager = clientmgr.New()
+	bus := relay.NewMemoryBus()
+	if err := UseRelay("A", bus); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Manager = clientmgr.New()
+		Relay = nil
+		Node = ""
+	})
+
+	remote := make(chan *relay.Message, 16)
+	bus.Subscribe("B", func(msg *relay.Message) {
+		remote <- msg
+	})
+	return bus, remote
+}
+
+// newTestConn opens a websocket connection to a test server. Returns the server's end of the connection,
+// which is given to a client, and the browser's end, which the test reads from.
+func newTestConn(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	upgrader := websocket.Upgrader{}
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	browser, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { browser.Close() })
+
+	server := <-accepted
+	t.Cleanup(func() { server.Close() })
+	return server, browser
+}
+
+// addTestClient adds a logged in client to a lobby. Clients without a connection are connected to node "B".
+func addTestClient(conn *websocket.Conn, lobby string, host bool) *structs.Client {
+	node := "A"
+	if conn == nil {
+		node = "B"
+	}
+	id := ulid.Make().String()
+	return Manager.Add(&structs.Client{
+		Conn:          conn,
+		UGI:           "ugi",
+		ULID:          id,
+		Username:      "user-" + id,
+		Authorization: "session-" + id,
+		ValidSession:  true,
+		Lobby:         lobby,
+		IsHost:        host,
+		IsPeer:        !host,
+		Node:          node,
+	})
+}
+
+// readPacket reads the next signaling packet sent to a browser.
+func readPacket(t *testing.T, browser *websocket.Conn) *structs.SignalPacket {
+	t.Helper()
+	browser.SetReadDeadline(time.Now().Add(2 * time.Second))
+	packet := &structs.SignalPacket{}
+	if err := browser.ReadJSON(packet); err != nil {
+		t.Fatalf("Failed to read a packet: %s", err)
+	}
+	return packet
+}
+
+// readRelayed waits for a message relayed to node "B", and decodes its packet.
+func readRelayed(t *testing.T, remote chan *relay.Message) (*relay.Message, *structs.SignalPacket) {
+	t.Helper()
+	select {
+	case msg := <-remote:
+		packet := &structs.SignalPacket{}
+		if err := json.Unmarshal(msg.Packet, packet); err != nil {
+			t.Fatalf("Failed to decode relayed packet: %s", err)
+		}
+		return msg, packet
+	case <-time.After(2 * time.Second):
+		t.Fatal("No message was relayed to node B")
+		return nil, nil
+	}
+}
+
+// eventually waits for a condition to become true.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+func TestRelayOfferAndICE(t *testing.T) {
+	bus, remote := useTestRelay(t)
+
+	server, browser := newTestConn(t)
+	host := addTestClient(server, "lobby", true)
+	peer := addTestClient(nil, "lobby", false)
+
+	// The host's offer is relayed to the peer's server
+	HandleMakeOfferOpcode(host, &structs.SignalPacket{Opcode: "MAKE_OFFER", Recipient: peer.ULID, Payload: "offer", Listener: "offer"})
+	msg, packet := readRelayed(t, remote)
+	if msg.Origin != "A" || msg.Recipient != peer.ULID {
+		t.Fatalf("Offer was relayed from %s to %s, want from A to %s", msg.Origin, msg.Recipient, peer.ULID)
+	}
+	if packet.Opcode != "MAKE_OFFER" || packet.Payload != "offer" || packet.Origin == nil || packet.Origin.ID != host.ULID {
+		t.Fatalf("Relayed packet is %+v, want the host's offer", packet)
+	}
+	if reply := readPacket(t, browser); reply.Opcode != "RELAY_OK" || reply.Listener != "offer" {
+		t.Fatalf("Host received %+v, want RELAY_OK", reply)
+	}
+
+	// ICE candidates are relayed the same way
+	HandleICEOpcode(host, &structs.SignalPacket{Opcode: "ICE", Recipient: peer.ULID, Payload: "candidate"})
+	if _, packet := readRelayed(t, remote); packet.Opcode != "ICE" || packet.Payload != "candidate" || packet.Origin.ID != host.ULID {
+		t.Fatalf("Relayed packet is %+v, want the host's ICE candidate", packet)
+	}
+	if reply := readPacket(t, browser); reply.Opcode != "RELAY_OK" {
+		t.Fatalf("Host received %+v, want RELAY_OK", reply)
+	}
+
+	// Node B relays the peer's candidates back to the host
+	raw, _ := json.Marshal(&structs.SignalPacket{
+		Opcode:  "ICE",
+		Payload: "reply",
+		Origin:  &structs.PeerInfo{ID: peer.ULID, User: peer.Username},
+	})
+	if err := bus.Publish("A", &relay.Message{Origin: "B", Recipient: host.ULID, Packet: raw}); err != nil {
+		t.Fatal(err)
+	}
+	if packet := readPacket(t, browser); packet.Opcode != "ICE" || packet.Payload != "reply" || packet.Origin.ID != peer.ULID {
+		t.Fatalf("Host received %+v, want the peer's ICE candidate", packet)
+	}
+
+	// Messages for servers that aren't listening are dropped
+	if err := bus.Publish("C", &relay.Message{Origin: "A", Recipient: peer.ULID, Packet: raw}); err != relay.ErrNodeNotFound {
+		t.Fatalf("Publishing to an unknown node returned %v, want ErrNodeNotFound", err)
+	}
+}
+
+func TestRelayClose(t *testing.T) {
+	bus, _ := useTestRelay(t)
+
+	server, browser := newTestConn(t)
+	client := addTestClient(server, "", false)
+	raw, _ := json.Marshal(&structs.SignalPacket{Opcode: "SESSION_REVOKED", Payload: "revoked"})
+
+	// Clients using a different session are left alone
+	if err := bus.Publish("A", &relay.Message{Origin: "B", Recipient: client.ULID, Packet: raw, Close: true, Sessions: []string{"other"}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	client.Lock.RLock()
+	valid := client.ValidSession
+	client.Lock.RUnlock()
+	if !valid {
+		t.Fatal("Client was disconnected for a session it doesn't use")
+	}
+
+	// Clients using a listed session receive the packet, and are disconnected
+	if err := bus.Publish("A", &relay.Message{Origin: "B", Recipient: client.ULID, Packet: raw, Close: true, Sessions: []string{"other", client.Authorization}}); err != nil {
+		t.Fatal(err)
+	}
+	if packet := readPacket(t, browser); packet.Opcode != "SESSION_REVOKED" {
+		t.Fatalf("Client received %+v, want SESSION_REVOKED", packet)
+	}
+	if _, _, err := browser.ReadMessage(); err == nil {
+		t.Fatal("Connection is still open after the client was disconnected")
+	}
+	client.Lock.RLock()
+	valid = client.ValidSession
+	client.Lock.RUnlock()
+	if valid {
+		t.Fatal("Client session is still valid after the client was disconnected")
+	}
+
+	// Parked clients have no connection to close, and are deleted right away
+	parked := addTestClient(nil, "", false)
+	parked.Node = "A"
+	parked.Parked = true
+	if err := bus.Publish("A", &relay.Message{Origin: "B", Recipient: parked.ULID, Packet: raw, Close: true}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the parked client to be deleted", func() bool {
+		return Manager.GetClientByULID(parked.ULID) == nil
+	})
+}
+
+// requestTestNode sends a request to this server as node "B", and waits for the reply.
+func requestTestNode(t *testing.T, bus *relay.MemoryBus, remote chan *relay.Message, msg *relay.Message) *relay.Message {
+	t.Helper()
+	msg.Origin = "B"
+	msg.Request = ulid.Make().String()
+	if err := bus.Publish("A", msg); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case reply := <-remote:
+		if !reply.Reply || reply.Request != msg.Request {
+			t.Fatalf("Received %+v, want a reply to request %s", reply, msg.Request)
+		}
+		return reply
+	case <-time.After(2 * time.Second):
+		t.Fatal("Node A did not reply")
+		return nil
+	}
+}
+
+func TestRelayEvict(t *testing.T) {
+	bus, remote := useTestRelay(t)
+
+	// Connected clients can't be evicted
+	server, _ := newTestConn(t)
+	client := addTestClient(server, "", false)
+	if reply := requestTestNode(t, bus, remote, &relay.Message{Recipient: client.ULID, Evict: true}); reply.OK {
+		t.Fatal("A connected client was evicted")
+	}
+	if Manager.GetClientByULID(client.ULID) == nil {
+		t.Fatal("A connected client was deleted")
+	}
+
+	// Parked clients are deleted before the reply is sent
+	parked := addTestClient(nil, "", false)
+	parked.Node = "A"
+	parked.Parked = true
+	if reply := requestTestNode(t, bus, remote, &relay.Message{Recipient: parked.ULID, Evict: true}); !reply.OK {
+		t.Fatal("A parked client was not evicted")
+	}
+	if Manager.GetClientByULID(parked.ULID) != nil {
+		t.Fatal("An evicted client was not deleted")
+	}
+}
+
+func TestRelayHandoff(t *testing.T) {
+	bus, remote := useTestRelay(t)
+
+	parked := addTestClient(nil, "lobby", false)
+	parked.Node = "A"
+	parked.Parked = true
+	parked.Queue = []any{&structs.SignalPacket{Opcode: "NEW_PEER", Payload: "queued"}}
+	token := issueResumeToken(parked)
+
+	// Only the client's current resume token can be used
+	if reply := requestTestNode(t, bus, remote, &relay.Message{Recipient: parked.ULID, Handoff: ulid.Make().String()}); reply.OK {
+		t.Fatal("Client was handed off with the wrong resume token")
+	}
+
+	reply := requestTestNode(t, bus, remote, &relay.Message{Recipient: parked.ULID, Handoff: token})
+	if !reply.OK || reply.Authorization != parked.Authorization {
+		t.Fatalf("Handoff reply is %+v, want the client's session", reply)
+	}
+	if len(reply.Queue) != 1 {
+		t.Fatalf("Handoff reply has %d queued messages, want 1", len(reply.Queue))
+	}
+	packet := &structs.SignalPacket{}
+	if err := json.Unmarshal(reply.Queue[0], packet); err != nil || packet.Opcode != "NEW_PEER" {
+		t.Fatalf("Queued message is %s, want NEW_PEER", reply.Queue[0])
+	}
+
+	// The client is no longer parked here, and its resume token has been used up
+	parked.Lock.RLock()
+	stillParked := parked.Parked
+	parked.Lock.RUnlock()
+	if stillParked {
+		t.Fatal("Client is still parked after it was handed off")
+	}
+	if Manager.GetClientByResumeToken(token) != nil {
+		t.Fatal("Resume token can still be used after the client was handed off")
+	}
+}
@@ -0,0 +1,73 @@
+package signaling
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	relay "github.com/cloudlink-omega/backend/pkg/signaling/relay"
+	"github.com/oklog/ulid/v2"
+)
+
+// RequestTimeout is how long to wait for another server to reply to a request.
+var RequestTimeout = 5 * time.Second
+
+// Requests sent to other servers that are waiting for a reply, keyed by request ID.
+var pendingRequests = make(map[string]chan *relay.Message)
+var pendingLock sync.Mutex
+
+// requestNode sends a message to another server and waits for its reply.
+// Returns nil if the server could not be reached, or did not reply in time.
+func requestNode(node string, msg *relay.Message) *relay.Message {
+	msg.Origin = Node
+	msg.Request = ulid.Make().String()
+
+	reply := make(chan *relay.Message, 1)
+	pendingLock.Lock()
+	pendingRequests[msg.Request] = reply
+	pendingLock.Unlock()
+	defer func() {
+		pendingLock.Lock()
+		delete(pendingRequests, msg.Request)
+		pendingLock.Unlock()
+	}()
+
+	if err := Relay.Publish(node, msg); err != nil {
+		log.Printf("[Signaling] Error sending request to server \"%s\": %s", node, err)
+		return nil
+	}
+
+	select {
+	case res := <-reply:
+		return res
+	case <-time.After(RequestTimeout):
+		log.Printf("[Signaling] Server \"%s\" did not reply to request %s in time", node, msg.Request)
+		return nil
+	}
+}
+
+// replyToNode answers a request sent by another server.
+func replyToNode(req *relay.Message, reply *relay.Message) {
+	reply.Origin = Node
+	reply.Recipient = req.Recipient
+	reply.Request = req.Request
+	reply.Reply = true
+	if err := Relay.Publish(req.Origin, reply); err != nil {
+		log.Printf("[Signaling] Error replying to request %s from server \"%s\": %s", req.Request, req.Origin, err)
+	}
+}
+
+// deliverReply passes a reply to the request that is waiting for it. Replies that arrive too late are dropped.
+func deliverReply(msg *relay.Message) {
+	pendingLock.Lock()
+	reply, ok := pendingRequests[msg.Request]
+	pendingLock.Unlock()
+	if !ok {
+		log.Printf("[Signaling] Dropping late reply to request %s from server \"%s\"", msg.Request, msg.Origin)
+		return
+	}
+	select {
+	case reply <- msg:
+	default:
+	}
+}
@@ -0,0 +1,289 @@
+package signaling
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	dm "github.com/cloudlink-omega/backend/pkg/data"
+	relay "github.com/cloudlink-omega/backend/pkg/signaling/relay"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	utils "github.com/cloudlink-omega/backend/pkg/utils"
+	json "github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/oklog/ulid/v2"
+)
+
+// ResumeGracePeriod is how long a client is kept after its connection drops, waiting for RESUME.
+// Set to 0 to delete clients as soon as their connection drops.
+var ResumeGracePeriod = 30 * time.Second
+
+// MaxQueuedMessages limits how many messages are kept for a parked client.
+const MaxQueuedMessages = 256
+
+// Protects the resume tokens of clients. Resume tokens are kept in the client manager, so that a session can be
+// resumed on any server.
+var resumeLock sync.Mutex
+
+// issueResumeToken creates a new resume token for a client, replacing the previous one.
+func issueResumeToken(c *structs.Client) string {
+	resumeLock.Lock()
+	defer resumeLock.Unlock()
+	if c.ResumeToken != "" {
+		Manager.DeleteResumeToken(c.ResumeToken)
+	}
+	c.ResumeToken = ulid.Make().String()
+	Manager.SetResumeToken(c.ResumeToken, c)
+	return c.ResumeToken
+}
+
+// revokeResumeToken removes the resume token of a client.
+func revokeResumeToken(c *structs.Client) {
+	resumeLock.Lock()
+	defer resumeLock.Unlock()
+	if c.ResumeToken != "" {
+		Manager.DeleteResumeToken(c.ResumeToken)
+		c.ResumeToken = ""
+	}
+}
+
+// queueMessage stores a message for a parked client. The caller must hold the client's lock.
+func queueMessage(c *structs.Client, packet any) {
+	if len(c.Queue) >= MaxQueuedMessages {
+		log.Printf("[Signaling] WARNING: Message queue for parked client %d is full, dropping message.", c.ID)
+		return
+	}
+	c.Queue = append(c.Queue, packet)
+}
+
+// ParkClient is called when reading from a client's connection fails. If the connection dropped unexpectedly,
+// the client keeps its lobby membership and role for ResumeGracePeriod, and messages sent to it are queued.
+// Returns true if the client was parked or has already been resumed on another connection, in which case
+// the client must not be deleted.
+func ParkClient(c *structs.Client, conn *websocket.Conn, err error) bool {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+
+	// Another connection has resumed this session
+	if c.Conn != conn {
+		return true
+	}
+
+	// Don't park clients that haven't logged in, or that closed the connection on purpose
+	if !c.ValidSession || ResumeGracePeriod <= 0 || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return false
+	}
+
+	log.Printf("[Signaling] Connection to client %d dropped, waiting %s for it to resume...", c.ID, ResumeGracePeriod)
+	conn.Close()
+	c.Conn = nil
+	c.Parked = true
+	c.Queue = nil
+
+	var timer *time.Timer
+	timer = time.AfterFunc(ResumeGracePeriod, func() {
+		expireParkedClient(c, timer)
+	})
+	c.ParkTimer = timer
+	return true
+}
+
+// expireParkedClient deletes a parked client that did not resume in time.
+func expireParkedClient(c *structs.Client, timer *time.Timer) {
+	c.Lock.Lock()
+	if !c.Parked || c.ParkTimer != timer {
+		c.Lock.Unlock()
+		return
+	}
+	c.Parked = false
+	c.ParkTimer = nil
+	c.Queue = nil
+	c.Lock.Unlock()
+
+	log.Printf("[Signaling] Client %d did not resume its session in time", c.ID)
+	CloseHandler(c)
+}
+
+// evictParkedClient deletes a parked client connected to this server, so that its user can start a new session
+// without waiting for the old one to expire. Returns false if the client isn't parked.
+func evictParkedClient(c *structs.Client) bool {
+	c.Lock.Lock()
+	if !c.Parked {
+		c.Lock.Unlock()
+		return false
+	}
+	c.Parked = false
+	if c.ParkTimer != nil {
+		c.ParkTimer.Stop()
+		c.ParkTimer = nil
+	}
+	c.Queue = nil
+	c.Lock.Unlock()
+
+	log.Printf("[Signaling] Replacing parked client %d with a new session", c.ID)
+	CloseHandler(c)
+	return true
+}
+
+// evictClient deletes a parked client, asking the server it is connected to if necessary.
+// Returns false if the client isn't parked, or the server it is connected to didn't respond.
+func evictClient(c *structs.Client) bool {
+	if Relay != nil && c.Node != "" && c.Node != Node {
+		reply := requestNode(c.Node, &relay.Message{Recipient: c.ULID, Evict: true})
+		return reply != nil && reply.OK
+	}
+	return evictParkedClient(c)
+}
+
+// HandleResumeOpcode handles the RESUME opcode. Returns the client that the connection belongs to afterwards.
+func HandleResumeOpcode(c *structs.Client, packet *structs.SignalPacket, dm *dm.Manager) *structs.Client {
+	if c.ValidSession {
+		SendCodeWithMessage(c, nil, "SESSION_EXISTS", packet.Listener)
+		return c
+	}
+
+	// Assert the payload is a string, and a valid ULID
+	if msg := utils.VariableContainsValidationError("payload", validate.Var(packet.Payload, "ulid")); msg != nil {
+		SendCodeWithMessage(c, msg)
+		return c
+	}
+
+	// Find the session to resume. Sessions can only be resumed within the same game.
+	token := packet.Payload.(string)
+	session := Manager.GetClientByResumeToken(token)
+	if session == nil || session.UGI != c.UGI {
+		SendCodeWithMessage(c, nil, "RESUME_INVALID", packet.Listener)
+		return c
+	}
+
+	// Check if the session token has expired (ignore if authless mode is enabled)
+	if !dm.AuthlessMode && session.Expiry < time.Now().Unix() {
+		SendCodeWithMessage(c, nil, "TOKEN_EXPIRED", packet.Listener)
+		return c
+	}
+
+	// The session belongs to a client connected to another server, which must hand it over first
+	if Relay != nil && session.Node != "" && session.Node != Node {
+		return resumeRemoteSession(c, session, token, packet)
+	}
+
+	session.Lock.Lock()
+
+	// The session expired while we were looking for it
+	if !session.Parked && session.Conn == nil {
+		session.Lock.Unlock()
+		SendCodeWithMessage(c, nil, "RESUME_INVALID", packet.Listener)
+		return c
+	}
+
+	// Stop the expiry timer and take over the session. If the old connection is still open, close it.
+	if session.ParkTimer != nil {
+		session.ParkTimer.Stop()
+		session.ParkTimer = nil
+	}
+	if session.Conn != nil {
+		session.Conn.Close()
+	}
+	session.Conn = c.Conn
+	session.Parked = false
+	queue := session.Queue
+	session.Queue = nil
+
+	return finishResume(c, session, queue, packet)
+}
+
+// resumeRemoteSession asks the server a client is connected to to hand it over, and resumes its session on this server.
+func resumeRemoteSession(c *structs.Client, session *structs.Client, token string, packet *structs.SignalPacket) *structs.Client {
+	reply := requestNode(session.Node, &relay.Message{Recipient: session.ULID, Handoff: token})
+	if reply == nil || !reply.OK {
+		SendCodeWithMessage(c, nil, "RESUME_INVALID", packet.Listener)
+		return c
+	}
+
+	// The other server has let go of the client. Load its latest state and attach it to this server.
+	if session = Manager.GetClientByULID(session.ULID); session == nil {
+		SendCodeWithMessage(c, nil, "RESUME_INVALID", packet.Listener)
+		return c
+	}
+	session.Lock.Lock()
+	session.Conn = c.Conn
+	session.Node = Node
+	session.Authorization = reply.Authorization
+	Manager.Attach(session)
+
+	queue := make([]any, len(reply.Queue))
+	for i, msg := range reply.Queue {
+		queue[i] = msg
+	}
+	return finishResume(c, session, queue, packet)
+}
+
+// handOffClient lets go of a client connected to this server, so that its session can be resumed on another server.
+// Returns the reply to the server that asked for the client.
+func handOffClient(c *structs.Client, token string) *relay.Message {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+
+	// The token may have been replaced, or the session may have expired, since the other server found it
+	if c.ResumeToken != token || (!c.Parked && c.Conn == nil) {
+		return &relay.Message{}
+	}
+
+	// Stop the expiry timer. If the old connection is still open, close it.
+	if c.ParkTimer != nil {
+		c.ParkTimer.Stop()
+		c.ParkTimer = nil
+	}
+	if c.Conn != nil {
+		c.Conn.Close()
+		c.Conn = nil
+	}
+
+	reply := &relay.Message{OK: true, Authorization: c.Authorization}
+	for _, msg := range c.Queue {
+		raw, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("[Signaling] Error handing off queued message for client %d: %s", c.ID, err)
+			continue
+		}
+		reply.Queue = append(reply.Queue, raw)
+	}
+	c.Parked = false
+	c.Queue = nil
+
+	log.Printf("[Signaling] Handing off client %d to another server", c.ID)
+	revokeResumeToken(c)
+	Manager.Detach(c)
+	return reply
+}
+
+// finishResume attaches a connection to the session it resumed, and sends RESUME_OK followed by the queued messages.
+// The caller must hold the session's lock, which is released.
+func finishResume(c *structs.Client, session *structs.Client, queue []any, packet *structs.SignalPacket) *structs.Client {
+	log.Printf("[Signaling] Client %d has resumed the session of client %d", c.ID, session.ID)
+
+	// Send RESUME_OK signal, followed by every message that was queued while the client was parked
+	session.Conn.WriteJSON(&structs.SignalPacket{
+		Opcode: "RESUME_OK",
+		Payload: &structs.ResumeOK{
+			User:        session.Username,
+			Id:          session.ULID,
+			Game:        session.GameName,
+			Developer:   session.DeveloperName,
+			ResumeToken: issueResumeToken(session),
+			Lobby:       session.Lobby,
+			IsHost:      session.IsHost,
+			IsPeer:      session.IsPeer,
+			Queued:      len(queue),
+		},
+		Listener: packet.Listener,
+	})
+	for _, msg := range queue {
+		session.Conn.WriteJSON(msg)
+	}
+	session.Lock.Unlock()
+
+	// The client created for this connection is no longer needed
+	Manager.Delete(c)
+	return session
+}
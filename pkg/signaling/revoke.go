@@ -0,0 +1,96 @@
+package signaling
+
+import (
+	"log"
+	"slices"
+
+	relay "github.com/cloudlink-omega/backend/pkg/signaling/relay"
+	structs "github.com/cloudlink-omega/backend/pkg/structs"
+	json "github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+)
+
+// DisconnectRevokedSession disconnects the signaling client of a user after their session has been revoked,
+// if the client uses one of the given session tokens. If no tokens are given, the client is disconnected regardless
+// of which session it used (i.e. logging out everywhere). Clients connected to other servers are disconnected by their own server.
+func DisconnectRevokedSession(userid string, tokens ...string) {
+	disconnectUser(userid, tokens, &structs.SignalPacket{
+		Opcode:  "SESSION_REVOKED",
+		Payload: "Your session has been revoked. Please log in again.",
+	})
+}
+
+// DisconnectBannedUser disconnects the signaling client of a user that was just banned, telling them why.
+func DisconnectBannedUser(userid string, notice *structs.BanNotice) {
+	disconnectUser(userid, nil, &structs.SignalPacket{
+		Opcode:  "USER_BANNED",
+		Payload: notice,
+	})
+}
+
+// disconnectUser sends a final packet to the signaling client of a user, and disconnects it.
+// Clients connected to other servers are disconnected by their own server.
+func disconnectUser(userid string, tokens []string, packet *structs.SignalPacket) {
+	client := Manager.GetClientByULID(userid)
+	if client == nil {
+		return
+	}
+
+	raw, err := json.Marshal(packet)
+	if err != nil {
+		log.Printf("[Signaling] Error preparing %s packet: %s", packet.Opcode, err)
+		return
+	}
+
+	// Ask the server the client is connected to to disconnect it
+	if Relay != nil && client.Node != "" && client.Node != Node {
+		if err := Relay.Publish(client.Node, &relay.Message{
+			Origin:    Node,
+			Recipient: userid,
+			Packet:    raw,
+			Close:     true,
+			Sessions:  tokens,
+		}); err != nil {
+			log.Printf("[Signaling] Error disconnecting client %d on server \"%s\": %s", client.ID, client.Node, err)
+		}
+		return
+	}
+
+	disconnectClient(client, tokens, raw)
+}
+
+// disconnectClient sends a final packet to a client connected to this server, and deletes it.
+// The client is left alone if tokens are given and the client uses a different session token.
+func disconnectClient(client *structs.Client, tokens []string, packet []byte) {
+	client.Lock.Lock()
+	if len(tokens) > 0 && !slices.Contains(tokens, client.Authorization) {
+		client.Lock.Unlock()
+		return
+	}
+
+	log.Printf("[Signaling] Disconnecting client %d...", client.ID)
+
+	// The session can't be resumed
+	client.ValidSession = false
+	revokeResumeToken(client)
+
+	// Parked clients have no handler to clean up after them, so delete them right away
+	if client.Parked {
+		client.Parked = false
+		client.Queue = nil
+		if client.ParkTimer != nil {
+			client.ParkTimer.Stop()
+			client.ParkTimer = nil
+		}
+		client.Lock.Unlock()
+		CloseHandler(client)
+		return
+	}
+
+	// Closing the connection makes the message handler delete the client
+	if client.Conn != nil {
+		client.Conn.WriteMessage(websocket.TextMessage, packet)
+		client.Conn.Close()
+	}
+	client.Lock.Unlock()
+}
@@ -3,8 +3,10 @@ package signaling
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -12,7 +14,9 @@ import (
 	accounts "github.com/cloudlink-omega/backend/pkg/accounts"
 	"github.com/cloudlink-omega/backend/pkg/constants"
 	dm "github.com/cloudlink-omega/backend/pkg/data"
+	errors "github.com/cloudlink-omega/backend/pkg/errors"
 	clientmgr "github.com/cloudlink-omega/backend/pkg/signaling/clientmgr"
+	relay "github.com/cloudlink-omega/backend/pkg/signaling/relay"
 	structs "github.com/cloudlink-omega/backend/pkg/structs"
 	utils "github.com/cloudlink-omega/backend/pkg/utils"
 	validator "github.com/go-playground/validator/v10"
@@ -21,12 +25,22 @@ import (
 
 // Define global variables
 var validate = validator.New(validator.WithRequiredStructEnabled())
-var Manager *clientmgr.ClientDB
+var Manager clientmgr.Store
+var Relay relay.Bus // Delivers messages to clients connected to other servers. Set with UseRelay.
+var Node string     // Server nickname of this signaling server.
+
+// HostReclaimTimeout is how long a lobby waits for one of its peers to claim it using CLAIM_HOST.
+// Lobbies that are still without a host afterwards are closed.
+var HostReclaimTimeout = 30 * time.Second
+
+// reclaimTimers holds the timers that close lobbies nobody claimed, keyed by UGI and lobby ID.
+var reclaimTimers = map[[2]string]*time.Timer{}
+var reclaimTimersLock sync.Mutex
 
 func init() {
 	log.Print("[Signaling] Initializing...")
 
-	// Initialize client manager
+	// Initialize client manager (this may be replaced by a KeyDB client manager when the server starts)
 	Manager = clientmgr.New()
 
 	// Register custom label function for validator
@@ -37,14 +51,115 @@ func init() {
 	log.Print("[Signaling] Initialized!")
 }
 
+// UseRelay configures the signaling server to deliver messages to clients connected to other servers,
+// and to accept messages relayed by other servers for the clients connected to this server.
+func UseRelay(node string, bus relay.Bus) error {
+	Node = node
+	Relay = bus
+	return bus.Subscribe(node, func(msg *relay.Message) {
+		if msg.Reply {
+			deliverReply(msg)
+			return
+		}
+
+		client := Manager.GetClientByULID(msg.Recipient)
+		if client == nil {
+			log.Printf("[Signaling] Dropping message relayed from %s: client %s is not connected to this server", msg.Origin, msg.Recipient)
+			if msg.Request != "" {
+				replyToNode(msg, &relay.Message{})
+			}
+			return
+		}
+
+		// Another server wants to start a new session for the client's user
+		if msg.Evict {
+			replyToNode(msg, &relay.Message{OK: evictParkedClient(client)})
+			return
+		}
+
+		// Another server wants to resume the client's session
+		if msg.Handoff != "" {
+			replyToNode(msg, handOffClient(client, msg.Handoff))
+			return
+		}
+
+		// Another server has revoked the client's session
+		if msg.Close {
+			disconnectClient(client, msg.Sessions, msg.Packet)
+			return
+		}
+
+		// Get a lock so that we don't send multiple messages at once
+		client.Lock.Lock()
+		defer client.Lock.Unlock()
+
+		// Queue the message if the client is waiting to resume its session
+		if client.Parked {
+			queueMessage(client, msg.Packet)
+			return
+		}
+		if client.Conn == nil {
+			log.Printf("[Signaling] Dropping message relayed from %s: client %s is not connected to this server", msg.Origin, msg.Recipient)
+			return
+		}
+		client.Conn.WriteMessage(websocket.TextMessage, msg.Packet)
+	})
+}
+
+// RelayMessage sends a signaling message to a client connected to another server.
+func RelayMessage(c *structs.Client, packet any) {
+	if Relay == nil || c.Node == "" || c.Node == Node || c.ULID == "" {
+		log.Printf("[Signaling] WARNING: Unable to relay a message to client %d on server \"%s\".", c.ID, c.Node)
+		return
+	}
+
+	raw, err := json.Marshal(packet)
+	if err != nil {
+		log.Printf("[Signaling] Error relaying packet: %s", err)
+		return
+	}
+
+	if err := Relay.Publish(c.Node, &relay.Message{
+		Origin:    Node,
+		Recipient: c.ULID,
+		Packet:    raw,
+	}); err != nil {
+		log.Printf("[Signaling] Error relaying packet to client %d on server \"%s\": %s", c.ID, c.Node, err)
+	}
+}
+
 // MessageHandler handles incoming messages from the browser using a websocket connection.
 func MessageHandler(c *structs.Client, dm *dm.Manager, r *http.Request) {
 	log.Printf("[Signaling] Spawning handler for client %d", c.ID)
 
 	var err error
-	defer CloseHandler(c)
+	var rawPacket []byte
+
+	// Delete the client when the handler exits, unless it is waiting to resume its session
+	var parked bool
+	defer func() {
+		if !parked {
+			CloseHandler(c)
+		}
+	}()
+
+	// Ping the client periodically, and treat it as disconnected if it stops responding
+	defer close(heartbeat(c.Conn))
+
+	// Rate limits for this connection (allowlisted addresses are exempt)
+	limits := newConnectionLimits()
+	exempt := dm.IsIPAllowed(utils.RemoteIP(r))
+
 	for {
-		_, rawPacket, _ := c.Conn.ReadMessage()
+		conn := c.Conn
+		if _, rawPacket, err = conn.ReadMessage(); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				log.Printf("[Signaling] Client %d did not respond within %s", c.ID, IdleTimeout)
+			}
+			parked = ParkClient(c, conn, err)
+			return
+		}
+		extendDeadline(conn)
 
 		// Read messages from browser as JSON using SignalPacket struct.
 		packet := &structs.SignalPacket{}
@@ -52,16 +167,32 @@ func MessageHandler(c *structs.Client, dm *dm.Manager, r *http.Request) {
 			errstring := fmt.Sprintf("[Signaling] Error reading packet: %s", err)
 			log.Println(errstring)
 			SendCodeWithMessage(
-				c.Conn,
+				c,
 				errstring,
 			)
 			return
 		}
 
+		// Enforce rate limits. Clients that keep exceeding them are disconnected.
+		if !exempt && !limits.allow(packet.Opcode) {
+			if !limits.strikes.Allow() {
+				log.Printf("[Signaling] Client %d keeps exceeding rate limits, disconnecting...", c.ID)
+				SendCodeWithMessage(
+					c,
+					"Too many requests.",
+				)
+				return
+			}
+			SendCodeWithMessage(c, packet.Opcode, "RATE_LIMITED", packet.Listener)
+			continue
+		}
+
 		// Handle packet
 		switch packet.Opcode {
 		case "INIT":
 			HandleInitOpcode(c, packet, dm, r)
+		case "RESUME":
+			c = HandleResumeOpcode(c, packet, dm)
 		case "KEEPALIVE":
 			HandleKeepaliveOpcode(c, packet)
 		case "CONFIG_HOST":
@@ -79,17 +210,17 @@ func MessageHandler(c *structs.Client, dm *dm.Manager, r *http.Request) {
 		case "LOBBY_INFO":
 			HandleLobbyInfo(c, packet)
 		case "CLAIM_HOST":
-			// TODO: implement CLAIM_HOST
+			HandleClaimHostOpcode(c, packet)
 		case "TRANSFER_HOST":
-			// TODO: implement TRANSFER_HOST
+			HandleTransferHostOpcode(c, packet)
 		case "LOCK":
-			// TODO: implement LOCK
+			HandleLockOpcode(c, packet, true)
 		case "UNLOCK":
-			// TODO: implement UNLOCK
+			HandleLockOpcode(c, packet, false)
 		case "SIZE":
-			// TODO: implement SIZE
+			HandleSizeOpcode(c, packet, rawPacket)
 		case "KICK":
-			// TODO: implement KICK
+			HandleKickOpcode(c, packet)
 		}
 	}
 }
@@ -302,11 +433,17 @@ func HandleConfigPeerOpcode(c *structs.Client, packet *structs.SignalPacket, raw
 		return
 	}
 	if len(hosts) > 1 {
-		log.Fatalf("[Signaling] Multiple hosts found for UGI %s and lobby %s. This should never happen. Shutting down...", c.UGI, rePacket.Payload.LobbyID)
+		log.Printf("[Signaling] WARNING: Multiple hosts found for UGI %s and lobby %s. Refusing to join.", c.UGI, rePacket.Payload.LobbyID)
+		SendCodeWithMessage(c, "This lobby has more than one host.", "LOBBY_NOTFOUND", packet.Listener)
+		return
 	}
 
-	// Get lobby
+	// Get lobby. It may have been deleted since the host was found.
 	lobby := Manager.GetLobbyConfigStorage(c.UGI, rePacket.Payload.LobbyID)
+	if lobby == nil {
+		SendCodeWithMessage(c, nil, "LOBBY_NOTFOUND", packet.Listener)
+		return
+	}
 
 	// Check if lobby is full, or no limit is set (0)
 	if lobby.MaximumPeers != 0 {
@@ -344,6 +481,7 @@ func HandleConfigPeerOpcode(c *structs.Client, packet *structs.SignalPacket, raw
 		log.Printf("[Signaling] Client %d specified a public key! Secure message support enabled.", c.ID)
 	}
 	c.PublicKey = rePacket.Payload.PublicKey
+	Manager.Update(c)
 
 	// Tell the peer to anticipate an incoming connection from the host
 	SendMessage(c, &structs.SignalPacket{
@@ -427,19 +565,20 @@ func HandleConfigHostOpcode(c *structs.Client, packet *structs.SignalPacket, raw
 	}
 
 	// Check if a lobby exists within the current game. If not, create one.
-	matches := Manager.GetHostClientsByUGIAndLobby(c.UGI, rePacket.Payload.LobbyID)
-	if len(matches) != 0 {
+	// A lobby without a host may still exist while its peers are reclaiming it.
+	if len(Manager.GetHostClientsByUGIAndLobby(c.UGI, rePacket.Payload.LobbyID)) != 0 {
 		// Cannot create lobby since it already exists
 		SendCodeWithMessage(c, nil, "LOBBY_EXISTS", packet.Listener)
 		return
 	}
 
-	// Config the client as a host
-	c.IsHost = true
-	c.Lobby = rePacket.Payload.LobbyID
-
-	// Create lobby and store the desired settings
+	// Create lobby and store the desired settings. Creating fails if another client (possibly connected to
+	// another server) created the lobby first.
 	lobby := Manager.CreateLobbyConfigStorage(c.UGI, rePacket.Payload.LobbyID)
+	if lobby == nil {
+		SendCodeWithMessage(c, nil, "LOBBY_EXISTS", packet.Listener)
+		return
+	}
 
 	// Store lobby settings.
 	// TODO: I'm pretty sure there's a more elegant way to do this...
@@ -447,9 +586,6 @@ func HandleConfigHostOpcode(c *structs.Client, packet *structs.SignalPacket, raw
 	lobby.MaximumPeers = rePacket.Payload.MaximumPeers
 	lobby.AllowHostReclaim = rePacket.Payload.AllowHostReclaim
 	lobby.AllowPeersToReclaim = rePacket.Payload.AllowPeersToReclaim
-	lobby.CurrentOwnerID = c.ID
-	lobby.CurrentOwnerULID = c.ULID
-	lobby.CurrentOwnerUsername = c.Username
 	lobby.Locked = false
 	lobby.IsPublic = (len(rePacket.Payload.Password) == 0)
 
@@ -457,12 +593,24 @@ func HandleConfigHostOpcode(c *structs.Client, packet *structs.SignalPacket, raw
 	if !lobby.IsPublic {
 		lobby.Password = accounts.HashPassword(rePacket.Payload.Password)
 	}
+	Manager.UpdateLobbyConfigStorage(c.UGI, rePacket.Payload.LobbyID, lobby)
+
+	// Make the client the owner of the newly created lobby
+	if !Manager.ClaimLobbyOwnership(c.UGI, rePacket.Payload.LobbyID, c) {
+		SendCodeWithMessage(c, nil, "LOBBY_EXISTS", packet.Listener)
+		return
+	}
+
+	// Config the client as a host
+	c.IsHost = true
+	c.Lobby = rePacket.Payload.LobbyID
 
 	// If the host specifies a public key, set it.
 	if rePacket.Payload.PublicKey != "" {
 		log.Printf("[Signaling] Client %d specified a public key! Secure message support enabled.", c.ID)
 	}
 	c.PublicKey = rePacket.Payload.PublicKey
+	Manager.Update(c)
 
 	// Broadcast new host
 	log.Printf("[Signaling] Client %d is now a host in lobby %s and UGI %s", c.ID, rePacket.Payload.LobbyID, c.UGI)
@@ -508,14 +656,11 @@ func HandleInitOpcode(c *structs.Client, packet *structs.SignalPacket, dm *dm.Ma
 
 	// Check if the token is valid in the DB
 	tmpClient, err := dm.VerifySessionToken(ulidToken)
-	if err != nil {
-		SendCodeWithMessage(c, err.Error(), "TOKEN_INVALID", packet.Listener)
+	if err == errors.ErrSessionRevoked {
+		SendCodeWithMessage(c, err.Error(), "TOKEN_REVOKED", packet.Listener)
 		return
-	}
-
-	// Check if the user is already connected
-	if Manager.GetClientByULID(tmpClient.ULID) != nil {
-		SendCodeWithMessage(c, nil, "SESSION_EXISTS", packet.Listener)
+	} else if err != nil {
+		SendCodeWithMessage(c, err.Error(), "TOKEN_INVALID", packet.Listener)
 		return
 	}
 
@@ -537,23 +682,57 @@ func HandleInitOpcode(c *structs.Client, packet *structs.SignalPacket, dm *dm.Ma
 		return
 	}
 
+	// Refuse blocked and banned accounts (ignore if authless mode is enabled)
+	if !dm.AuthlessMode {
+		if ban, err := dm.CheckUserStanding(tmpClient.ULID); err == errors.ErrUserBlocked {
+			SendCodeWithMessage(c, "Your account has been disabled.", "USER_BLOCKED", packet.Listener)
+			return
+		} else if err == errors.ErrUserBanned {
+			SendCodeWithMessage(c, &structs.BanNotice{
+				Reason:  ban.Reason,
+				Expires: ban.Expires,
+				Appeal:  ban.Appeal,
+			}, "USER_BANNED", packet.Listener)
+			return
+		} else if err != nil {
+			SendCodeWithMessage(c, err.Error())
+			return
+		}
+	}
+
+	// Check if the user is already connected. A client that is waiting to resume its session is replaced.
+	if existing := Manager.GetClientByULID(tmpClient.ULID); existing != nil && !evictClient(existing) {
+		SendCodeWithMessage(c, nil, "SESSION_EXISTS", packet.Listener)
+		return
+	}
+
 	// Configure client session
 	c.Authorization = packet.Payload.(string)
 	c.ULID = tmpClient.ULID
 	c.Username = tmpClient.Username
 	c.Expiry = tmpClient.Expiry
 	c.ValidSession = true
+	Manager.Update(c)
 
-	// Get game name and developer name for the client
-	gameName, developerName, _ := dm.VerifyUGI(c.UGI)
+	// Get game name, developer name and game flags for the client.
+	// The game may have been deactivated since the connection was opened.
+	game, err := dm.VerifyUGI(c.UGI)
+	if err != nil {
+		SendCodeWithMessage(c, err.Error())
+		return
+	}
 
 	// Send INIT_OK signal
 
 	SendCodeWithMessage(c, &structs.InitOK{
-		User:      c.Username,
-		Id:        tmpClient.ULID,
-		Game:      gameName,
-		Developer: developerName,
+		User:        c.Username,
+		Id:          tmpClient.ULID,
+		Game:        game.GameName,
+		Developer:   game.DeveloperName,
+		ResumeToken: issueResumeToken(c),
+		Voice:       game.GameState.Read(constants.GAME_SUPPORTS_VOICE),
+		Mature:      game.GameState.Read(constants.GAME_IS_MATURE),
+		Verified:    game.GameState.Read(constants.GAME_IS_VERIFIED),
 	},
 		"INIT_OK",
 		packet.Listener,
@@ -572,6 +751,18 @@ func SendMessage(c *structs.Client, packet any) {
 
 	// Send message and unlock
 	defer c.Lock.Unlock()
+
+	// Queue the message if the client is waiting to resume its session
+	if c.Parked {
+		queueMessage(c, packet)
+		return
+	}
+
+	// Relay the message if the client is connected to another server
+	if c.Conn == nil {
+		RelayMessage(c, packet)
+		return
+	}
 	c.Conn.WriteJSON(packet)
 }
 
@@ -586,42 +777,58 @@ func BroadcastMessage(c []*structs.Client, packet any) {
 // If a custom error code is not provided, the VIOLATION opcode will be used and the
 // connection will be closed afterwards.
 func SendCodeWithMessage(conn any, message any, extraargs ...string) {
-	var client *websocket.Conn
+	packet := &structs.SignalPacket{
+		Opcode:  "VIOLATION",
+		Payload: message,
+	}
+	if len(extraargs) > 0 {
+		packet.Opcode = extraargs[0]
+	}
+	if len(extraargs) > 1 {
+		packet.Listener = extraargs[1]
+	}
 
 	// Handle connection type
 	switch v := conn.(type) {
 	case *websocket.Conn:
-		client = v
+		// Connections without a client have no other writers
+		writeCode(v, packet)
+
 	case *structs.Client:
-		client = v.Conn
+		// Get a lock so that we don't send multiple messages at once
+		v.Lock.Lock()
+		defer v.Lock.Unlock()
+
+		if len(extraargs) > 0 {
+			// Queue the code if the client is waiting to resume its session
+			if v.Parked {
+				queueMessage(v, packet)
+				return
+			}
+
+			// Relay the code if the client is connected to another server. Remote clients are never disconnected.
+			if v.Conn == nil {
+				RelayMessage(v, packet)
+				return
+			}
+		}
+		writeCode(v.Conn, packet)
+
 	default:
 		panic("[Signaling] Attempted to send a code message to a invalid type. ")
 	}
+}
 
-	if len(extraargs) == 0 || extraargs == nil {
-		defer client.Close()
-		client.WriteJSON(&structs.SignalPacket{
-			Opcode:  "VIOLATION",
-			Payload: message,
-		})
+// writeCode writes a code message to a connection, and closes the connection if the code is VIOLATION.
+func writeCode(client *websocket.Conn, packet *structs.SignalPacket) {
+	if client == nil {
+		log.Println("[Signaling] WARNING: Attempted to send a code message to a client without a connection.")
 		return
 	}
-
-	// Send code
-	if len(extraargs) == 1 {
-		client.WriteJSON(&structs.SignalPacket{
-			Opcode:  extraargs[0],
-			Payload: message,
-		})
-		return
+	if packet.Opcode == "VIOLATION" {
+		defer client.Close()
 	}
-
-	// Send code with listener
-	client.WriteJSON(&structs.SignalPacket{
-		Opcode:   extraargs[0],
-		Payload:  message,
-		Listener: extraargs[1],
-	})
+	client.WriteJSON(packet)
 }
 
 // CloseHandler prepares a client to be deleted.
@@ -633,67 +840,463 @@ func CloseHandler(client *structs.Client) {
 		// Get lobby configuration
 		lobby := Manager.GetLobbyConfigStorage(client.UGI, client.Lobby)
 
-		if !lobby.AllowHostReclaim {
+		if lobby == nil || !lobby.AllowHostReclaim {
 			// The lobby does not support reclaiming; close the entire lobby.
 			FullLobbyClose(client)
 
+		} else if len(Manager.GetPeerClientsByUGIAndLobby(client.UGI, client.Lobby)) == 0 {
+			// The lobby supports reclaiming, but there is nobody left to reclaim it.
+			FullLobbyClose(client)
+
 		} else if !lobby.AllowPeersToReclaim {
 			// The lobby supports reclaiming, but the server will decide who becomes the new host.
-			// Stub
-			FullLobbyClose(client)
+			ServerHostReclaim(client)
 
 		} else {
 			// The lobby supports reclaiming, but peers will be responsible for reclaiming.
-			// Stub
-			FullLobbyClose(client)
+			PeerHostReclaim(client)
 		}
 
 	} else if client.IsPeer {
 		// Check if the client is a peer. If it is, remove it from the lobby.
-
-		// Notify the host that the peer is going away.
 		lobby := Manager.GetLobbyConfigStorage(client.UGI, client.Lobby)
-		host := Manager.GetClientByULID(lobby.CurrentOwnerULID)
-		SendCodeWithMessage(host, client.ULID, "PEER_GONE")
+
+		if lobby != nil && lobby.CurrentOwnerULID != "" {
+			// Notify the host that the peer is going away.
+			if host := Manager.GetClientByULID(lobby.CurrentOwnerULID); host != nil {
+				SendCodeWithMessage(host, client.ULID, "PEER_GONE")
+			}
+
+		} else if lobby != nil && len(Manager.GetPeerClientsByUGIAndLobby(client.UGI, client.Lobby)) <= 1 {
+			// The lobby is waiting for a peer to claim it, but this was the last peer. Close the lobby.
+			FullLobbyClose(client)
+		}
 	}
 
 	// Delete the client
+	revokeResumeToken(client)
 	Manager.Delete(client)
 
 	// Close connection.
-	client.Conn.Close()
+	if client.Conn != nil {
+		client.Conn.Close()
+	}
+}
+
+// ServerHostReclaim removes a host from its lobby, and makes the longest-connected peer the new host.
+func ServerHostReclaim(client *structs.Client) {
+	peers := Manager.GetPeerClientsByUGIAndLobby(client.UGI, client.Lobby)
+
+	// Client IDs are assigned in connection order, so the lowest ID has been connected the longest.
+	var candidate *structs.Client
+	for _, peer := range peers {
+		if candidate == nil || peer.ID < candidate.ID {
+			candidate = peer
+		}
+	}
+
+	// Step down the old host and hand the lobby to the candidate
+	client.IsHost = false
+	Manager.Update(client)
+	Manager.ReleaseLobbyOwnership(client.UGI, client.Lobby)
+	if !Manager.ClaimLobbyOwnership(client.UGI, client.Lobby, candidate) {
+		log.Printf("[Signaling] Failed to reclaim lobby %s in UGI %s. Closing the lobby...", client.Lobby, client.UGI)
+		FullLobbyClose(client)
+		return
+	}
+
+	log.Printf("[Signaling] Server has made client %d the new host of lobby %s in UGI %s", candidate.ID, client.Lobby, client.UGI)
+
+	// Tell the remaining peers that the host is gone
+	for _, peer := range peers {
+		SendCodeWithMessage(peer, client.ULID, "HOST_GONE")
+	}
+
+	// Make the candidate the host
+	PromoteToHost(candidate)
+
+	// Tell every peer (including the new host) who the new host is
+	BroadcastMessage(peers, &structs.SignalPacket{
+		Opcode: "HOST_RECLAIM",
+		Payload: &structs.NewHostParams{
+			ID:        candidate.ULID,
+			User:      candidate.Username,
+			LobbyID:   candidate.Lobby,
+			PublicKey: candidate.PublicKey,
+		},
+	})
+}
+
+// PeerHostReclaim removes a host from its lobby, and lets the remaining peers race to claim the lobby using CLAIM_HOST.
+func PeerHostReclaim(client *structs.Client) {
+
+	// Step down the old host and leave the lobby without an owner
+	client.IsHost = false
+	Manager.Update(client)
+	Manager.ReleaseLobbyOwnership(client.UGI, client.Lobby)
+
+	log.Printf("[Signaling] Lobby %s in UGI %s is waiting for a peer to claim it", client.Lobby, client.UGI)
+
+	// Tell the remaining peers that the host is gone, so they can send CLAIM_HOST
+	for _, peer := range Manager.GetPeerClientsByUGIAndLobby(client.UGI, client.Lobby) {
+		SendCodeWithMessage(peer, client.ULID, "HOST_GONE")
+	}
+
+	// Don't leave the lobby without a host forever if nobody claims it
+	key := [2]string{client.UGI, client.Lobby}
+	reclaimTimersLock.Lock()
+	defer reclaimTimersLock.Unlock()
+	if timer, ok := reclaimTimers[key]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(HostReclaimTimeout, func() {
+
+		// The timer may have been replaced or stopped while it was firing
+		reclaimTimersLock.Lock()
+		if reclaimTimers[key] != timer {
+			reclaimTimersLock.Unlock()
+			return
+		}
+		delete(reclaimTimers, key)
+		reclaimTimersLock.Unlock()
+
+		closeUnclaimedLobby(key[0], key[1])
+	})
+	reclaimTimers[key] = timer
+}
+
+// stopReclaimTimer stops waiting for a peer to claim a lobby.
+func stopReclaimTimer(ugi string, lobbyID string) {
+	reclaimTimersLock.Lock()
+	defer reclaimTimersLock.Unlock()
+	if timer, ok := reclaimTimers[[2]string{ugi, lobbyID}]; ok {
+		timer.Stop()
+		delete(reclaimTimers, [2]string{ugi, lobbyID})
+	}
+}
+
+// closeUnclaimedLobby closes a lobby if none of its peers have claimed it since the host left.
+func closeUnclaimedLobby(ugi string, lobbyID string) {
+	lobby := Manager.GetLobbyConfigStorage(ugi, lobbyID)
+	if lobby == nil || lobby.CurrentOwnerULID != "" {
+		return
+	}
+
+	log.Printf("[Signaling] Nobody claimed lobby %s in UGI %s within %s. Closing the lobby...", lobbyID, ugi, HostReclaimTimeout)
+	FullLobbyClose(&structs.Client{UGI: ugi, Lobby: lobbyID})
+}
+
+// PromoteToHost turns a peer into the host of the lobby it is currently in.
+func PromoteToHost(c *structs.Client) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	c.IsPeer = false
+	c.IsHost = true
+	Manager.Update(c)
+}
+
+// HandleLockOpcode handles the LOCK and UNLOCK opcodes.
+func HandleLockOpcode(c *structs.Client, packet *structs.SignalPacket, locked bool) {
+	// Check if the client has a valid session
+	if !c.ValidSession {
+		SendCodeWithMessage(c, nil, "CONFIG_REQUIRED", packet.Listener)
+		return
+	}
+
+	// Only the host can lock or unlock the lobby
+	if !c.IsHost {
+		SendCodeWithMessage(c, nil, "NOT_HOST", packet.Listener)
+		return
+	}
+
+	// Get lobby
+	lobby := Manager.GetLobbyConfigStorage(c.UGI, c.Lobby)
+	if lobby == nil {
+		SendCodeWithMessage(c, nil, "LOBBY_NOTFOUND", packet.Listener)
+		return
+	}
+
+	// Update the lobby
+	lobby.Locked = locked
+	Manager.UpdateLobbyConfigStorage(c.UGI, c.Lobby, lobby)
+
+	if locked {
+		log.Printf("[Signaling] Client %d has locked lobby %s in UGI %s", c.ID, c.Lobby, c.UGI)
+		SendCodeWithMessage(c, nil, "ACK_LOCK", packet.Listener)
+	} else {
+		log.Printf("[Signaling] Client %d has unlocked lobby %s in UGI %s", c.ID, c.Lobby, c.UGI)
+		SendCodeWithMessage(c, nil, "ACK_UNLOCK", packet.Listener)
+	}
+}
+
+// HandleSizeOpcode handles the SIZE opcode.
+func HandleSizeOpcode(c *structs.Client, packet *structs.SignalPacket, rawPacket []byte) {
+	// Check if the client has a valid session
+	if !c.ValidSession {
+		SendCodeWithMessage(c, nil, "CONFIG_REQUIRED", packet.Listener)
+		return
+	}
+
+	// Only the host can resize the lobby
+	if !c.IsHost {
+		SendCodeWithMessage(c, nil, "NOT_HOST", packet.Listener)
+		return
+	}
+
+	// Remarshal using LobbySizePacket
+	rePacket := &structs.LobbySizePacket{}
+	if err := json.Unmarshal(rawPacket, &rePacket); err != nil {
+		log.Printf("[Signaling] Error reading packet: %s", err)
+		SendCodeWithMessage(c, err.Error())
+		return
+	}
+
+	// Validate the whole packet, so that a missing payload or size is refused instead of removing the limit
+	if msg := utils.StructContainsValidationError(validate.Struct(rePacket)); msg != nil {
+		SendCodeWithMessage(c, msg, "WARNING", packet.Listener)
+		return
+	}
+	size := *rePacket.Payload.MaximumPeers
+
+	// Get lobby
+	lobby := Manager.GetLobbyConfigStorage(c.UGI, c.Lobby)
+	if lobby == nil {
+		SendCodeWithMessage(c, nil, "LOBBY_NOTFOUND", packet.Listener)
+		return
+	}
+
+	// Refuse to shrink the lobby below the current number of peers, unless forced (0 means no limit)
+	peers := len(Manager.GetPeerClientsByUGIAndLobby(c.UGI, c.Lobby))
+	if size != 0 && peers > size && !rePacket.Payload.Force {
+		SendCodeWithMessage(c, peers, "SIZE_TOO_SMALL", packet.Listener)
+		return
+	}
+
+	// Update the lobby
+	lobby.MaximumPeers = size
+	Manager.UpdateLobbyConfigStorage(c.UGI, c.Lobby, lobby)
+
+	log.Printf("[Signaling] Client %d has resized lobby %s in UGI %s to %d peers", c.ID, c.Lobby, c.UGI, lobby.MaximumPeers)
+	SendCodeWithMessage(c, lobby.MaximumPeers, "ACK_SIZE", packet.Listener)
+}
+
+// HandleKickOpcode handles the KICK opcode.
+func HandleKickOpcode(c *structs.Client, packet *structs.SignalPacket) {
+	// Check if the client has a valid session
+	if !c.ValidSession {
+		SendCodeWithMessage(c, nil, "CONFIG_REQUIRED", packet.Listener)
+		return
+	}
+
+	// Only the host can kick peers
+	if !c.IsHost {
+		SendCodeWithMessage(c, nil, "NOT_HOST", packet.Listener)
+		return
+	}
+
+	// Verify the recipient argument is a valid ULID
+	if msg := utils.VariableContainsValidationError("recipient", validate.Var(packet.Recipient, "ulid")); msg != nil {
+		SendCodeWithMessage(c, msg, "WARNING", packet.Listener)
+		return
+	}
+
+	// Check if the recipient is a peer within the lobby
+	recipient := Manager.GetClientBySpecificULIDinUGIAndLobby(packet.Recipient, c.UGI, c.Lobby)
+	if recipient == nil || !recipient.IsPeer {
+		SendCodeWithMessage(c, nil, "PEER_INVALID", packet.Listener)
+		return
+	}
+
+	lobbyID := c.Lobby
+	log.Printf("[Signaling] Client %d has kicked client %d from lobby %s in UGI %s", c.ID, recipient.ID, lobbyID, c.UGI)
+
+	// Reset the peer's lobby state
+	func() {
+		recipient.Lock.Lock()
+		defer recipient.Lock.Unlock()
+		recipient.IsPeer = false
+		recipient.Lobby = ""
+		recipient.PublicKey = ""
+		Manager.Update(recipient)
+	}()
+
+	// Tell the peer it has been kicked
+	SendCodeWithMessage(recipient, lobbyID, "KICKED")
+
+	// Tell the rest of the lobby that the peer is gone
+	for _, peer := range Manager.GetPeerClientsByUGIAndLobby(c.UGI, lobbyID) {
+		SendCodeWithMessage(peer, recipient.ULID, "PEER_GONE")
+	}
+
+	// Tell the host that the peer was kicked
+	SendCodeWithMessage(c, recipient.ULID, "ACK_KICK", packet.Listener)
+}
+
+// DemoteToPeer turns a host into a peer of the lobby it is currently in.
+func DemoteToPeer(c *structs.Client) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	c.IsHost = false
+	c.IsPeer = true
+	Manager.Update(c)
+}
+
+// HandleTransferHostOpcode handles the TRANSFER_HOST opcode.
+func HandleTransferHostOpcode(c *structs.Client, packet *structs.SignalPacket) {
+	// Check if the client has a valid session
+	if !c.ValidSession {
+		SendCodeWithMessage(c, nil, "CONFIG_REQUIRED", packet.Listener)
+		return
+	}
+
+	// Only the host can transfer the lobby
+	if !c.IsHost {
+		SendCodeWithMessage(c, nil, "NOT_HOST", packet.Listener)
+		return
+	}
+
+	// Verify the recipient argument is a valid ULID
+	if msg := utils.VariableContainsValidationError("recipient", validate.Var(packet.Recipient, "ulid")); msg != nil {
+		SendCodeWithMessage(c, msg, "WARNING", packet.Listener)
+		return
+	}
+
+	// Check if the recipient is a peer within the lobby
+	recipient := Manager.GetClientBySpecificULIDinUGIAndLobby(packet.Recipient, c.UGI, c.Lobby)
+	if recipient == nil || !recipient.IsPeer || recipient.ULID == c.ULID {
+		SendCodeWithMessage(c, nil, "PEER_INVALID", packet.Listener)
+		return
+	}
+
+	// Hand over the lobby
+	if !Manager.TransferLobbyOwnership(c.UGI, c.Lobby, c, recipient) {
+		SendCodeWithMessage(c, nil, "NOT_HOST", packet.Listener)
+		return
+	}
+
+	log.Printf("[Signaling] Client %d has transferred lobby %s in UGI %s to client %d", c.ID, c.Lobby, c.UGI, recipient.ID)
+
+	// Swap roles
+	DemoteToPeer(c)
+	PromoteToHost(recipient)
+
+	newHost := &structs.NewHostParams{
+		ID:        recipient.ULID,
+		User:      recipient.Username,
+		LobbyID:   recipient.Lobby,
+		PublicKey: recipient.PublicKey,
+	}
+
+	// Tell the new host and the other peers who the new host is
+	SendMessage(recipient, &structs.SignalPacket{
+		Opcode:  "HOST_RECLAIM",
+		Payload: newHost,
+	})
+	for _, peer := range Manager.GetPeerClientsByUGIAndLobby(c.UGI, c.Lobby) {
+		if peer.ULID == c.ULID {
+			continue
+		}
+		SendMessage(peer, &structs.SignalPacket{
+			Opcode:  "HOST_RECLAIM",
+			Payload: newHost,
+		})
+	}
+
+	// Tell the old host that the transfer was successful
+	SendCodeWithMessage(c, newHost, "TRANSFER_OK", packet.Listener)
+}
+
+// HandleClaimHostOpcode handles the CLAIM_HOST opcode.
+func HandleClaimHostOpcode(c *structs.Client, packet *structs.SignalPacket) {
+	// Check if the client has a valid session
+	if !c.ValidSession {
+		SendCodeWithMessage(c, nil, "CONFIG_REQUIRED", packet.Listener)
+		return
+	}
+
+	// Check if the client is already a host
+	if c.IsHost {
+		SendCodeWithMessage(c, nil, "ALREADY_HOST", packet.Listener)
+		return
+	}
+
+	// Only peers can claim the lobby they are in
+	if !c.IsPeer {
+		SendCodeWithMessage(c, nil, "NOT_PEER", packet.Listener)
+		return
+	}
+
+	// Get lobby
+	lobby := Manager.GetLobbyConfigStorage(c.UGI, c.Lobby)
+	if lobby == nil {
+		SendCodeWithMessage(c, nil, "LOBBY_NOTFOUND", packet.Listener)
+		return
+	}
+
+	// Check if the lobby permits peers to claim the host
+	if !lobby.AllowHostReclaim || !lobby.AllowPeersToReclaim {
+		SendCodeWithMessage(c, nil, "RECLAIM_DISABLED", packet.Listener)
+		return
+	}
+
+	// Attempt to claim the lobby. The first peer to claim it wins.
+	if !Manager.ClaimLobbyOwnership(c.UGI, c.Lobby, c) {
+		SendCodeWithMessage(c, nil, "HOST_EXISTS", packet.Listener)
+		return
+	}
+
+	log.Printf("[Signaling] Client %d has claimed lobby %s in UGI %s", c.ID, c.Lobby, c.UGI)
+	stopReclaimTimer(c.UGI, c.Lobby)
+
+	// Make the client the host
+	PromoteToHost(c)
+
+	// Tell the remaining peers who the new host is
+	for _, peer := range Manager.GetPeerClientsByUGIAndLobby(c.UGI, c.Lobby) {
+		SendMessage(peer, &structs.SignalPacket{
+			Opcode: "HOST_RECLAIM",
+			Payload: &structs.NewHostParams{
+				ID:        c.ULID,
+				User:      c.Username,
+				LobbyID:   c.Lobby,
+				PublicKey: c.PublicKey,
+			},
+		})
+	}
+
+	// Tell the client that they are now the host
+	SendCodeWithMessage(c, nil, "ACK_HOST", packet.Listener)
 }
 
 func FullLobbyClose(client *structs.Client) {
+	// The client may be one of the peers being removed, so keep a copy of the lobby ID
+	lobbyID := client.Lobby
+	stopReclaimTimer(client.UGI, lobbyID)
+
 	// Notify all unconfigured peers that the lobby has closed
 	for _, peer := range Manager.GetAllClientsWithoutLobby(client.UGI) {
-		SendCodeWithMessage(peer, client.Lobby, "LOBBY_CLOSE")
+		SendCodeWithMessage(peer, lobbyID, "LOBBY_CLOSE")
 	}
 
 	// Remove all peers from the lobby.
-	for _, peer := range Manager.GetPeerClientsByUGIAndLobby(client.UGI, client.Lobby) {
+	for _, peer := range Manager.GetPeerClientsByUGIAndLobby(client.UGI, lobbyID) {
 		// Lock the peer, set it to not a peer, and unlock it
-		peer.Lock.Lock()
-		defer peer.Lock.Unlock()
 		func() {
+			peer.Lock.Lock()
+			defer peer.Lock.Unlock()
 			peer.IsPeer = false
 			peer.Lobby = ""
+			Manager.Update(peer)
 		}()
 
 		// Tell the peer the lobby is closing
-		SendCodeWithMessage(peer, client.Lobby, "LOBBY_CLOSE")
+		SendCodeWithMessage(peer, lobbyID, "LOBBY_CLOSE")
 	}
 
 	// If the client was a host, check if the lobby is empty. If it is, delete the lobby.
-	peers := len(Manager.GetPeerClientsByUGIAndLobby(client.UGI, client.Lobby))
+	peers := len(Manager.GetPeerClientsByUGIAndLobby(client.UGI, lobbyID))
 	if peers == 0 {
-		log.Printf("[Client Manager] Deleting unused lobby config store %s in UGI %s...", client.Lobby, client.UGI)
-		delete(Manager.Lobbies[client.UGI], client.Lobby)
-	}
-
-	// Check if the root UGI has no remaining lobbies. If there are no remaining lobbies, delete the root UGI lobby manager.
-	if len(Manager.Lobbies[client.UGI]) == 0 {
-		log.Printf("[Client Manager] Deleting unused UGI %s root lobby config store...", client.UGI)
-		delete(Manager.Lobbies, client.UGI)
+		Manager.DeleteLobbyConfigStorage(client.UGI, lobbyID)
 	}
 }
@@ -0,0 +1,46 @@
+package structs
+
+import "github.com/cloudlink-omega/backend/pkg/bitfield"
+
+// JSON structure for creating a game API key.
+type GameAPIKeyCreate struct {
+	Name   string   `json:"name" validate:"required,min=1,max=64" label:"name"`
+	Scopes []string `json:"scopes" validate:"required,min=1" label:"scopes"` // See constants.APIKeyScopeNames
+}
+
+// JSON response describing a game API key. The key itself is never included.
+type GameAPIKey struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Created  int64    `json:"created"`   // UNIX time
+	LastUsed int64    `json:"last_used"` // UNIX time, or 0 if the key hasn't been used
+}
+
+// JSON response after creating a game API key. This is the only time the key is shown.
+type GameAPIKeyCreated struct {
+	GameAPIKey
+	Key string `json:"key"`
+}
+
+// JSON response describing a lobby of a game, for game API keys.
+type GameLobby struct {
+	ID           string `json:"id"`
+	HostID       string `json:"host_id"`
+	HostUsername string `json:"host_username"`
+	CurrentPeers int    `json:"current_peers"`
+	MaximumPeers int    `json:"max_peers"`
+	Public       bool   `json:"public"`
+	Locked       bool   `json:"locked"`
+}
+
+// GameAPIKeyQuery is a game API key stored in the game_api_keys table.
+type GameAPIKeyQuery struct {
+	ID       string
+	GameID   string
+	Name     string
+	Hash     string
+	Scopes   bitfield.Bitfield8
+	Created  int64
+	LastUsed int64
+}
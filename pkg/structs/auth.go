@@ -11,9 +11,36 @@ type Register struct {
 type Login struct {
 	Email    string `json:"email" validate:"required,email,max=320" label:"email"`
 	Password string `json:"password" validate:"required,min=8,max=128" label:"password"`
+	Persist  bool   `json:"persist" label:"persist"` // "Remember me": the session lasts for 30 days instead of 24 hours
+}
+
+// JSON structure for refreshing a session token.
+type RefreshToken struct {
+	Token string `json:"token" validate:"required,ulid" label:"token"`
 }
 
 // Used for admin requests
 type AdminToken struct {
 	Token string `json:"token" validate:"required,ulid" label:"token"`
 }
+
+// JSON structure for requesting a password reset.
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email,max=320" label:"email"`
+}
+
+// JSON structure for resetting a password using a password reset token.
+type ResetPassword struct {
+	Token    string `json:"token" validate:"required,ulid" label:"token"`
+	Password string `json:"password" validate:"required,min=8,max=128" label:"password"`
+}
+
+// JSON structure for revoking every session using a link from a password reset email.
+type RevokeSessions struct {
+	Token string `json:"token" validate:"required,ulid" label:"token"`
+}
+
+// JSON structure for revoking a session using a link from a new login email.
+type RevokeSession struct {
+	Token string `json:"token" validate:"required,ulid" label:"token"`
+}
@@ -0,0 +1,33 @@
+package structs
+
+// JSON structure for banning a user.
+type BanUser struct {
+	Token   string `json:"token" validate:"required,ulid" label:"token"`
+	User    string `json:"user" validate:"required,ulid" label:"user"`
+	Reason  string `json:"reason" validate:"required,max=255" label:"reason"`
+	Expires int64  `json:"expires" validate:"gte=0" label:"expires"` // UNIX time, 0 for a permanent ban
+	Appeal  string `json:"appeal" validate:"max=255" label:"appeal"` // How the user can appeal the ban
+}
+
+// JSON structure for lifting a ban.
+type UnbanUser struct {
+	Token string `json:"token" validate:"required,ulid" label:"token"`
+	User  string `json:"user" validate:"required,ulid" label:"user"`
+}
+
+// JSON response (and USER_BANNED payload) explaining why an account is banned.
+type BanNotice struct {
+	Reason  string `json:"reason"`
+	Expires int64  `json:"expires"` // UNIX time, 0 if the ban is permanent
+	Appeal  string `json:"appeal"`
+}
+
+// BanQuery is a ban stored in the user_bans table.
+type BanQuery struct {
+	UserID  string
+	Reason  string
+	Admin   string
+	Expires int64
+	Appeal  string
+	Created int64
+}
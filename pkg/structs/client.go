@@ -2,29 +2,36 @@ package structs
 
 import (
 	"sync"
+	"time"
 
 	"github.com/cloudlink-omega/backend/pkg/bitfield"
 	"github.com/gorilla/websocket"
 )
 
+// Fields tagged with "redis" are shared with other servers when using the KeyDB client manager.
 type Client struct {
 	Conn          *websocket.Conn
 	Email         string
 	UserState     bitfield.Bitfield8 // Bitfield
 	SessionState  bitfield.Bitfield8 // Bitfield
-	ID            uint64             // For client manager tracking only
-	UGI           string
-	IsHost        bool   // Set to true when CONFIG_HOST is received or the server makes another peer the host with HOST_RECLAIM, or a peer with CLAIM_HOST
-	IsPeer        bool   // Set to true when CONFIG_PEER is received
-	Authorization string // ULID session token
-	Username      string
-	ULID          string
-	Expiry        int64 // UNIX time
-	ValidSession  bool
-	Origin        string // Hostname of the origin of the connection
-	GameName      string
-	DeveloperName string
-	Lobby         string
+	ID            uint64             `redis:"id"` // For client manager tracking only
+	UGI           string             `redis:"ugi"`
+	IsHost        bool               `redis:"host"` // Set to true when CONFIG_HOST is received or the server makes another peer the host with HOST_RECLAIM, or a peer with CLAIM_HOST
+	IsPeer        bool               `redis:"peer"` // Set to true when CONFIG_PEER is received
+	Authorization string             // ULID session token
+	Username      string             `redis:"username"`
+	ULID          string             `redis:"ulid"`
+	Expiry        int64              `redis:"expiry"` // UNIX time
+	ValidSession  bool               `redis:"valid_session"`
+	Origin        string             `redis:"origin"` // Hostname of the origin of the connection
+	GameName      string             `redis:"game_name"`
+	DeveloperName string             `redis:"developer_name"`
+	Lobby         string             `redis:"lobby"`
+	Node          string             `redis:"node"` // Server nickname of the signaling server the client is connected to
 	Lock          sync.RWMutex
-	PublicKey     string // Set when CONFIG_HOST or CONFIG_PEER. ECDH-P256-AES-GCM with SPKI-BASE64 encoding.
+	ResumeToken   string      // Secret token used to resume the session with RESUME after the connection drops
+	Parked        bool        // Set to true while the connection has dropped and the client is waiting for RESUME
+	Queue         []any       // Messages sent to the client while it was parked
+	ParkTimer     *time.Timer // Deletes the client if it is not resumed in time
+	PublicKey     string      `redis:"pubkey"` // Set when CONFIG_HOST or CONFIG_PEER. ECDH-P256-AES-GCM with SPKI-BASE64 encoding.
 }
@@ -0,0 +1,65 @@
+package structs
+
+import "github.com/cloudlink-omega/backend/pkg/bitfield"
+
+// JSON structure for applying for a developer account.
+type DeveloperApplication struct {
+	Token       string `json:"token" validate:"required,ulid" label:"token"`
+	Name        string `json:"name" validate:"required,min=3,max=64" label:"name"`
+	Description string `json:"description" validate:"max=255" label:"description"`
+}
+
+// JSON response after applying for a developer account.
+type DeveloperCreated struct {
+	ID string `json:"id"`
+}
+
+// JSON structure for approving or denying a developer account using a link sent to an admin.
+type DeveloperReview struct {
+	Token     string `json:"token" validate:"required,ulid" label:"token"`
+	Developer string `json:"developer" validate:"required,ulid" label:"developer"`
+	Action    string `json:"action" validate:"required,oneof=approve deny" label:"action"`
+}
+
+// DeveloperQuery is a developer account stored in the developers table.
+type DeveloperQuery struct {
+	ID          string
+	Name        string
+	Description string
+	State       bitfield.Bitfield8
+	Created     int64
+}
+
+// JSON structure for inviting a user to a developer account.
+type DeveloperInvite struct {
+	Email string `json:"email" validate:"required,email" label:"email"`
+	Role  string `json:"role" validate:"required,oneof=viewer editor admin" label:"role"`
+}
+
+// JSON structure for accepting an invitation to a developer account using a link sent to the invitee.
+type DeveloperInviteAccept struct {
+	Token     string `json:"token" validate:"required,ulid" label:"token"`
+	Developer string `json:"developer" validate:"required,ulid" label:"developer"`
+}
+
+// JSON structure for changing the role of a developer member.
+type DeveloperMemberRole struct {
+	Role string `json:"role" validate:"required,oneof=viewer editor admin" label:"role"`
+}
+
+// JSON response describing a member of a developer account.
+type DeveloperMember struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`    // See constants.DeveloperRoleNames
+	Invited  bool   `json:"invited"` // True until the user accepts the invitation
+}
+
+// DeveloperMemberQuery is a member of a developer account, stored in the developer_members table.
+type DeveloperMemberQuery struct {
+	DeveloperID string
+	UserID      string
+	Username    string // From the users table
+	Description string
+	State       bitfield.Bitfield8
+}
@@ -25,4 +25,17 @@ type TemplateData struct {
 	DeveloperOwner       string
 	DeveloperName        string
 	DeveloperDescription string
+	ResetLink            string
+	RevokeLink           string
+	Code                 string
+	IPAddress            string
+	Browser              string
+	Timestamp            string
+	Address              string
+	Alert                string
+	ApproveLink          string
+	DenyLink             string
+	InviteLink           string
+	Inviter              string
+	Role                 string
 }
@@ -0,0 +1,51 @@
+package structs
+
+import "github.com/cloudlink-omega/backend/pkg/bitfield"
+
+// JSON structure for creating a game.
+type GameCreate struct {
+	Name string `json:"name" validate:"required,min=1,max=64" label:"name"`
+}
+
+// JSON structure for changing a game. Fields that are left out are not changed.
+type GameUpdate struct {
+	Name  string          `json:"name" validate:"omitempty,min=1,max=64" label:"name"`
+	Flags map[string]bool `json:"flags" label:"flags"` // See constants.GameFlagNames
+}
+
+// JSON structure for adding or removing an authorized origin of a game.
+type GameOrigin struct {
+	Origin string `json:"origin" validate:"required,max=255" label:"origin"`
+}
+
+// JSON response after creating a game.
+type GameCreated struct {
+	ID string `json:"id"` // The UGI of the game
+}
+
+// JSON response describing a game to its developer.
+type GameInfo struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Created  int64           `json:"created"` // UNIX time
+	State    uint8           `json:"state"`
+	Verified bool            `json:"verified"` // Set by admins
+	Flags    map[string]bool `json:"flags"`
+}
+
+// GameQuery is a game stored in the games table.
+type GameQuery struct {
+	ID          string
+	DeveloperID string
+	Name        string
+	State       bitfield.Bitfield8
+	Created     int64
+}
+
+// UGIQuery is a game and its developer account, as found by VerifyUGI.
+type UGIQuery struct {
+	GameName       string
+	DeveloperName  string
+	GameState      bitfield.Bitfield8
+	DeveloperState bitfield.Bitfield8
+}
@@ -0,0 +1,23 @@
+package structs
+
+// JSON structure for adding an IP address or CIDR range to the blocklist or allowlist.
+type IPListAdd struct {
+	Token   string `json:"token" validate:"required,ulid" label:"token"`
+	Address string `json:"address" validate:"required,max=64" label:"address"` // IP address or CIDR range
+	Reason  string `json:"reason" validate:"max=255" label:"reason"`
+	Expires int64  `json:"expires" validate:"gte=0" label:"expires"` // UNIX time, 0 if the entry never expires
+}
+
+// JSON structure for removing an IP address or CIDR range from the blocklist or allowlist.
+type IPListRemove struct {
+	Token   string `json:"token" validate:"required,ulid" label:"token"`
+	Address string `json:"address" validate:"required,max=64" label:"address"`
+}
+
+// IPListEntry is an entry of the ip_blocklist or ip_whitelist table.
+type IPListEntry struct {
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+	Created int64  `json:"created"` // UNIX time
+	Expires int64  `json:"expires"` // UNIX time, 0 if the entry never expires
+}
@@ -0,0 +1,8 @@
+package structs
+
+// KeyDB configuration parameters
+type KeyDBConfig struct {
+	Host string
+	Port int
+	DB   int
+}
@@ -2,14 +2,14 @@ package structs
 
 // Managing lobbies
 type LobbyConfigStore struct {
-	ID                   string
-	MaximumPeers         int
-	AllowHostReclaim     bool
-	AllowPeersToReclaim  bool
-	CurrentOwnerID       uint64 // For client manager tracking only
-	CurrentOwnerULID     string // For signaling
-	CurrentOwnerUsername string // For lobby manager
-	Password             string // Scrypt hash or empty
-	IsPublic             bool
-	Locked               bool
+	ID                   string `redis:"id"`
+	MaximumPeers         int    `redis:"max_peers"`
+	AllowHostReclaim     bool   `redis:"allow_host_reclaim"`
+	AllowPeersToReclaim  bool   `redis:"allow_peers_to_reclaim"`
+	CurrentOwnerID       uint64 `redis:"owner_id"`       // For client manager tracking only
+	CurrentOwnerULID     string `redis:"owner_ulid"`     // For signaling
+	CurrentOwnerUsername string `redis:"owner_username"` // For lobby manager
+	Password             string `redis:"password"`       // Scrypt hash or empty
+	IsPublic             bool   `redis:"public"`
+	Locked               bool   `redis:"locked"`
 }
@@ -0,0 +1,67 @@
+package structs
+
+import "github.com/cloudlink-omega/backend/pkg/bitfield"
+
+// JSON structure for confirming TOTP enrollment, which needs a session token, the account password and a code.
+type MFACode struct {
+	Token    string `json:"token" validate:"required,ulid" label:"token"`
+	Password string `json:"password" validate:"required,min=8,max=128" label:"password"`
+	Code     string `json:"code" validate:"required,max=32" label:"code"`
+}
+
+// JSON structure for two-factor authentication requests that need a session token and the account password.
+type MFAPassword struct {
+	Token    string `json:"token" validate:"required,ulid" label:"token"`
+	Password string `json:"password" validate:"required,min=8,max=128" label:"password"`
+}
+
+// JSON structure for completing a login challenge.
+// The code can be a TOTP code, an emailed security code, or a recovery code.
+type MFAChallenge struct {
+	Challenge string `json:"challenge" validate:"required,ulid" label:"challenge"`
+	Code      string `json:"code" validate:"required,max=32" label:"code"`
+}
+
+// JSON structure for requesting an emailed security code for a login challenge.
+type MFAChallengeEmail struct {
+	Challenge string `json:"challenge" validate:"required,ulid" label:"challenge"`
+}
+
+// JSON response for a login that requires a second factor.
+type LoginChallenge struct {
+	Challenge string   `json:"challenge"`
+	Methods   []string `json:"methods"` // "totp", "email" and/or "recovery"
+	Expires   int64    `json:"expires"` // Timestamp as UNIX time
+}
+
+// JSON response for starting TOTP enrollment.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth:// URI, for QR codes
+}
+
+// JSON response for newly generated recovery codes. These are only shown once.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+type TOTPQuery struct {
+	Secret   string
+	State    bitfield.Bitfield8
+	LastStep int64
+}
+
+type RecoveryCodeQuery struct {
+	ID   string
+	Hash string
+}
+
+type LoginChallengeQuery struct {
+	ID       string
+	UserID   string
+	Origin   string
+	Code     string // Scrypt hash of the emailed security code, or empty
+	Persist  bool
+	Attempts uint8
+	Expires  int64
+}
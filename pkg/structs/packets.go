@@ -11,10 +11,27 @@ type SignalPacket struct {
 
 // JSON structure for signaling INIT_OK response.
 type InitOK struct {
-	User      string `json:"user"`
-	Id        string `json:"id"`
-	Game      string `json:"game"`
-	Developer string `json:"developer"`
+	User        string `json:"user"`
+	Id          string `json:"id"`
+	Game        string `json:"game"`
+	Developer   string `json:"developer"`
+	ResumeToken string `json:"resume_token"`
+	Voice       bool   `json:"voice"`    // The game supports voice chat
+	Mature      bool   `json:"mature"`   // The game is considered mature
+	Verified    bool   `json:"verified"` // The game has been verified by an admin
+}
+
+// JSON structure for signaling RESUME_OK response.
+type ResumeOK struct {
+	User        string `json:"user"`
+	Id          string `json:"id"`
+	Game        string `json:"game"`
+	Developer   string `json:"developer"`
+	ResumeToken string `json:"resume_token"`
+	Lobby       string `json:"lobby"`
+	IsHost      bool   `json:"host"`
+	IsPeer      bool   `json:"peer"`
+	Queued      int    `json:"queued"`
 }
 
 type HostConfigPacket struct {
@@ -39,6 +56,15 @@ type PeerConfigPacket struct {
 	} `json:"payload" validate:"required_with=LobbyID" label:"payload"`
 }
 
+// Declare the packet format for the SIZE signaling command.
+type LobbySizePacket struct {
+	Opcode  string `json:"opcode" validate:"required" label:"opcode"`
+	Payload *struct {
+		MaximumPeers *int `json:"max_peers" validate:"required,min=0,max=100" label:"max_peers"` // Required, because 0 removes the limit
+		Force        bool `json:"force" validate:"boolean" label:"force"`
+	} `json:"payload" validate:"required" label:"payload"`
+}
+
 // Declare the packet format for the NEW_HOST signaling event.
 type NewHostParams struct {
 	ID        string `json:"id"`
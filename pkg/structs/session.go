@@ -10,3 +10,19 @@ type Session struct {
 	Expiry  int64              // Timestamp as UNIX time
 	Origin  string             // Tinytext
 }
+
+// JSON structure for a session, as listed by GET /sessions.
+// The ID is derived from the session token, so that listing sessions does not reveal other session tokens.
+type SessionListing struct {
+	ID      string `json:"id"`
+	Origin  string `json:"origin"`
+	Created int64  `json:"created"` // Timestamp as UNIX time
+	Expires int64  `json:"expires"` // Timestamp as UNIX time
+	Current bool   `json:"current"` // True if this is the session used to list sessions
+}
+
+// JSON structure for logging out.
+type Logout struct {
+	Token      string `json:"token" validate:"required,ulid" label:"token"`
+	Everywhere bool   `json:"everywhere" label:"everywhere"` // Revoke every session of the user instead of only this one
+}
@@ -0,0 +1,40 @@
+package structs
+
+// JSON structure for searching users as an admin.
+type AdminUserSearch struct {
+	Token   string `json:"token" validate:"required,ulid" label:"token"`
+	Query   string `json:"query" validate:"max=320" label:"query"` // Part of a username or email address, or a user ID. Empty to list every user.
+	Page    int    `json:"page" validate:"gte=0" label:"page"`     // Starts at 0
+	PerPage int    `json:"per_page" validate:"gte=0,lte=100" label:"per_page"`
+}
+
+// JSON structure for admin requests about a single user.
+type AdminUserRequest struct {
+	Token string `json:"token" validate:"required,ulid" label:"token"`
+	User  string `json:"user" validate:"required,ulid" label:"user"`
+}
+
+// JSON structure for changing the flags of a user as an admin. Flags that are left out are not changed.
+type AdminUserFlags struct {
+	Token string          `json:"token" validate:"required,ulid" label:"token"`
+	User  string          `json:"user" validate:"required,ulid" label:"user"`
+	Flags map[string]bool `json:"flags" validate:"required,min=1" label:"flags"` // See constants.UserFlagNames
+}
+
+// JSON response describing a user to an admin.
+type AdminUser struct {
+	ID       string          `json:"id"`
+	Username string          `json:"username"`
+	Email    string          `json:"email"`
+	Created  string          `json:"created"` // UNIX time
+	State    uint8           `json:"state"`
+	Flags    map[string]bool `json:"flags"`
+}
+
+// JSON response for a user search.
+type AdminUserSearchResults struct {
+	Users   []*AdminUser `json:"users"`
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"per_page"`
+}
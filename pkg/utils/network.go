@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RemoteIP returns the IP address of the client that made a request, without the port.
+// If the RealIP middleware is in use, this is the address provided by a trusted proxy.
+func RemoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ForwardedIP returns the address of the client that a trusted proxy made a request for, as provided by the
+// True-Client-IP, X-Real-IP or X-Forwarded-For header. Returns an empty string if the request didn't come from a trusted
+// proxy, or the proxy didn't provide a valid address.
+//
+// X-Forwarded-For is read from right to left, skipping trusted proxies, since anything to the left of the last
+// untrusted address could have been made up by the client.
+func ForwardedIP(r *http.Request, trusted []netip.Prefix) string {
+	if !isTrustedProxy(RemoteIP(r), trusted) {
+		return ""
+	}
+
+	for _, header := range []string{"True-Client-IP", "X-Real-IP"} {
+		if address, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(header))); err == nil {
+			return address.Unmap().String()
+		}
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		address, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return ""
+		}
+		if !isTrustedProxy(address.String(), trusted) {
+			return address.Unmap().String()
+		}
+	}
+	return ""
+}
+
+// isTrustedProxy checks if an address belongs to a trusted proxy.
+func isTrustedProxy(address string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// OriginAllowed checks the value of an Origin header against a list of authorized origin patterns.
+//
+// Patterns may be "*" (any origin), a hostname ("example.com"), a hostname with a port ("localhost:8080"),
+// or a wildcard subdomain ("*.example.com", which does not match "example.com" itself). Patterns may also
+// start with a scheme ("https://example.com"), in which case the scheme must match as well.
+func OriginAllowed(origin string, patterns []string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), "/")
+		if pattern == "*" {
+			return true
+		}
+
+		// Match the scheme, if specified
+		if scheme, rest, ok := strings.Cut(pattern, "://"); ok {
+			if scheme != strings.ToLower(u.Scheme) {
+				continue
+			}
+			pattern = rest
+		}
+
+		// Match the port, if specified
+		if patternHost, patternPort, err := net.SplitHostPort(pattern); err == nil {
+			if patternPort != u.Port() {
+				continue
+			}
+			pattern = patternHost
+		}
+
+		// Match the hostname
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidOriginPattern checks if an authorized origin pattern can be used with OriginAllowed.
+func ValidOriginPattern(pattern string) bool {
+	pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), "/")
+	if pattern == "*" {
+		return true
+	}
+
+	if scheme, rest, ok := strings.Cut(pattern, "://"); ok {
+		if scheme != "http" && scheme != "https" {
+			return false
+		}
+		pattern = rest
+	}
+	if strings.ContainsAny(pattern, "/?#@ ") {
+		return false
+	}
+
+	if host, port, err := net.SplitHostPort(pattern); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return false
+		}
+		pattern = host
+	}
+
+	if net.ParseIP(pattern) != nil {
+		return true
+	}
+	pattern = strings.TrimPrefix(pattern, "*.")
+	return pattern != "" && !strings.ContainsAny(pattern, "*:")
+}
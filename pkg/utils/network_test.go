@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	for _, tc := range []struct {
+		origin   string
+		patterns []string
+		want     bool
+	}{
+		{"https://example.com", []string{"*"}, true},
+		{"https://example.com", []string{"example.com"}, true},
+		{"https://EXAMPLE.com", []string{" Example.COM/ "}, true},
+		{"https://example.org", []string{"example.com"}, false},
+		{"https://example.com", nil, false},
+
+		// Wildcard subdomains don't match the domain itself
+		{"https://game.example.com", []string{"*.example.com"}, true},
+		{"https://a.b.example.com", []string{"*.example.com"}, true},
+		{"https://example.com", []string{"*.example.com"}, false},
+		{"https://badexample.com", []string{"*.example.com"}, false},
+
+		// Ports must match when specified
+		{"http://localhost:8080", []string{"localhost:8080"}, true},
+		{"http://localhost:3000", []string{"localhost:8080"}, false},
+		{"http://localhost:3000", []string{"localhost"}, true},
+
+		// Schemes must match when specified
+		{"https://example.com", []string{"https://example.com"}, true},
+		{"http://example.com", []string{"https://example.com"}, false},
+		{"http://example.com", []string{"https://example.com", "http://example.com"}, true},
+
+		// Origins must be URLs with a host
+		{"", []string{"*"}, false},
+		{"null", []string{"*"}, false},
+		{"example.com", []string{"*"}, false},
+	} {
+		if got := OriginAllowed(tc.origin, tc.patterns); got != tc.want {
+			t.Errorf("OriginAllowed(%q, %q) = %v, want %v", tc.origin, tc.patterns, got, tc.want)
+		}
+	}
+}
+
+func TestValidOriginPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		want    bool
+	}{
+		{"*", true},
+		{"example.com", true},
+		{"*.example.com", true},
+		{"localhost:8080", true},
+		{"https://example.com", true},
+		{"http://*.example.com:8080", true},
+		{"127.0.0.1", true},
+		{"Example.com/", true},
+		{"", false},
+		{"*.", false},
+		{"ftp://example.com", false},
+		{"example.com/path", false},
+		{"example.com?query", false},
+		{"user@example.com", false},
+		{"game.*.example.com", false},
+		{"example.com:port", false},
+		{"example.com:70000", false},
+	} {
+		if got := ValidOriginPattern(tc.pattern); got != tc.want {
+			t.Errorf("ValidOriginPattern(%q) = %v, want %v", tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestForwardedIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+
+	for _, tc := range []struct {
+		name    string
+		remote  string
+		headers map[string][]string
+		want    string
+	}{
+		{"untrusted proxy", "203.0.113.1:1234", map[string][]string{"X-Real-IP": {"198.51.100.1"}}, ""},
+		{"no headers", "10.0.0.1:1234", nil, ""},
+		{"true client ip", "10.0.0.1:1234", map[string][]string{"True-Client-IP": {"198.51.100.1"}, "X-Real-IP": {"198.51.100.2"}}, "198.51.100.1"},
+		{"real ip", "10.0.0.1:1234", map[string][]string{"X-Real-IP": {" 198.51.100.2 "}}, "198.51.100.2"},
+		{"ipv6 proxy", "[::1]:1234", map[string][]string{"X-Real-IP": {"2001:db8::1"}}, "2001:db8::1"},
+		{"mapped address", "10.0.0.1:1234", map[string][]string{"X-Real-IP": {"::ffff:198.51.100.3"}}, "198.51.100.3"},
+		{"invalid real ip falls back", "10.0.0.1:1234", map[string][]string{"X-Real-IP": {"garbage"}, "X-Forwarded-For": {"198.51.100.4"}}, "198.51.100.4"},
+
+		// X-Forwarded-For is read from the right, skipping trusted proxies
+		{"forwarded for", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"192.0.2.1, 198.51.100.5, 10.0.0.2"}}, "198.51.100.5"},
+		{"forwarded for headers", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"192.0.2.1", "198.51.100.6"}}, "198.51.100.6"},
+		{"only proxies", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, ""},
+		{"invalid hop", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"198.51.100.7, garbage"}}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remote
+			for header, values := range tc.headers {
+				for _, value := range values {
+					r.Header.Add(header, value)
+				}
+			}
+			if got := ForwardedIP(r, trusted); got != tc.want {
+				t.Errorf("ForwardedIP() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
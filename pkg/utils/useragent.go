@@ -0,0 +1,63 @@
+package utils
+
+import "strings"
+
+// Browsers and operating systems recognized by DescribeUserAgent, in the order they are checked.
+// Order matters, since most browsers also claim to be the browsers they are based on (i.e. Edge claims to be Chrome and Safari).
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg/", "Microsoft Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Safari/", "Safari"},
+}
+
+var userAgentSystems = []struct{ token, name string }{
+	{"Windows", "Windows"},
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// DescribeUserAgent returns an approximate, human-readable description of a User-Agent header (i.e. "Firefox on Windows").
+func DescribeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown"
+	}
+
+	browser := ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range userAgentSystems {
+		if strings.Contains(ua, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return "Unknown browser on " + system
+	}
+
+	// Not a browser (i.e. a game engine or a script), so show the product name
+	product, _, _ := strings.Cut(ua, " ")
+	if len(product) > 64 {
+		product = product[:64]
+	}
+	return product
+}